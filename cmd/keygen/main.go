@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// keygen writes a new JWT signing key to <dir>/<kid>.pem. To rotate keys,
+// generate a new one, point JWT_SIGNING_KEY_ID at it and delete the old file
+// once the access tokens it signed have expired.
+func main() {
+	alg := flag.String("alg", "ES256", "signing algorithm: RS256, ES256 or EdDSA")
+	dir := flag.String("dir", filepath.Join("config", "keys"), "directory to write the key to")
+	kid := flag.String("kid", time.Now().UTC().Format("20060102150405"), "key ID")
+	flag.Parse()
+
+	var key crypto.Signer
+	var err error
+	switch *alg {
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		log.Fatalf("Unsupported algorithm: %s", *alg)
+	}
+	if err != nil {
+		log.Fatalf("Error generating key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		log.Fatalf("Error encoding key: %v", err)
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		log.Fatalf("Error creating key directory: %v", err)
+	}
+
+	path := filepath.Join(*dir, *kid+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		log.Fatalf("Error writing key: %v", err)
+	}
+
+	fmt.Printf("Wrote %s key to %s\nSet JWT_KEYS_DIR=%s and JWT_SIGNING_KEY_ID=%s to sign with it\n", *alg, path, *dir, *kid)
+}
@@ -3,25 +3,40 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Redis     RedisConfig
+	JWT       JWTConfig
+	Auth      AuthConfig
+	OAuth     OAuthConfig
+	Providers []IdentityProviderConfig
+	SAML      []SAMLTenantConfig
+	SCIM      SCIMConfig
+	LDAP      LDAPConfig
+	WebAuthn  WebAuthnConfig
+	Password  PasswordConfig
+	Lockout   LockoutConfig
+	RateLimit RateLimitConfig
+	Cookie    SessionCookieConfig
+	Mail      MailConfig
 }
 
 type ServerConfig struct {
 	Port         string
 	Environment  string
 	AllowOrigins string
+	AppURL       string
 }
 
 type DatabaseConfig struct {
@@ -41,8 +56,189 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret        string
-	SessionExpiry time.Duration
+	Secret            string
+	KeysDir           string
+	SigningKeyID      string
+	AccessTokenExpiry time.Duration
+	SessionExpiry     time.Duration
+}
+
+// AuthConfig controls how users log in. Backends lists the authenticators
+// that check passwords, in the order they are tried: "database" and "ldap".
+type AuthConfig struct {
+	Backends                        []string
+	PasswordResetExpiry             time.Duration
+	RequireEmailVerification        bool
+	EmailVerificationExpiry         time.Duration
+	EmailVerificationResendInterval time.Duration
+	MFAIssuer                       string
+	MFAChallengeExpiry              time.Duration
+	MagicLinkExpiry                 time.Duration
+}
+
+// OAuthConfig controls the lifetime of what the OAuth 2.0 authorization
+// server hands out to client applications. Issuer is the public base URL of
+// this service, as it appears in ID tokens and the OpenID Connect discovery
+// document. IntrospectionCacheExpiry is how long introspection remembers
+// that a token is dead, so that services asking about it again don't cost a
+// lookup; zero disables the cache.
+type OAuthConfig struct {
+	Issuer                   string
+	AccessTokenExpiry        time.Duration
+	RefreshTokenExpiry       time.Duration
+	CodeExpiry               time.Duration
+	IntrospectionCacheExpiry time.Duration
+}
+
+// IdentityProviderConfig describes an external OpenID Connect provider users
+// can log in with. Its endpoints and keys are discovered from Issuer.
+// RedirectURL is the page the provider sends the browser back to; it passes
+// the code and state on to the login callback.
+type IdentityProviderConfig struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+}
+
+// SAMLTenantConfig connects one enterprise customer's SAML 2.0 identity
+// provider. EntityID and ACSURL identify this service provider to the IdP
+// and are what its assertions must be addressed to. Email, first and last
+// name are read from the named assertion attributes. RedirectURL is the
+// frontend page the browser lands on after the assertion was accepted; it
+// exchanges the code it is given at /user/login/saml. IdP-initiated logins,
+// which answer no request of ours, are only accepted with AllowIDPInitiated.
+// LinkByEmail works as for LDAP.
+type SAMLTenantConfig struct {
+	Name               string
+	EntityID           string
+	ACSURL             string
+	IDPEntityID        string
+	IDPSSOURL          string
+	IDPCertificateFile string
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	AllowIDPInitiated  bool
+	LinkByEmail        bool
+	RedirectURL        string
+}
+
+// SCIMConfig enables the SCIM 2.0 provisioning API at /scim/v2. Token is
+// the bearer token the identity provider's provisioning client sends; the
+// API is off while it is empty.
+type SCIMConfig struct {
+	Token string
+}
+
+// LDAPConfig connects the "ldap" authenticator to a directory such as Active
+// Directory or OpenLDAP. Users are found with UserFilter, where %s is the
+// escaped login email, and then bound as. GroupRoles maps group DNs, read
+// from GroupAttribute, to the roles their members get. With LinkByEmail an
+// existing local account with the same email is taken over by the directory
+// user instead of refusing the login.
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	IDAttribute        string
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	GroupAttribute     string
+	GroupRoles         map[string]string
+	LinkByEmail        bool
+	Timeout            time.Duration
+}
+
+// WebAuthnConfig identifies this service to passkeys. RPID is the domain
+// passkeys are bound to; it must be the host of every origin or a parent
+// domain of it, and changing it orphans every registered passkey. Origins
+// are the frontend origins allowed to run the ceremonies. Timeout is how
+// long the browser prompt and its challenge stay valid.
+type WebAuthnConfig struct {
+	RPID    string
+	RPName  string
+	Origins []string
+	Timeout time.Duration
+}
+
+// PasswordConfig selects how passwords are hashed and which passwords users
+// may choose. Argon2Memory is in KiB.
+type PasswordConfig struct {
+	Algorithm            string
+	Argon2Memory         uint32
+	Argon2Iterations     uint32
+	Argon2Parallelism    uint8
+	BcryptCost           int
+	MinLength            int
+	MaxLength            int
+	RequireUppercase     bool
+	RequireLowercase     bool
+	RequireDigit         bool
+	RequireSymbol        bool
+	DisallowPersonalInfo bool
+	MinStrength          int
+	BreachedDir          string
+	HistorySize          int
+	MaxAge               time.Duration
+}
+
+// LockoutConfig controls how failed logins are throttled. Failures are
+// counted per account and per IP within Window. After DelayAfter failures an
+// account must wait BaseDelay, doubling with every further failure, and after
+// MaxAttempts it is locked for Duration.
+type LockoutConfig struct {
+	MaxAttempts      int
+	MaxAttemptsPerIP int
+	Window           time.Duration
+	Duration         time.Duration
+	DelayAfter       int
+	BaseDelay        time.Duration
+}
+
+// Rate is a request budget of Limit requests per Window. A zero Limit
+// disables the limit.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+type RateLimitConfig struct {
+	Store         string
+	Global        Rate
+	Signup        Rate
+	Login         Rate
+	MagicLink     Rate
+	PasswordReset Rate
+	PostCreate    Rate
+}
+
+// SessionCookieConfig switches browser clients to cookie sessions. When
+// Enabled, endpoints that start a session set HttpOnly cookies instead of
+// returning the tokens, and cookie-authenticated requests must carry a CSRF
+// token.
+type SessionCookieConfig struct {
+	Enabled  bool
+	Name     string
+	Domain   string
+	Secure   bool
+	SameSite string
+}
+
+type MailConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
 }
 
 func LoadConfig() (*Config, error) {
@@ -58,13 +254,88 @@ func LoadConfig() (*Config, error) {
 	}
 
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
-	sessionExpiry, _ := time.ParseDuration(getEnv("SESSION_EXPIRY", "24h"))
+	accessTokenExpiry, _ := time.ParseDuration(getEnv("ACCESS_TOKEN_EXPIRY", "15m"))
+	sessionExpiry, _ := time.ParseDuration(getEnv("SESSION_EXPIRY", "720h"))
+	passwordResetExpiry, _ := time.ParseDuration(getEnv("PASSWORD_RESET_EXPIRY", "1h"))
+	requireEmailVerification, _ := strconv.ParseBool(getEnv("REQUIRE_EMAIL_VERIFICATION", "false"))
+	emailVerificationExpiry, _ := time.ParseDuration(getEnv("EMAIL_VERIFICATION_EXPIRY", "24h"))
+	emailVerificationResendInterval, _ := time.ParseDuration(getEnv("EMAIL_VERIFICATION_RESEND_INTERVAL", "1m"))
+	mfaChallengeExpiry, _ := time.ParseDuration(getEnv("MFA_CHALLENGE_EXPIRY", "5m"))
+	magicLinkExpiry, _ := time.ParseDuration(getEnv("MAGIC_LINK_EXPIRY", "15m"))
+	oauthAccessTokenExpiry, _ := time.ParseDuration(getEnv("OAUTH_ACCESS_TOKEN_EXPIRY", "1h"))
+	oauthRefreshTokenExpiry, _ := time.ParseDuration(getEnv("OAUTH_REFRESH_TOKEN_EXPIRY", "720h"))
+	oauthCodeExpiry, _ := time.ParseDuration(getEnv("OAUTH_CODE_EXPIRY", "1m"))
+	oauthIntrospectionCacheExpiry, _ := time.ParseDuration(getEnv("OAUTH_INTROSPECTION_CACHE_EXPIRY", "10m"))
+	argon2Memory, _ := strconv.ParseUint(getEnv("ARGON2_MEMORY", "65536"), 10, 32)
+	argon2Iterations, _ := strconv.ParseUint(getEnv("ARGON2_ITERATIONS", "3"), 10, 32)
+	argon2Parallelism, _ := strconv.ParseUint(getEnv("ARGON2_PARALLELISM", "2"), 10, 8)
+	bcryptCost, _ := strconv.Atoi(getEnv("BCRYPT_COST", "10"))
+	passwordMinLength, _ := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "6"))
+	passwordMaxLength, _ := strconv.Atoi(getEnv("PASSWORD_MAX_LENGTH", "128"))
+	passwordRequireUppercase, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_UPPERCASE", "false"))
+	passwordRequireLowercase, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_LOWERCASE", "false"))
+	passwordRequireDigit, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_DIGIT", "false"))
+	passwordRequireSymbol, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_SYMBOL", "false"))
+	passwordDisallowPersonalInfo, _ := strconv.ParseBool(getEnv("PASSWORD_DISALLOW_PERSONAL_INFO", "true"))
+	passwordMinStrength, _ := strconv.Atoi(getEnv("PASSWORD_MIN_STRENGTH", "0"))
+	passwordHistorySize, _ := strconv.Atoi(getEnv("PASSWORD_HISTORY_SIZE", "5"))
+	passwordMaxAge, _ := time.ParseDuration(getEnv("PASSWORD_MAX_AGE", "0"))
+	loginMaxAttempts, _ := strconv.Atoi(getEnv("LOGIN_MAX_ATTEMPTS", "10"))
+	loginMaxAttemptsPerIP, _ := strconv.Atoi(getEnv("LOGIN_MAX_ATTEMPTS_PER_IP", "100"))
+	loginAttemptWindow, _ := time.ParseDuration(getEnv("LOGIN_ATTEMPT_WINDOW", "15m"))
+	loginLockoutDuration, _ := time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "15m"))
+	loginDelayAfter, _ := strconv.Atoi(getEnv("LOGIN_DELAY_AFTER", "3"))
+	loginBaseDelay, _ := time.ParseDuration(getEnv("LOGIN_BASE_DELAY", "1s"))
+
+	ldapStartTLS, _ := strconv.ParseBool(getEnv("LDAP_START_TLS", "false"))
+	ldapLinkByEmail, _ := strconv.ParseBool(getEnv("LDAP_LINK_BY_EMAIL", "false"))
+	ldapTimeout, _ := time.ParseDuration(getEnv("LDAP_TIMEOUT", "5s"))
+	webAuthnTimeout, _ := time.ParseDuration(getEnv("WEBAUTHN_TIMEOUT", "5m"))
+
+	sessionCookieEnabled, _ := strconv.ParseBool(getEnv("SESSION_COOKIE_ENABLED", "false"))
+	sessionCookieSecure, _ := strconv.ParseBool(getEnv("SESSION_COOKIE_SECURE", "true"))
+
+	rates := map[string]*Rate{}
+	for key, defaultValue := range map[string]string{
+		"RATE_LIMIT_GLOBAL":         "300/1m",
+		"RATE_LIMIT_SIGNUP":         "10/1h",
+		"RATE_LIMIT_LOGIN":          "60/1m",
+		"RATE_LIMIT_MAGIC_LINK":     "5/15m",
+		"RATE_LIMIT_PASSWORD_RESET": "5/15m",
+		"RATE_LIMIT_POST_CREATE":    "30/1m",
+	} {
+		rate, err := parseRate(getEnv(key, defaultValue))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		rates[key] = &rate
+	}
+
+	appURL := getEnv("APP_URL", "http://localhost:3000")
+	providers, err := loadIdentityProviders(appURL)
+	if err != nil {
+		return nil, err
+	}
+	oauthIssuer := strings.TrimSuffix(getEnv("OAUTH_ISSUER", "http://localhost:9999"), "/")
+	samlTenants, err := loadSAMLTenants(oauthIssuer, appURL)
+	if err != nil {
+		return nil, err
+	}
+
+	webAuthnRPID := getEnv("WEBAUTHN_RP_ID", "")
+	if webAuthnRPID == "" {
+		if parsed, err := url.Parse(appURL); err == nil {
+			webAuthnRPID = parsed.Hostname()
+		}
+	}
+	mfaIssuer := getEnv("MFA_ISSUER", "Go Auth Boilerplate")
 
 	return &Config{
 		Server: ServerConfig{
 			Port:         getEnv("PORT", "9999"),
 			Environment:  env,
 			AllowOrigins: getEnv("ALLOW_ORIGINS", "http://localhost:3000"),
+			AppURL:       appURL,
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -81,12 +352,229 @@ func LoadConfig() (*Config, error) {
 			DB:       redisDB,
 		},
 		JWT: JWTConfig{
-			Secret:        getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-it-in-production"),
-			SessionExpiry: sessionExpiry,
+			Secret:            getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-it-in-production"),
+			KeysDir:           getEnv("JWT_KEYS_DIR", ""),
+			SigningKeyID:      getEnv("JWT_SIGNING_KEY_ID", ""),
+			AccessTokenExpiry: accessTokenExpiry,
+			SessionExpiry:     sessionExpiry,
+		},
+		Auth: AuthConfig{
+			Backends:                        strings.Split(getEnv("AUTH_BACKENDS", "database"), ","),
+			PasswordResetExpiry:             passwordResetExpiry,
+			RequireEmailVerification:        requireEmailVerification,
+			EmailVerificationExpiry:         emailVerificationExpiry,
+			EmailVerificationResendInterval: emailVerificationResendInterval,
+			MFAIssuer:                       mfaIssuer,
+			MFAChallengeExpiry:              mfaChallengeExpiry,
+			MagicLinkExpiry:                 magicLinkExpiry,
+		},
+		OAuth: OAuthConfig{
+			Issuer:                   oauthIssuer,
+			AccessTokenExpiry:        oauthAccessTokenExpiry,
+			RefreshTokenExpiry:       oauthRefreshTokenExpiry,
+			CodeExpiry:               oauthCodeExpiry,
+			IntrospectionCacheExpiry: oauthIntrospectionCacheExpiry,
+		},
+		Providers: providers,
+		SAML:      samlTenants,
+		SCIM: SCIMConfig{
+			Token: getEnv("SCIM_TOKEN", ""),
+		},
+		LDAP: LDAPConfig{
+			URL:                getEnv("LDAP_URL", ""),
+			StartTLS:           ldapStartTLS,
+			BindDN:             getEnv("LDAP_BIND_DN", ""),
+			BindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:             getEnv("LDAP_BASE_DN", ""),
+			UserFilter:         getEnv("LDAP_USER_FILTER", "(mail=%s)"),
+			IDAttribute:        getEnv("LDAP_ID_ATTRIBUTE", "entryUUID"),
+			EmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			FirstNameAttribute: getEnv("LDAP_FIRST_NAME_ATTRIBUTE", "givenName"),
+			LastNameAttribute:  getEnv("LDAP_LAST_NAME_ATTRIBUTE", "sn"),
+			GroupAttribute:     getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			GroupRoles:         parseGroupRoles(getEnv("LDAP_GROUP_ROLES", "")),
+			LinkByEmail:        ldapLinkByEmail,
+			Timeout:            ldapTimeout,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:    webAuthnRPID,
+			RPName:  getEnv("WEBAUTHN_RP_NAME", mfaIssuer),
+			Origins: strings.Split(getEnv("WEBAUTHN_ORIGINS", strings.TrimSuffix(appURL, "/")), ","),
+			Timeout: webAuthnTimeout,
+		},
+		Password: PasswordConfig{
+			Algorithm:            getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			Argon2Memory:         uint32(argon2Memory),
+			Argon2Iterations:     uint32(argon2Iterations),
+			Argon2Parallelism:    uint8(argon2Parallelism),
+			BcryptCost:           bcryptCost,
+			MinLength:            passwordMinLength,
+			MaxLength:            passwordMaxLength,
+			RequireUppercase:     passwordRequireUppercase,
+			RequireLowercase:     passwordRequireLowercase,
+			RequireDigit:         passwordRequireDigit,
+			RequireSymbol:        passwordRequireSymbol,
+			DisallowPersonalInfo: passwordDisallowPersonalInfo,
+			MinStrength:          passwordMinStrength,
+			BreachedDir:          getEnv("PASSWORD_BREACHED_DIR", ""),
+			HistorySize:          passwordHistorySize,
+			MaxAge:               passwordMaxAge,
+		},
+		Lockout: LockoutConfig{
+			MaxAttempts:      loginMaxAttempts,
+			MaxAttemptsPerIP: loginMaxAttemptsPerIP,
+			Window:           loginAttemptWindow,
+			Duration:         loginLockoutDuration,
+			DelayAfter:       loginDelayAfter,
+			BaseDelay:        loginBaseDelay,
+		},
+		RateLimit: RateLimitConfig{
+			Store:         getEnv("RATE_LIMIT_STORE", "redis"),
+			Global:        *rates["RATE_LIMIT_GLOBAL"],
+			Signup:        *rates["RATE_LIMIT_SIGNUP"],
+			Login:         *rates["RATE_LIMIT_LOGIN"],
+			MagicLink:     *rates["RATE_LIMIT_MAGIC_LINK"],
+			PasswordReset: *rates["RATE_LIMIT_PASSWORD_RESET"],
+			PostCreate:    *rates["RATE_LIMIT_POST_CREATE"],
+		},
+		Cookie: SessionCookieConfig{
+			Enabled:  sessionCookieEnabled,
+			Name:     getEnv("SESSION_COOKIE_NAME", "session"),
+			Domain:   getEnv("SESSION_COOKIE_DOMAIN", ""),
+			Secure:   sessionCookieSecure,
+			SameSite: getEnv("SESSION_COOKIE_SAMESITE", "Lax"),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "no-reply@localhost"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 		},
 	}, nil
 }
 
+// loadIdentityProviders reads the providers named in IDENTITY_PROVIDERS. Each
+// one is configured with IDENTITY_PROVIDER_<NAME>_* variables, e.g.
+// IDENTITY_PROVIDER_GOOGLE_ISSUER for the provider "google".
+func loadIdentityProviders(appURL string) ([]IdentityProviderConfig, error) {
+	var providers []IdentityProviderConfig
+	for _, name := range strings.Split(getEnv("IDENTITY_PROVIDERS", ""), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !validProviderName(name) {
+			return nil, fmt.Errorf("invalid identity provider name %q: use lowercase letters, digits and dashes", name)
+		}
+
+		prefix := "IDENTITY_PROVIDER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := IdentityProviderConfig{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:       strings.TrimSuffix(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", fmt.Sprintf("%s/login/%s/callback", appURL, name)),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("identity provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// loadSAMLTenants reads the tenants named in SAML_TENANTS. Each one is
+// configured with SAML_TENANT_<NAME>_* variables, e.g.
+// SAML_TENANT_ACME_IDP_SSO_URL for the tenant "acme". Their service
+// provider endpoints live under {baseURL}/saml/<name>.
+func loadSAMLTenants(baseURL, appURL string) ([]SAMLTenantConfig, error) {
+	var tenants []SAMLTenantConfig
+	for _, name := range strings.Split(getEnv("SAML_TENANTS", ""), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !validProviderName(name) {
+			return nil, fmt.Errorf("invalid SAML tenant name %q: use lowercase letters, digits and dashes", name)
+		}
+
+		prefix := "SAML_TENANT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		allowIDPInitiated, _ := strconv.ParseBool(getEnv(prefix+"ALLOW_IDP_INITIATED", "false"))
+		linkByEmail, _ := strconv.ParseBool(getEnv(prefix+"LINK_BY_EMAIL", "false"))
+		tenant := SAMLTenantConfig{
+			Name:               name,
+			EntityID:           getEnv(prefix+"ENTITY_ID", fmt.Sprintf("%s/saml/%s/metadata", baseURL, name)),
+			ACSURL:             fmt.Sprintf("%s/saml/%s/acs", baseURL, name),
+			IDPEntityID:        getEnv(prefix+"IDP_ENTITY_ID", ""),
+			IDPSSOURL:          getEnv(prefix+"IDP_SSO_URL", ""),
+			IDPCertificateFile: getEnv(prefix+"IDP_CERTIFICATE", ""),
+			EmailAttribute:     getEnv(prefix+"EMAIL_ATTRIBUTE", "email"),
+			FirstNameAttribute: getEnv(prefix+"FIRST_NAME_ATTRIBUTE", "first_name"),
+			LastNameAttribute:  getEnv(prefix+"LAST_NAME_ATTRIBUTE", "last_name"),
+			AllowIDPInitiated:  allowIDPInitiated,
+			LinkByEmail:        linkByEmail,
+			RedirectURL:        getEnv(prefix+"REDIRECT_URL", fmt.Sprintf("%s/login/saml/callback", appURL)),
+		}
+		if tenant.IDPEntityID == "" || tenant.IDPSSOURL == "" || tenant.IDPCertificateFile == "" {
+			return nil, fmt.Errorf("SAML tenant %q needs %sIDP_ENTITY_ID, %sIDP_SSO_URL and %sIDP_CERTIFICATE", name, prefix, prefix, prefix)
+		}
+
+		tenants = append(tenants, tenant)
+	}
+	return tenants, nil
+}
+
+func validProviderName(name string) bool {
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGroupRoles parses "<group DN>:<role>" pairs separated by semicolons.
+// DNs contain commas, so the role is whatever follows the last colon.
+func parseGroupRoles(value string) map[string]string {
+	groupRoles := map[string]string{}
+	for _, pair := range strings.Split(value, ";") {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			continue
+		}
+		group, role := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if group != "" && role != "" {
+			groupRoles[group] = role
+		}
+	}
+	return groupRoles
+}
+
+// parseRate parses a budget written as "<limit>/<window>", e.g. "100/1m".
+func parseRate(value string) (Rate, error) {
+	limit, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("expected <limit>/<window>, got %q", value)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("invalid limit %q", limit)
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid window %q", window)
+	}
+
+	return Rate{Limit: n, Window: d}, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
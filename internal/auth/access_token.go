@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from session JWTs, and so leaked tokens are easy to scan for.
+const PersonalAccessTokenPrefix = "pat_"
+
+// lastUsedResolution limits how often last_used_at is written for a token
+// that is used on every request.
+const lastUsedResolution = time.Minute
+
+var ErrInvalidPersonalAccessToken = errors.New("invalid or expired personal access token")
+
+// NewPersonalAccessToken generates a token and returns it together with the
+// prefix shown to the user to identify it and the hash to store.
+func NewPersonalAccessToken() (token, prefix, hash string, err error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	token = PersonalAccessTokenPrefix + secret
+	return token, token[:len(PersonalAccessTokenPrefix)+8], HashToken(token), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// AuthenticatePersonalAccessToken looks up an unexpired token and records
+// that it was used.
+func AuthenticatePersonalAccessToken(ctx context.Context, token string) (*models.PersonalAccessToken, error) {
+	pat, err := findPersonalAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = database.DB.WithContext(ctx).Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", pat.ID, now.Add(-lastUsedResolution)).
+		Update("last_used_at", now).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return pat, nil
+}
+
+// findPersonalAccessToken looks up an unexpired token without recording a
+// use.
+func findPersonalAccessToken(ctx context.Context, token string) (*models.PersonalAccessToken, error) {
+	var pat models.PersonalAccessToken
+	err := database.DB.WithContext(ctx).Where("token_hash = ?", HashToken(token)).First(&pat).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidPersonalAccessToken
+		}
+		return nil, err
+	}
+
+	if pat.ExpiresAt != nil && !pat.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+
+	return &pat, nil
+}
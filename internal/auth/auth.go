@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+var (
+	jwtConfig      config.JWTConfig
+	authConfig     config.AuthConfig
+	oauthConfig    config.OAuthConfig
+	lockoutConfig  config.LockoutConfig
+	webAuthnConfig config.WebAuthnConfig
+	keyring        *Keyring
+)
+
+func Init(cfg *config.Config) error {
+	keys, err := LoadKeyring(cfg.JWT)
+	if err != nil {
+		return err
+	}
+
+	jwtConfig = cfg.JWT
+	authConfig = cfg.Auth
+	oauthConfig = cfg.OAuth
+	lockoutConfig = cfg.Lockout
+	webAuthnConfig = cfg.WebAuthn
+	keyring = keys
+	return nil
+}
+
+// SignToken signs the claims with the current signing key.
+func SignToken(claims jwt.Claims) (string, error) {
+	return keyring.Sign(claims)
+}
+
+// JWKS returns the public keys tokens can currently be verified with.
+func JWKS() JWKSet {
+	return keyring.JWKS()
+}
+
+// incrExisting increments a counter in a hash, but only while the hash still
+// exists, and returns -1 otherwise. HINCRBY on its own would recreate a
+// record that expired after it was read, without a TTL.
+var incrExisting = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+return redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+`)
+
+func refreshTokenKey(token string) string {
+	return fmt.Sprintf("refresh_token:%s", HashToken(token))
+}
+
+// IssueTokens starts a new session for the user and returns its first
+// access/refresh token pair. Every refresh token rotated out of this pair
+// belongs to the same family, identified by the session ID.
+func IssueTokens(ctx context.Context, userID uint, meta SessionMetadata) (*models.TokenResponse, error) {
+	sessionID, err := createSession(ctx, userID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return issuePair(ctx, sessionID, userID)
+}
+
+// Refresh exchanges a refresh token for a new pair. A refresh token can be
+// used exactly once; presenting it a second time means it leaked, so the
+// whole family is revoked.
+func Refresh(ctx context.Context, refreshToken string, meta SessionMetadata) (*models.TokenResponse, error) {
+	key := refreshTokenKey(refreshToken)
+	record, err := database.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	sessionID := record["session_id"]
+	userID, err := strconv.ParseUint(record["user_id"], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	uses, err := incrExisting.Run(ctx, database.RedisClient, []string{key}, "uses").Int64()
+	if err != nil {
+		return nil, err
+	}
+	if uses < 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+	if uses > 1 {
+		if err := RevokeSession(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	active, err := SessionActive(ctx, sessionID, uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := TouchSession(ctx, sessionID, meta); err != nil {
+		return nil, err
+	}
+
+	return issuePair(ctx, sessionID, uint(userID))
+}
+
+// RefreshTokenSession returns the ID of the session a refresh token belongs
+// to, without using the token up.
+func RefreshTokenSession(ctx context.Context, refreshToken string) (string, error) {
+	sessionID, err := database.RedisClient.HGet(ctx, refreshTokenKey(refreshToken), "session_id").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrInvalidRefreshToken
+		}
+		return "", err
+	}
+	return sessionID, nil
+}
+
+func issuePair(ctx context.Context, sessionID string, userID uint) (*models.TokenResponse, error) {
+	now := time.Now()
+
+	// Roles are read on every issue so that role changes reach the client
+	// with the next refresh
+	roles, err := UserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := SignToken(jwt.MapClaims{
+		"user_id": userID,
+		"sid":     sessionID,
+		"roles":   roles,
+		"iat":     now.Unix(),
+		"exp":     now.Add(jwtConfig.AccessTokenExpiry).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := refreshTokenKey(refreshToken)
+	pipe := database.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key,
+		"session_id", sessionID,
+		"user_id", userID,
+		"uses", 0,
+	)
+	pipe.Expire(ctx, key, jwtConfig.SessionExpiry)
+	pipe.Expire(ctx, sessionKey(sessionID), jwtConfig.SessionExpiry)
+	pipe.Expire(ctx, userSessionsKey(userID), jwtConfig.SessionExpiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(jwtConfig.AccessTokenExpiry.Seconds()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token.
+// It does not check whether the session behind it is still active. Pass
+// jwt.WithoutClaimsValidation() to accept expired tokens.
+func ParseAccessToken(tokenString string, options ...jwt.ParserOption) (jwt.MapClaims, error) {
+	token, err := keyring.Parse(tokenString, jwt.MapClaims{}, options...)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+// RevokeToken ends the session an access token belongs to. Expired tokens
+// are accepted so that clients can still log out after the access token ran
+// out.
+func RevokeToken(ctx context.Context, tokenString string) error {
+	claims, err := ParseAccessToken(tokenString, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return err
+	}
+
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		return nil
+	}
+
+	return RevokeSession(ctx, sessionID)
+}
+
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const emailVerificationPurpose = "email_verification"
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+type emailVerificationClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// CreateEmailVerificationToken signs a token confirming that the user owns
+// the given address. It is bound to the address so that changing the email
+// invalidates links sent to the old one.
+func CreateEmailVerificationToken(userID uint, email string) (string, error) {
+	now := time.Now()
+	return SignToken(emailVerificationClaims{
+		Email:   email,
+		Purpose: emailVerificationPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(authConfig.EmailVerificationExpiry)),
+		},
+	})
+}
+
+// ParseEmailVerificationToken returns the user and address a verification
+// token was issued for.
+func ParseEmailVerificationToken(tokenString string) (uint, string, error) {
+	var claims emailVerificationClaims
+	token, err := keyring.Parse(tokenString, &claims)
+	if err != nil || !token.Valid || claims.Purpose != emailVerificationPurpose {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	return uint(userID), claims.Email, nil
+}
+
+// ReserveVerificationEmail throttles verification emails to one per resend
+// interval. It returns how long the caller has to wait, or zero if an email
+// may be sent now.
+func ReserveVerificationEmail(ctx context.Context, userID uint) (time.Duration, error) {
+	key := fmt.Sprintf("email_verification_sent:%d", userID)
+	ok, err := database.RedisClient.SetNX(ctx, key, 1, authConfig.EmailVerificationResendInterval).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return 0, nil
+	}
+
+	ttl, err := database.RedisClient.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	return ttl, nil
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// FederatedLoginExpiry is how long the user has to log in at the identity
+// provider, and then to finish signing up.
+const FederatedLoginExpiry = 10 * time.Minute
+
+var (
+	ErrInvalidFederatedLogin  = errors.New("invalid or expired login state")
+	ErrInvalidFederatedSignup = errors.New("invalid or expired signup token")
+)
+
+// FederatedLogin is a login at an external identity provider in progress.
+// LinkUserID is set when a signed-in user is linking the provider to their
+// account rather than logging in.
+type FederatedLogin struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	LinkUserID   uint   `json:"link_user_id,omitempty"`
+}
+
+// CodeChallenge is the PKCE S256 challenge for the login's code verifier.
+func (l *FederatedLogin) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(l.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// FederatedSignup holds what an identity provider said about a user who has
+// no account yet, until they finish signing up.
+type FederatedSignup struct {
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+}
+
+func federatedLoginKey(stateHash string) string {
+	return fmt.Sprintf("federated_login:%s", stateHash)
+}
+
+func federatedSignupKey(tokenHash string) string {
+	return fmt.Sprintf("federated_signup:%s", tokenHash)
+}
+
+// StartFederatedLogin creates the state, nonce and PKCE verifier for a login
+// at the provider and returns the state to send along.
+func StartFederatedLogin(ctx context.Context, provider string, linkUserID uint) (string, *FederatedLogin, error) {
+	state, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	verifier, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := RandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	login := &FederatedLogin{
+		Provider:     provider,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+	}
+	value, err := json.Marshal(login)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := database.RedisClient.Set(ctx, federatedLoginKey(HashToken(state)), value, FederatedLoginExpiry).Err(); err != nil {
+		return "", nil, err
+	}
+
+	return state, login, nil
+}
+
+// ConsumeFederatedLogin redeems the state the provider sent back. Each state
+// can only be used once, and only for the provider it was created for.
+func ConsumeFederatedLogin(ctx context.Context, state, provider string) (*FederatedLogin, error) {
+	key := federatedLoginKey(HashToken(state))
+	value, err := database.RedisClient.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidFederatedLogin
+		}
+		return nil, err
+	}
+
+	deleted, err := database.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidFederatedLogin
+	}
+
+	var login FederatedLogin
+	if err := json.Unmarshal(value, &login); err != nil {
+		return nil, err
+	}
+	if login.Provider != provider {
+		return nil, ErrInvalidFederatedLogin
+	}
+
+	return &login, nil
+}
+
+// CreateFederatedSignup stores the provider's claims and returns a
+// single-use token to finish signing up with.
+func CreateFederatedSignup(ctx context.Context, signup FederatedSignup) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(signup)
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.RedisClient.Set(ctx, federatedSignupKey(HashToken(token)), value, FederatedLoginExpiry).Err(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeFederatedSignup redeems a signup token.
+func ConsumeFederatedSignup(ctx context.Context, token string) (*FederatedSignup, error) {
+	key := federatedSignupKey(HashToken(token))
+	value, err := database.RedisClient.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidFederatedSignup
+		}
+		return nil, err
+	}
+
+	deleted, err := database.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidFederatedSignup
+	}
+
+	var signup FederatedSignup
+	if err := json.Unmarshal(value, &signup); err != nil {
+		return nil, err
+	}
+
+	return &signup, nil
+}
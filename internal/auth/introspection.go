@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of token introspection can describe.
+const (
+	TokenUseAccess  = "access_token"
+	TokenUseRefresh = "refresh_token"
+)
+
+var ErrInactiveToken = errors.New("token is not active")
+
+// TokenInfo describes an active token. UserID is zero for client
+// credentials tokens, ClientID is empty for session and personal access
+// tokens, and Scopes is nil for session tokens, which have full access. A
+// zero ExpiresAt means the token doesn't expire, a zero IssuedAt that the
+// time isn't known.
+type TokenInfo struct {
+	Use       string
+	UserID    uint
+	ClientID  string
+	Scopes    []string
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+func inactiveTokenKey(tokenHash string) string {
+	return fmt.Sprintf("inactive_token:%s", tokenHash)
+}
+
+// markTokenInactive remembers that a token is dead for good.
+func markTokenInactive(ctx context.Context, tokenHash string) error {
+	if oauthConfig.IntrospectionCacheExpiry <= 0 {
+		return nil
+	}
+	return database.RedisClient.Set(ctx, inactiveTokenKey(tokenHash), 1, oauthConfig.IntrospectionCacheExpiry).Err()
+}
+
+// isJWT tells session access tokens apart from the opaque tokens, which
+// never contain dots.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// IntrospectToken describes any token this service issued, as long as it is
+// still active (RFC 7662). It returns ErrInactiveToken otherwise. Tokens
+// that are unknown, expired or revoked stay dead, so that answer is cached;
+// a suspended account can be reinstated, so its tokens are checked afresh
+// every time.
+func IntrospectToken(ctx context.Context, token string) (*TokenInfo, error) {
+	tokenHash := HashToken(token)
+	cached, err := database.RedisClient.Exists(ctx, inactiveTokenKey(tokenHash)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if cached > 0 {
+		return nil, ErrInactiveToken
+	}
+
+	info, err := introspectToken(ctx, token)
+	if errors.Is(err, ErrInactiveToken) {
+		if err := markTokenInactive(ctx, tokenHash); err != nil {
+			return nil, err
+		}
+		return nil, ErrInactiveToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.UserID != 0 {
+		active, err := accountActive(ctx, info.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, ErrInactiveToken
+		}
+	}
+
+	return info, nil
+}
+
+func introspectToken(ctx context.Context, token string) (*TokenInfo, error) {
+	switch {
+	case IsPersonalAccessToken(token):
+		return introspectPersonalAccessToken(ctx, token)
+	case IsOAuthAccessToken(token):
+		return introspectOAuthAccessToken(ctx, token)
+	case strings.HasPrefix(token, OAuthRefreshTokenPrefix):
+		return introspectOAuthRefreshToken(ctx, token)
+	case isJWT(token):
+		return introspectSessionAccessToken(ctx, token)
+	default:
+		return introspectSessionRefreshToken(ctx, token)
+	}
+}
+
+func introspectSessionAccessToken(ctx context.Context, token string) (*TokenInfo, error) {
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return nil, ErrInactiveToken
+	}
+
+	claimedUserID, _ := claims["user_id"].(float64)
+	sessionID, _ := claims["sid"].(string)
+	active, err := SessionActive(ctx, sessionID, uint(claimedUserID))
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrInactiveToken
+	}
+
+	issuedAt, _ := claims["iat"].(float64)
+	expiresAt, _ := claims["exp"].(float64)
+	return &TokenInfo{
+		Use:       TokenUseAccess,
+		UserID:    uint(claimedUserID),
+		SessionID: sessionID,
+		IssuedAt:  time.Unix(int64(issuedAt), 0),
+		ExpiresAt: time.Unix(int64(expiresAt), 0),
+	}, nil
+}
+
+func introspectSessionRefreshToken(ctx context.Context, token string) (*TokenInfo, error) {
+	key := refreshTokenKey(token)
+	record, err := database.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	// A refresh token that was already rotated is spent
+	if len(record) == 0 || record["uses"] != "0" {
+		return nil, ErrInactiveToken
+	}
+
+	userID, err := strconv.ParseUint(record["user_id"], 10, 64)
+	if err != nil {
+		return nil, ErrInactiveToken
+	}
+	active, err := SessionActive(ctx, record["session_id"], uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrInactiveToken
+	}
+
+	expiresAt, err := keyExpiry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenInfo{
+		Use:       TokenUseRefresh,
+		UserID:    uint(userID),
+		SessionID: record["session_id"],
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func introspectPersonalAccessToken(ctx context.Context, token string) (*TokenInfo, error) {
+	pat, err := findPersonalAccessToken(ctx, token)
+	if errors.Is(err, ErrInvalidPersonalAccessToken) {
+		return nil, ErrInactiveToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TokenInfo{
+		Use:      TokenUseAccess,
+		UserID:   pat.UserID,
+		Scopes:   pat.ScopeList(),
+		IssuedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt != nil {
+		info.ExpiresAt = *pat.ExpiresAt
+	}
+	return info, nil
+}
+
+func introspectOAuthAccessToken(ctx context.Context, token string) (*TokenInfo, error) {
+	grant, err := AuthenticateOAuthAccessToken(ctx, token)
+	if errors.Is(err, ErrInvalidOAuthToken) {
+		return nil, ErrInactiveToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := keyExpiry(ctx, oauthAccessTokenKey(HashToken(token)))
+	if err != nil {
+		return nil, err
+	}
+	return &TokenInfo{
+		Use:       TokenUseAccess,
+		UserID:    grant.UserID,
+		ClientID:  grant.ClientID,
+		Scopes:    grant.Scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func introspectOAuthRefreshToken(ctx context.Context, token string) (*TokenInfo, error) {
+	key := oauthRefreshTokenKey(HashToken(token))
+	record, err := database.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 || record["uses"] != "0" {
+		return nil, ErrInactiveToken
+	}
+
+	active, err := database.RedisClient.Exists(ctx, oauthGrantKey(record["grant_id"])).Result()
+	if err != nil {
+		return nil, err
+	}
+	if active == 0 {
+		return nil, ErrInactiveToken
+	}
+	exists, err := oauthClientExists(ctx, record["client_id"])
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrInactiveToken
+	}
+
+	userID, err := strconv.ParseUint(record["user_id"], 10, 64)
+	if err != nil {
+		return nil, ErrInactiveToken
+	}
+	expiresAt, err := keyExpiry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenInfo{
+		Use:       TokenUseRefresh,
+		UserID:    uint(userID),
+		ClientID:  record["client_id"],
+		Scopes:    strings.Fields(record["scope"]),
+		SessionID: record["session_id"],
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// keyExpiry turns the remaining lifetime of a token's key into its expiry.
+func keyExpiry(ctx context.Context, key string) (time.Time, error) {
+	ttl, err := database.RedisClient.PTTL(ctx, key).Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Negative values mean the key has no expiry or is already gone
+	if ttl < 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().Add(ttl), nil
+}
+
+// accountActive reports whether the user still exists and isn't suspended,
+// the same check Protected makes on every request.
+func accountActive(ctx context.Context, userID uint) (bool, error) {
+	var user models.User
+	err := database.DB.WithContext(ctx).Select("id", "suspended_at").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.SuspendedAt == nil, nil
+}
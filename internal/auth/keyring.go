@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go-auth-boilerplate/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// defaultKeyID identifies the shared HS256 secret used when no asymmetric
+// keys are configured.
+const defaultKeyID = "default"
+
+type jwtKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Keyring holds the key used to sign new tokens and every key that is still
+// accepted when verifying them. Rotating means adding a new key, switching
+// the signing key ID to it and removing the old key once the tokens it
+// signed have expired.
+type Keyring struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeyring builds a keyring from every <kid>.pem file in cfg.KeysDir.
+// Private keys can sign and verify, public keys only verify. The signing
+// algorithm is derived from the key type: RS256 for RSA, ES256/ES384/ES512
+// for ECDSA and EdDSA for Ed25519. Without a keys directory the keyring falls
+// back to HS256 with cfg.Secret.
+func LoadKeyring(cfg config.JWTConfig) (*Keyring, error) {
+	if cfg.KeysDir == "" {
+		key := &jwtKey{
+			id:        defaultKeyID,
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(cfg.Secret),
+			verifyKey: []byte(cfg.Secret),
+		}
+		return &Keyring{
+			signing: key,
+			keys:    map[string]*jwtKey{key.id: key},
+		}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.KeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := &Keyring{keys: make(map[string]*jwtKey)}
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load key %s: %v", path, err)
+		}
+		keyring.keys[key.id] = key
+	}
+
+	signing, ok := keyring.keys[cfg.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", cfg.SigningKeyID, cfg.KeysDir)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q is a public key", cfg.SigningKeyID)
+	}
+	keyring.signing = signing
+
+	return keyring, nil
+}
+
+func loadKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.signKey = signer
+		parsed = signer.Public()
+	}
+	key.verifyKey = parsed
+
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			key.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// Sign signs the claims with the current signing key and sets the kid
+// header so verifiers can pick the matching key.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+	return token.SignedString(k.signing.signKey)
+}
+
+// Algorithm returns the algorithm new tokens are signed with.
+func (k *Keyring) Algorithm() string {
+	return k.signing.method.Alg()
+}
+
+// Parse verifies a token against the key named by its kid header. The
+// algorithm is bound to the key, so a token cannot pick a weaker one.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.NewParser(options...).ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return key.verifyKey, nil
+	})
+}
+
+// JWKS returns the public verification keys. Shared HS256 secrets are never
+// published.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{
+			Kid: key.id,
+			Alg: key.method.Alg(),
+			Use: "sig",
+		}
+
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// PublicKey decodes the verification key the JWK describes, the reverse of
+// JWKS. It is used to verify tokens signed by other issuers.
+func (j JWK) PublicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch j.Kty {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+}
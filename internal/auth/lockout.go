@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+)
+
+// LoginThrottle explains why a login attempt was refused and when the client
+// may try again. Locked is set when the account itself is locked, as opposed
+// to the client having to slow down.
+type LoginThrottle struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginFailuresKey(email string) string {
+	return fmt.Sprintf("login_failures:account:%s", normalizeLoginEmail(email))
+}
+
+func loginIPFailuresKey(ip string) string {
+	return fmt.Sprintf("login_failures:ip:%s", ip)
+}
+
+func loginDelayKey(email string) string {
+	return fmt.Sprintf("login_delay:%s", normalizeLoginEmail(email))
+}
+
+func loginLockKey(email string) string {
+	return fmt.Sprintf("login_lock:%s", normalizeLoginEmail(email))
+}
+
+// CheckLoginAllowed returns a throttle if a login for the email from the IP
+// must be refused, or nil if it may go ahead. Accounts are tracked by email
+// so that unknown addresses are throttled exactly like real ones.
+func CheckLoginAllowed(ctx context.Context, email, ip string) (*LoginThrottle, error) {
+	pipe := database.RedisClient.Pipeline()
+	lockTTL := pipe.PTTL(ctx, loginLockKey(email))
+	ipFailures := pipe.Get(ctx, loginIPFailuresKey(ip))
+	ipTTL := pipe.PTTL(ctx, loginIPFailuresKey(ip))
+	delayTTL := pipe.PTTL(ctx, loginDelayKey(email))
+	// Exec reports redis.Nil for the GET when the IP has no failures yet;
+	// real errors are checked on the individual commands below
+	pipe.Exec(ctx)
+
+	if err := lockTTL.Err(); err != nil {
+		return nil, err
+	}
+	if ttl := lockTTL.Val(); ttl > 0 {
+		return &LoginThrottle{Locked: true, RetryAfter: ttl}, nil
+	}
+
+	if n, err := ipFailures.Int(); err == nil && lockoutConfig.MaxAttemptsPerIP > 0 && n >= lockoutConfig.MaxAttemptsPerIP {
+		return &LoginThrottle{RetryAfter: ipTTL.Val()}, nil
+	}
+
+	if ttl := delayTTL.Val(); ttl > 0 {
+		return &LoginThrottle{RetryAfter: ttl}, nil
+	}
+
+	return nil, nil
+}
+
+func incrementWithin(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := database.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := database.RedisClient.Expire(ctx, key, window).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// RecordLoginFailure counts a failed password attempt against the account and
+// the IP. Past DelayAfter failures the account has to wait before the next
+// attempt, twice as long each time, and at MaxAttempts it is locked.
+func RecordLoginFailure(ctx context.Context, email, ip string) error {
+	if _, err := incrementWithin(ctx, loginIPFailuresKey(ip), lockoutConfig.Window); err != nil {
+		return err
+	}
+
+	failures, locked, err := recordAccountFailure(ctx, email)
+	if err != nil || locked {
+		return err
+	}
+
+	if lockoutConfig.DelayAfter > 0 && failures >= int64(lockoutConfig.DelayAfter) {
+		delay := lockoutConfig.Duration
+		if shift := failures - int64(lockoutConfig.DelayAfter); shift < 30 {
+			delay = min(delay, lockoutConfig.BaseDelay<<shift)
+		}
+		return database.RedisClient.Set(ctx, loginDelayKey(email), 1, delay).Err()
+	}
+
+	return nil
+}
+
+// RecordMFAFailure counts a wrong second factor against the account. The
+// password was already correct, so there is no delay, but enough failures
+// still lock the account to stop codes from being guessed.
+func RecordMFAFailure(ctx context.Context, email string) error {
+	_, _, err := recordAccountFailure(ctx, email)
+	return err
+}
+
+func recordAccountFailure(ctx context.Context, email string) (int64, bool, error) {
+	failures, err := incrementWithin(ctx, loginFailuresKey(email), lockoutConfig.Window)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if lockoutConfig.MaxAttempts > 0 && failures >= int64(lockoutConfig.MaxAttempts) {
+		pipe := database.RedisClient.TxPipeline()
+		pipe.Set(ctx, loginLockKey(email), 1, lockoutConfig.Duration)
+		pipe.Del(ctx, loginFailuresKey(email), loginDelayKey(email))
+		_, err := pipe.Exec(ctx)
+		return failures, true, err
+	}
+
+	return failures, false, nil
+}
+
+// ClearLoginFailures forgets failed attempts against the account after a
+// successful login. Failures from the IP keep counting.
+func ClearLoginFailures(ctx context.Context, email string) error {
+	return database.RedisClient.Del(ctx, loginFailuresKey(email), loginDelayKey(email)).Err()
+}
+
+// UnlockLogin lifts a lockout early, for example after an admin steps in or
+// the user resets their password.
+func UnlockLogin(ctx context.Context, email string) error {
+	return database.RedisClient.Del(ctx, loginFailuresKey(email), loginDelayKey(email), loginLockKey(email)).Err()
+}
+
+// LoginLockedFor returns how much longer the account stays locked, or zero.
+func LoginLockedFor(ctx context.Context, email string) (time.Duration, error) {
+	ttl, err := database.RedisClient.PTTL(ctx, loginLockKey(email)).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+func magicLinkKey(tokenHash string) string {
+	return fmt.Sprintf("magic_link:%s", tokenHash)
+}
+
+// CreateMagicLink issues a single-use login token for the user, bound to the
+// nonce held by the browser that asked for it. Only hashes of the token and
+// the nonce are stored.
+func CreateMagicLink(ctx context.Context, userID uint, nonce string) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	value := fmt.Sprintf("%d:%s", userID, HashToken(nonce))
+	if err := database.RedisClient.Set(ctx, magicLinkKey(HashToken(token)), value, authConfig.MagicLinkExpiry).Err(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumeMagicLink redeems a login token and returns the user it was issued
+// for. The nonce must match the one the link was issued with; a mismatch
+// leaves the link usable, so a mail scanner following it can't burn it.
+func ConsumeMagicLink(ctx context.Context, token, nonce string) (uint, error) {
+	key := magicLinkKey(HashToken(token))
+	val, err := database.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrInvalidMagicLink
+		}
+		return 0, err
+	}
+
+	id, nonceHash, _ := strings.Cut(val, ":")
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMagicLink
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(HashToken(nonce)), []byte(nonceHash)) != 1 {
+		return 0, ErrInvalidMagicLink
+	}
+
+	// Only the request that actually deletes the key gets to log in
+	deleted, err := database.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if deleted == 0 {
+		return 0, ErrInvalidMagicLink
+	}
+
+	return uint(userID), nil
+}
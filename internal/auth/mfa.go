@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/totp"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// maxMFAAttempts is how many codes can be tried against one challenge
+	// before the user has to log in with their password again.
+	maxMFAAttempts = 5
+
+	totpEnrollmentExpiry = 10 * time.Minute
+	// 32 characters, so every random byte maps onto it without bias. Letters
+	// that are easily confused with digits are left out.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+)
+
+var ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+
+func mfaChallengeKey(tokenHash string) string {
+	return fmt.Sprintf("mfa_challenge:%s", tokenHash)
+}
+
+func totpPendingKey(userID uint) string {
+	return fmt.Sprintf("totp_pending:%d", userID)
+}
+
+// MFAChallenge is a login whose first factor was accepted and which waits for
+// the second. LocalPassword is set when the first factor was the password
+// stored in the users table, so the login is still subject to its maximum
+// age; directory passwords, identity providers and magic links are not.
+type MFAChallenge struct {
+	UserID        uint
+	LocalPassword bool
+}
+
+// CreateMFAChallenge issues the short-lived token returned by login when the
+// first factor was correct but a second factor is still required.
+func CreateMFAChallenge(ctx context.Context, challenge MFAChallenge) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	key := mfaChallengeKey(HashToken(token))
+	pipe := database.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key,
+		"user_id", challenge.UserID,
+		"local_password", challenge.LocalPassword,
+		"attempts", 0,
+	)
+	pipe.Expire(ctx, key, authConfig.MFAChallengeExpiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// AttemptMFAChallenge returns the challenge behind a token and counts the
+// attempt against it. The challenge is dropped once it runs out of attempts.
+func AttemptMFAChallenge(ctx context.Context, token string) (*MFAChallenge, error) {
+	key := mfaChallengeKey(HashToken(token))
+	record, err := database.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	attempts, err := incrExisting.Run(ctx, database.RedisClient, []string{key}, "attempts").Int64()
+	if err != nil {
+		return nil, err
+	}
+	if attempts < 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if attempts > maxMFAAttempts {
+		database.RedisClient.Del(ctx, key)
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	userID, err := strconv.ParseUint(record["user_id"], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	localPassword, _ := strconv.ParseBool(record["local_password"])
+
+	return &MFAChallenge{UserID: uint(userID), LocalPassword: localPassword}, nil
+}
+
+// MFAChallengeOwner returns the user a challenge was issued for without
+// counting an attempt. It is used to prepare a passkey prompt, which isn't a
+// guess at anything.
+func MFAChallengeOwner(ctx context.Context, token string) (uint, error) {
+	userIDVal, err := database.RedisClient.HGet(ctx, mfaChallengeKey(HashToken(token)), "user_id").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrInvalidMFAChallenge
+		}
+		return 0, err
+	}
+
+	userID, err := strconv.ParseUint(userIDVal, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	return uint(userID), nil
+}
+
+// CompleteMFAChallenge invalidates a challenge after a successful second
+// factor. It fails if the challenge was already used, so a token can only
+// ever be exchanged for one session.
+func CompleteMFAChallenge(ctx context.Context, token string) error {
+	deleted, err := database.RedisClient.Del(ctx, mfaChallengeKey(HashToken(token))).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrInvalidMFAChallenge
+	}
+	return nil
+}
+
+// SetPendingTOTPSecret stores a secret generated during enrollment until the
+// user proves their authenticator works by confirming a code.
+func SetPendingTOTPSecret(ctx context.Context, userID uint, secret string) error {
+	return database.RedisClient.Set(ctx, totpPendingKey(userID), secret, totpEnrollmentExpiry).Err()
+}
+
+// PendingTOTPSecret returns the secret from an unfinished enrollment, or an
+// empty string if there is none.
+func PendingTOTPSecret(ctx context.Context, userID uint) (string, error) {
+	secret, err := database.RedisClient.Get(ctx, totpPendingKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return secret, err
+}
+
+func ClearPendingTOTPSecret(ctx context.Context, userID uint) error {
+	return database.RedisClient.Del(ctx, totpPendingKey(userID)).Err()
+}
+
+// MarkTOTPStepUsed records that a code for the given time step was accepted.
+// It returns false if the step was already used, which stops a code that was
+// observed by an attacker from being replayed within its validity window.
+func MarkTOTPStepUsed(ctx context.Context, userID uint, step uint64) (bool, error) {
+	key := fmt.Sprintf("totp_used:%d:%d", userID, step)
+	// Steps are accepted up to one period either side of now
+	return database.RedisClient.SetNX(ctx, key, 1, 3*totp.Period).Result()
+}
+
+// GenerateRecoveryCodes returns n random codes formatted as "xxxx-xxxx".
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	buf := make([]byte, 8)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		for j, b := range buf {
+			buf[j] = recoveryCodeAlphabet[b&31]
+		}
+		codes[i] = string(buf[:4]) + "-" + string(buf[4:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode normalises a recovery code as typed by the user and hashes
+// it for storage or lookup.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashToken(code)
+}
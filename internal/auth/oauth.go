@@ -0,0 +1,533 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// Prefixes of the opaque tokens handed out to OAuth clients. Like personal
+// access tokens they are only stored hashed.
+const (
+	OAuthAccessTokenPrefix  = "oat_"
+	OAuthRefreshTokenPrefix = "ort_"
+)
+
+// authorizationRequestExpiry is how long the user has to answer the consent
+// screen.
+const authorizationRequestExpiry = 10 * time.Minute
+
+var (
+	ErrInvalidOAuthClient          = errors.New("invalid client credentials")
+	ErrInvalidAuthorizationRequest = errors.New("invalid or expired authorization request")
+	ErrInvalidGrant                = errors.New("invalid or expired authorization grant")
+	ErrInvalidScope                = errors.New("requested scope exceeds the granted scope")
+	ErrInvalidOAuthToken           = errors.New("invalid or expired OAuth access token")
+)
+
+func oauthRequestKey(id string) string {
+	return fmt.Sprintf("oauth_request:%s", id)
+}
+
+func oauthCodeKey(codeHash string) string {
+	return fmt.Sprintf("oauth_code:%s", codeHash)
+}
+
+func oauthGrantKey(grantID string) string {
+	return fmt.Sprintf("oauth_grant:%s", grantID)
+}
+
+func oauthAccessTokenKey(tokenHash string) string {
+	return fmt.Sprintf("oauth_access_token:%s", tokenHash)
+}
+
+func oauthRefreshTokenKey(tokenHash string) string {
+	return fmt.Sprintf("oauth_refresh_token:%s", tokenHash)
+}
+
+// AuthorizationRequest is a validated request from /oauth/authorize. It
+// waits for the user's consent and, once approved, is carried by the
+// authorization code together with the user who approved it and the session
+// they approved it from. RedirectURIProvided records whether the client sent
+// redirect_uri or it was filled in from the client's only registered one.
+type AuthorizationRequest struct {
+	ClientID            string   `json:"client_id"`
+	RedirectURI         string   `json:"redirect_uri"`
+	RedirectURIProvided bool     `json:"redirect_uri_provided,omitempty"`
+	Scopes              []string `json:"scopes"`
+	State               string   `json:"state"`
+	Nonce               string   `json:"nonce,omitempty"`
+	CodeChallenge       string   `json:"code_challenge"`
+	UserID              uint     `json:"user_id,omitempty"`
+	SessionID           string   `json:"session_id,omitempty"`
+}
+
+// OAuthGrant is what an OAuth token was issued for. Tokens refreshed from one
+// another share the grant ID, and revoking the grant revokes all of them.
+// UserID is zero for client credentials tokens, which act as the client
+// itself. SessionID and Nonce end up in the ID token when the openid scope
+// was granted.
+type OAuthGrant struct {
+	ID        string
+	UserID    uint
+	ClientID  string
+	Scopes    []string
+	SessionID string
+	Nonce     string
+}
+
+// NewOAuthClientCredentials generates a client ID and a client secret.
+func NewOAuthClientCredentials() (clientID, secret string, err error) {
+	clientID, err = RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err = RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return clientID, secret, nil
+}
+
+// AuthenticateOAuthClient looks up a client and checks its secret. Public
+// clients have no secret and are identified by their client ID alone.
+func AuthenticateOAuthClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := database.DB.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOAuthClient
+		}
+		return nil, err
+	}
+
+	if client.Public {
+		return &client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidOAuthClient
+	}
+
+	return &client, nil
+}
+
+// CreateAuthorizationRequest stores a request until the user approves or
+// denies it, and returns the ID the consent screen refers to it by.
+func CreateAuthorizationRequest(ctx context.Context, request AuthorizationRequest) (string, error) {
+	id, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.RedisClient.Set(ctx, oauthRequestKey(id), value, authorizationRequestExpiry).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// PendingAuthorizationRequest returns a request that is waiting for consent.
+func PendingAuthorizationRequest(ctx context.Context, id string) (*AuthorizationRequest, error) {
+	val, err := database.RedisClient.Get(ctx, oauthRequestKey(id)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidAuthorizationRequest
+		}
+		return nil, err
+	}
+
+	var request AuthorizationRequest
+	if err := json.Unmarshal([]byte(val), &request); err != nil {
+		return nil, ErrInvalidAuthorizationRequest
+	}
+
+	return &request, nil
+}
+
+// ConsumeAuthorizationRequest removes a pending request once the user has
+// answered it, so that it can only be answered once.
+func ConsumeAuthorizationRequest(ctx context.Context, id string) (*AuthorizationRequest, error) {
+	request, err := PendingAuthorizationRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := database.RedisClient.Del(ctx, oauthRequestKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidAuthorizationRequest
+	}
+
+	return request, nil
+}
+
+// CreateAuthorizationCode issues a short-lived, single-use code for a request
+// the user approved from the given session.
+func CreateAuthorizationCode(ctx context.Context, request AuthorizationRequest, userID uint, sessionID string) (string, error) {
+	code, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	request.UserID = userID
+	request.SessionID = sessionID
+	value, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.RedisClient.Set(ctx, oauthCodeKey(HashToken(code)), value, oauthConfig.CodeExpiry).Err(); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems a code for the client it was issued to.
+// The redirect URI must match the one the code was requested with; it may
+// only be left out if the authorization request left it out too (RFC 6749
+// section 4.1.3). The verifier must match the PKCE challenge if one was sent.
+func ExchangeAuthorizationCode(ctx context.Context, code string, client *models.OAuthClient, redirectURI, verifier string) (*AuthorizationRequest, error) {
+	key := oauthCodeKey(HashToken(code))
+	val, err := database.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, err
+	}
+
+	// The first attempt to redeem a code burns it, whether it succeeds or not
+	deleted, err := database.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidGrant
+	}
+
+	var request AuthorizationRequest
+	if err := json.Unmarshal([]byte(val), &request); err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	if request.ClientID != client.ClientID {
+		return nil, ErrInvalidGrant
+	}
+	if redirectURI != request.RedirectURI && (request.RedirectURIProvided || redirectURI != "") {
+		return nil, ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(request.CodeChallenge, verifier) {
+		return nil, ErrInvalidGrant
+	}
+
+	return &request, nil
+}
+
+// verifyCodeChallenge checks a PKCE verifier against an S256 challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if challenge == "" {
+		return verifier == ""
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// IssueOAuthTokens issues an access token for the grant, a refresh token if
+// withRefresh is set, and an ID token if the user granted the openid scope.
+// A grant without an ID gets a new one when a refresh token is issued for it.
+func IssueOAuthTokens(ctx context.Context, grant OAuthGrant, withRefresh bool) (*models.OAuthTokenResponse, error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	accessToken := OAuthAccessTokenPrefix + secret
+	scope := strings.Join(grant.Scopes, " ")
+
+	response := &models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(oauthConfig.AccessTokenExpiry.Seconds()),
+		Scope:       scope,
+	}
+
+	if grant.UserID != 0 && slices.Contains(grant.Scopes, models.ScopeOpenID) {
+		if response.IDToken, err = issueIDToken(ctx, grant); err != nil {
+			return nil, err
+		}
+	}
+
+	pipe := database.RedisClient.TxPipeline()
+	if withRefresh {
+		if grant.ID == "" {
+			if grant.ID, err = RandomToken(16); err != nil {
+				return nil, err
+			}
+		}
+
+		secret, err := RandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		response.RefreshToken = OAuthRefreshTokenPrefix + secret
+
+		grantKey := oauthGrantKey(grant.ID)
+		pipe.HSet(ctx, grantKey,
+			"user_id", grant.UserID,
+			"client_id", grant.ClientID,
+		)
+		pipe.Expire(ctx, grantKey, oauthConfig.RefreshTokenExpiry)
+
+		refreshKey := oauthRefreshTokenKey(HashToken(response.RefreshToken))
+		pipe.HSet(ctx, refreshKey,
+			"grant_id", grant.ID,
+			"user_id", grant.UserID,
+			"client_id", grant.ClientID,
+			"scope", scope,
+			"session_id", grant.SessionID,
+			"uses", 0,
+		)
+		pipe.Expire(ctx, refreshKey, oauthConfig.RefreshTokenExpiry)
+	}
+
+	accessKey := oauthAccessTokenKey(HashToken(accessToken))
+	pipe.HSet(ctx, accessKey,
+		"grant_id", grant.ID,
+		"user_id", grant.UserID,
+		"client_id", grant.ClientID,
+		"scope", scope,
+	)
+	pipe.Expire(ctx, accessKey, oauthConfig.AccessTokenExpiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// RefreshOAuthTokens exchanges a refresh token for a new pair within the same
+// grant, optionally narrowing its scopes. As with session refresh tokens,
+// presenting one a second time revokes the whole grant.
+func RefreshOAuthTokens(ctx context.Context, refreshToken string, client *models.OAuthClient, scopes []string) (*models.OAuthTokenResponse, error) {
+	key := oauthRefreshTokenKey(HashToken(refreshToken))
+	record, err := database.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 || record["client_id"] != client.ClientID {
+		return nil, ErrInvalidGrant
+	}
+
+	granted := strings.Fields(record["scope"])
+	if len(scopes) == 0 {
+		scopes = granted
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	userID, err := strconv.ParseUint(record["user_id"], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	grantID := record["grant_id"]
+	uses, err := incrExisting.Run(ctx, database.RedisClient, []string{key}, "uses").Int64()
+	if err != nil {
+		return nil, err
+	}
+	if uses < 0 {
+		return nil, ErrInvalidGrant
+	}
+	if uses > 1 {
+		if err := revokeOAuthGrant(ctx, grantID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	active, err := database.RedisClient.Exists(ctx, oauthGrantKey(grantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if active == 0 {
+		return nil, ErrInvalidGrant
+	}
+
+	// A suspended or deleted account's clients can't keep getting tokens
+	accountOK, err := accountActive(ctx, uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if !accountOK {
+		return nil, ErrInvalidGrant
+	}
+
+	return IssueOAuthTokens(ctx, OAuthGrant{
+		ID:        grantID,
+		UserID:    uint(userID),
+		ClientID:  client.ClientID,
+		Scopes:    scopes,
+		SessionID: record["session_id"],
+	}, true)
+}
+
+func IsOAuthAccessToken(token string) bool {
+	return strings.HasPrefix(token, OAuthAccessTokenPrefix)
+}
+
+// AuthenticateOAuthAccessToken returns the grant behind an access token. The
+// token stops working as soon as its grant is revoked or its client is
+// removed.
+func AuthenticateOAuthAccessToken(ctx context.Context, token string) (*OAuthGrant, error) {
+	record, err := database.RedisClient.HGetAll(ctx, oauthAccessTokenKey(HashToken(token))).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 {
+		return nil, ErrInvalidOAuthToken
+	}
+
+	if grantID := record["grant_id"]; grantID != "" {
+		active, err := database.RedisClient.Exists(ctx, oauthGrantKey(grantID)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if active == 0 {
+			return nil, ErrInvalidOAuthToken
+		}
+	}
+
+	exists, err := oauthClientExists(ctx, record["client_id"])
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrInvalidOAuthToken
+	}
+
+	userID, err := strconv.ParseUint(record["user_id"], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidOAuthToken
+	}
+
+	return &OAuthGrant{
+		ID:       record["grant_id"],
+		UserID:   uint(userID),
+		ClientID: record["client_id"],
+		Scopes:   strings.Fields(record["scope"]),
+	}, nil
+}
+
+// RevokeOAuthToken revokes a token presented at the revocation endpoint.
+// OAuth tokens are only revoked for the client they were issued to, and
+// revoking a refresh token revokes its whole grant, including the access
+// tokens issued with it. Session tokens belong to no client; whoever holds
+// one may end its session, as logging out would. Unknown tokens and tokens
+// of other clients are ignored.
+func RevokeOAuthToken(ctx context.Context, token string, client *models.OAuthClient) error {
+	revoked, err := revokeToken(ctx, token, client)
+	if err != nil || !revoked {
+		return err
+	}
+
+	// Introspection can answer for the token without looking it up again
+	return markTokenInactive(ctx, HashToken(token))
+}
+
+func revokeToken(ctx context.Context, token string, client *models.OAuthClient) (bool, error) {
+	switch {
+	case strings.HasPrefix(token, OAuthRefreshTokenPrefix):
+		key := oauthRefreshTokenKey(HashToken(token))
+		record, err := database.RedisClient.HGetAll(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+		if record["client_id"] != client.ClientID {
+			return false, nil
+		}
+		if err := revokeOAuthGrant(ctx, record["grant_id"]); err != nil {
+			return false, err
+		}
+		return true, database.RedisClient.Del(ctx, key).Err()
+	case IsOAuthAccessToken(token):
+		key := oauthAccessTokenKey(HashToken(token))
+		clientID, err := database.RedisClient.HGet(ctx, key, "client_id").Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return false, nil
+			}
+			return false, err
+		}
+		if clientID != client.ClientID {
+			return false, nil
+		}
+		return true, database.RedisClient.Del(ctx, key).Err()
+	case IsPersonalAccessToken(token):
+		// Personal access tokens are managed by their owner
+		return false, nil
+	case isJWT(token):
+		claims, err := ParseAccessToken(token, jwt.WithoutClaimsValidation())
+		if err != nil {
+			return false, nil
+		}
+		sessionID, _ := claims["sid"].(string)
+		if sessionID == "" {
+			return false, nil
+		}
+		return true, RevokeSession(ctx, sessionID)
+	default:
+		sessionID, err := database.RedisClient.HGet(ctx, refreshTokenKey(token), "session_id").Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, RevokeSession(ctx, sessionID)
+	}
+}
+
+// oauthClientExists reports whether the client is still registered. Tokens
+// of removed clients stop working.
+func oauthClientExists(ctx context.Context, clientID string) (bool, error) {
+	var clients int64
+	err := database.DB.WithContext(ctx).Model(&models.OAuthClient{}).
+		Where("client_id = ?", clientID).Count(&clients).Error
+	return clients > 0, err
+}
+
+func revokeOAuthGrant(ctx context.Context, grantID string) error {
+	if grantID == "" {
+		return nil
+	}
+	return database.RedisClient.Del(ctx, oauthGrantKey(grantID)).Err()
+}
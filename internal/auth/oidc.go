@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// IDTokenHint is what an ID token presented at logout tells about the
+// session to end.
+type IDTokenHint struct {
+	UserID    uint
+	ClientID  string
+	SessionID string
+}
+
+// SigningAlgorithm returns the algorithm ID tokens are signed with. Relying
+// parties can only verify them when it is asymmetric.
+func SigningAlgorithm() string {
+	return keyring.Algorithm()
+}
+
+// issueIDToken signs an OpenID Connect ID token for the grant's user with the
+// claims its scopes allow. sid names the session the user approved the
+// client from, so that the client can end it at logout.
+func issueIDToken(ctx context.Context, grant OAuthGrant) (string, error) {
+	var user models.User
+	if err := database.DB.WithContext(ctx).First(&user, grant.UserID).Error; err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(user.OpenIDClaims(grant.Scopes))
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims["iss"] = oauthConfig.Issuer
+	claims["aud"] = grant.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(oauthConfig.AccessTokenExpiry).Unix()
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+	if grant.SessionID != "" {
+		claims["sid"] = grant.SessionID
+	}
+
+	return SignToken(claims)
+}
+
+// ParseIDTokenHint verifies an ID token issued by this service. Expired
+// tokens are accepted because clients usually log out long after the ID
+// token ran out.
+func ParseIDTokenHint(tokenString string) (*IDTokenHint, error) {
+	claims, err := ParseAccessToken(tokenString, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if issuer, _ := claims["iss"].(string); issuer != oauthConfig.Issuer {
+		return nil, ErrInvalidIDToken
+	}
+
+	subject, _ := claims["sub"].(string)
+	userID, err := strconv.ParseUint(subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	clientID, _ := claims["aud"].(string)
+	sessionID, _ := claims["sid"].(string)
+
+	return &IDTokenHint{
+		UserID:    uint(userID),
+		ClientID:  clientID,
+		SessionID: sessionID,
+	}, nil
+}
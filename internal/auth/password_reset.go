@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+func passwordResetKey(tokenHash string) string {
+	return fmt.Sprintf("password_reset:%s", tokenHash)
+}
+
+func userPasswordResetKey(userID uint) string {
+	return fmt.Sprintf("user_password_reset:%d", userID)
+}
+
+// CreatePasswordResetToken issues a single-use reset token for the user. Only
+// the hash is stored, and issuing a new token invalidates the previous one.
+func CreatePasswordResetToken(ctx context.Context, userID uint) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	tokenHash := HashToken(token)
+	err = database.RedisClient.Set(ctx, passwordResetKey(tokenHash), userID, authConfig.PasswordResetExpiry).Err()
+	if err != nil {
+		return "", err
+	}
+
+	previous, err := database.RedisClient.GetSet(ctx, userPasswordResetKey(userID), tokenHash).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+
+	pipe := database.RedisClient.TxPipeline()
+	pipe.Expire(ctx, userPasswordResetKey(userID), authConfig.PasswordResetExpiry)
+	if previous != "" {
+		pipe.Del(ctx, passwordResetKey(previous))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// PasswordResetTokenUser returns the user a reset token was issued for
+// without redeeming it.
+func PasswordResetTokenUser(ctx context.Context, token string) (uint, error) {
+	val, err := database.RedisClient.Get(ctx, passwordResetKey(HashToken(token))).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+
+	userID, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidResetToken
+	}
+	return uint(userID), nil
+}
+
+// ConsumePasswordResetToken redeems a reset token and returns the user it was
+// issued for. A token can only be redeemed once.
+func ConsumePasswordResetToken(ctx context.Context, token string) (uint, error) {
+	val, err := database.RedisClient.GetDel(ctx, passwordResetKey(HashToken(token))).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+
+	userID, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidResetToken
+	}
+
+	database.RedisClient.Del(ctx, userPasswordResetKey(uint(userID)))
+	return uint(userID), nil
+}
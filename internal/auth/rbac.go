@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+)
+
+// UserRoles returns the names of the roles assigned to the user.
+func UserRoles(userID uint) ([]string, error) {
+	roles := []string{}
+	err := database.DB.Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &roles).Error
+	return roles, err
+}
+
+// RolesHavePermission reports whether any of the roles grants the permission.
+// Permissions are resolved on every call rather than embedded in the token, so
+// changing what a role can do takes effect immediately.
+func RolesHavePermission(roles []string, permission string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	var count int64
+	err := database.DB.Table("role_permissions").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("roles.name IN ? AND permissions.name = ?", roles, permission).
+		Count(&count).Error
+	return count > 0, err
+}
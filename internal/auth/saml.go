@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// SAMLRequestExpiry is how long the user has to log in at the IdP after
+	// an SP-initiated login was started.
+	SAMLRequestExpiry = 10 * time.Minute
+	// samlLoginCodeExpiry is how long the frontend has to exchange the code
+	// the ACS redirected the browser with.
+	samlLoginCodeExpiry = time.Minute
+)
+
+var (
+	ErrInvalidSAMLRequest   = errors.New("SAML response answers no pending request")
+	ErrSAMLAssertionReplay  = errors.New("SAML assertion was already used")
+	ErrInvalidSAMLLoginCode = errors.New("invalid or expired login code")
+)
+
+func samlRequestKey(tenant, id string) string {
+	return fmt.Sprintf("saml_request:%s:%s", tenant, id)
+}
+
+func samlLoginCodeKey(codeHash string) string {
+	return fmt.Sprintf("saml_login:%s", codeHash)
+}
+
+// StoreSAMLRequest remembers an AuthnRequest sent to a tenant's IdP, so only
+// responses to requests of ours are accepted.
+func StoreSAMLRequest(ctx context.Context, tenant, id string) error {
+	return database.RedisClient.Set(ctx, samlRequestKey(tenant, id), 1, SAMLRequestExpiry).Err()
+}
+
+// ConsumeSAMLRequest redeems the request a response answers. Each request
+// can only be answered once.
+func ConsumeSAMLRequest(ctx context.Context, tenant, id string) error {
+	deleted, err := database.RedisClient.Del(ctx, samlRequestKey(tenant, id)).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrInvalidSAMLRequest
+	}
+	return nil
+}
+
+// MarkSAMLAssertionUsed records an accepted assertion until it expires, so
+// a response captured on its way to the ACS can't be posted again.
+func MarkSAMLAssertionUsed(ctx context.Context, tenant, id string, notOnOrAfter time.Time) error {
+	key := fmt.Sprintf("saml_assertion:%s:%s", tenant, HashToken(id))
+	ok, err := database.RedisClient.SetNX(ctx, key, 1, time.Until(notOnOrAfter)+time.Minute).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSAMLAssertionReplay
+	}
+	return nil
+}
+
+// CreateSAMLLoginCode issues the single-use code the ACS hands the frontend
+// in place of a session, which would otherwise end up in a URL.
+func CreateSAMLLoginCode(ctx context.Context, userID uint) (string, error) {
+	code, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.RedisClient.Set(ctx, samlLoginCodeKey(HashToken(code)), userID, samlLoginCodeExpiry).Err(); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ConsumeSAMLLoginCode redeems a login code and returns the user it was
+// issued for.
+func ConsumeSAMLLoginCode(ctx context.Context, code string) (uint, error) {
+	key := samlLoginCodeKey(HashToken(code))
+	value, err := database.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrInvalidSAMLLoginCode
+		}
+		return 0, err
+	}
+
+	deleted, err := database.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if deleted == 0 {
+		return 0, ErrInvalidSAMLLoginCode
+	}
+
+	userID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSAMLLoginCode
+	}
+
+	return uint(userID), nil
+}
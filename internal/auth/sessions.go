@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionMetadata describes the client a session was created from.
+type SessionMetadata struct {
+	IP        string
+	UserAgent string
+	Device    string
+}
+
+// touchSession updates fields of a session that still exists. A plain HSET
+// would recreate a session that expired in the meantime, without a TTL.
+var touchSession = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+func userSessionsKey(userID uint) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+func createSession(ctx context.Context, userID uint, meta SessionMetadata) (string, error) {
+	sessionID, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	csrfToken, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	pipe := database.RedisClient.TxPipeline()
+	pipe.HSet(ctx, sessionKey(sessionID),
+		"user_id", userID,
+		"created_at", now,
+		"last_seen_at", now,
+		"ip", meta.IP,
+		"user_agent", meta.UserAgent,
+		"device", meta.Device,
+		"csrf_token", csrfToken,
+	)
+	pipe.SAdd(ctx, userSessionsKey(userID), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	return sessionID, nil
+}
+
+// SessionActive reports whether the session exists and belongs to the user.
+func SessionActive(ctx context.Context, sessionID string, userID uint) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+
+	val, err := database.RedisClient.HGet(ctx, sessionKey(sessionID), "user_id").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return val == strconv.FormatUint(uint64(userID), 10), nil
+}
+
+// SessionCSRFToken returns the token that cookie-authenticated requests in
+// the session must send with every state-changing request. It lives as long
+// as the session, so refreshing the access token doesn't change it.
+func SessionCSRFToken(ctx context.Context, sessionID string) (string, error) {
+	token, err := database.RedisClient.HGet(ctx, sessionKey(sessionID), "csrf_token").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrSessionNotFound
+		}
+		return "", err
+	}
+	return token, nil
+}
+
+// TouchSession records that the session was just used by the given client.
+// Sessions that no longer exist are left alone.
+func TouchSession(ctx context.Context, sessionID string, meta SessionMetadata) error {
+	values := []interface{}{"last_seen_at", time.Now().Unix()}
+	if meta.IP != "" {
+		values = append(values, "ip", meta.IP)
+	}
+	if meta.UserAgent != "" {
+		values = append(values, "user_agent", meta.UserAgent)
+	}
+
+	return touchSession.Run(ctx, database.RedisClient, []string{sessionKey(sessionID)}, values...).Err()
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+// Index entries whose session already expired are pruned along the way.
+func ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	sessionIDs, err := database.RedisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		record, err := database.RedisClient.HGetAll(ctx, sessionKey(sessionID)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 {
+			database.RedisClient.SRem(ctx, userSessionsKey(userID), sessionID)
+			continue
+		}
+
+		createdAt, _ := strconv.ParseInt(record["created_at"], 10, 64)
+		lastSeenAt, _ := strconv.ParseInt(record["last_seen_at"], 10, 64)
+		sessions = append(sessions, models.Session{
+			ID:         sessionID,
+			CreatedAt:  time.Unix(createdAt, 0).UTC(),
+			LastSeenAt: time.Unix(lastSeenAt, 0).UTC(),
+			IP:         record["ip"],
+			UserAgent:  record["user_agent"],
+			Device:     record["device"],
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session, invalidating every access and refresh token
+// in its family.
+func RevokeSession(ctx context.Context, sessionID string) error {
+	val, err := database.RedisClient.HGet(ctx, sessionKey(sessionID), "user_id").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}
+
+	userID, _ := strconv.ParseUint(val, 10, 64)
+	pipe := database.RedisClient.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.SRem(ctx, userSessionsKey(uint(userID)), sessionID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUserSession ends one of the user's sessions. It returns
+// ErrSessionNotFound if the session does not exist or belongs to someone else.
+func RevokeUserSession(ctx context.Context, userID uint, sessionID string) error {
+	active, err := SessionActive(ctx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrSessionNotFound
+	}
+
+	return RevokeSession(ctx, sessionID)
+}
+
+// RevokeUserSessions ends all of the user's sessions except exceptSessionID,
+// which may be empty to log the user out everywhere.
+func RevokeUserSessions(ctx context.Context, userID uint, exceptSessionID string) error {
+	sessionIDs, err := database.RedisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := database.RedisClient.TxPipeline()
+	for _, sessionID := range sessionIDs {
+		if sessionID == exceptSessionID {
+			continue
+		}
+		pipe.Del(ctx, sessionKey(sessionID))
+		pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
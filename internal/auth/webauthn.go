@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// What a WebAuthn challenge was issued for. A challenge only answers the
+// ceremony it was created for, so e.g. a registration prompt can't be turned
+// into a login.
+const (
+	WebAuthnRegistration     = "registration"
+	WebAuthnLogin            = "login"
+	WebAuthnMFA              = "mfa"
+	WebAuthnReauthentication = "reauthentication"
+)
+
+var ErrInvalidWebAuthnChallenge = errors.New("invalid or expired WebAuthn challenge")
+
+// WebAuthnCeremony is a registration or login prompt in progress. UserID is
+// zero for passkey logins, where the user is only known once the
+// authenticator answers.
+type WebAuthnCeremony struct {
+	Purpose string `json:"purpose"`
+	UserID  uint   `json:"user_id,omitempty"`
+}
+
+func webAuthnChallengeKey(challengeHash string) string {
+	return fmt.Sprintf("webauthn_challenge:%s", challengeHash)
+}
+
+// CreateWebAuthnChallenge returns a new challenge for the browser to have
+// signed, in the base64url form it comes back in client data.
+func CreateWebAuthnChallenge(ctx context.Context, purpose string, userID uint) (string, error) {
+	challenge, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(WebAuthnCeremony{Purpose: purpose, UserID: userID})
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.RedisClient.Set(ctx, webAuthnChallengeKey(HashToken(challenge)), value, webAuthnConfig.Timeout).Err(); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// ConsumeWebAuthnChallenge redeems a challenge taken from client data. It is
+// used up even if the response turns out to be invalid.
+func ConsumeWebAuthnChallenge(ctx context.Context, purpose, challenge string) (*WebAuthnCeremony, error) {
+	key := webAuthnChallengeKey(HashToken(challenge))
+	value, err := database.RedisClient.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidWebAuthnChallenge
+		}
+		return nil, err
+	}
+
+	deleted, err := database.RedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	var ceremony WebAuthnCeremony
+	if err := json.Unmarshal(value, &ceremony); err != nil {
+		return nil, err
+	}
+	if ceremony.Purpose != purpose {
+		return nil, ErrInvalidWebAuthnChallenge
+	}
+
+	return &ceremony, nil
+}
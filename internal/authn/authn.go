@@ -0,0 +1,98 @@
+// Package authn checks login credentials against the configured backends:
+// the local users table and, optionally, an LDAP directory. It also keeps
+// the local users that directory and SAML accounts are mapped to.
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+)
+
+// Backend names as used in AUTH_BACKENDS.
+const (
+	BackendDatabase = "database"
+	BackendLDAP     = "ldap"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator checks a password for the account with the given email and
+// returns the local user it belongs to. Wrong credentials and unknown
+// accounts are both reported as ErrInvalidCredentials; any other error means
+// the backend could not decide.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+}
+
+// Result is a successful login and the backend that accepted it.
+type Result struct {
+	User    *models.User
+	Backend string
+}
+
+var (
+	backends []Authenticator
+	mu       sync.RWMutex
+)
+
+// Init builds the backends listed in cfg.Auth.Backends.
+func Init(cfg *config.Config) error {
+	var configured []Authenticator
+	for _, name := range cfg.Auth.Backends {
+		switch strings.TrimSpace(name) {
+		case BackendDatabase:
+			configured = append(configured, Database{})
+		case BackendLDAP:
+			if cfg.LDAP.URL == "" || cfg.LDAP.BaseDN == "" {
+				return errors.New("the ldap backend needs LDAP_URL and LDAP_BASE_DN")
+			}
+			configured = append(configured, NewLDAP(cfg.LDAP))
+		case "":
+		default:
+			return fmt.Errorf("unknown auth backend %q", name)
+		}
+	}
+	if len(configured) == 0 {
+		return errors.New("no auth backends configured")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	backends = configured
+	return nil
+}
+
+// Authenticate tries each backend in turn and returns the first that accepts
+// the credentials. If none does and one of them failed, that error is
+// returned instead of ErrInvalidCredentials, so an unreachable directory
+// isn't counted as a wrong password.
+func Authenticate(ctx context.Context, email, password string) (*Result, error) {
+	mu.RLock()
+	configured := backends
+	mu.RUnlock()
+
+	var failure error
+	for _, backend := range configured {
+		user, err := backend.Authenticate(ctx, email, password)
+		if err == nil {
+			return &Result{User: user, Backend: backend.Name()}, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("Error authenticating with %s: %v", backend.Name(), err)
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return nil, failure
+	}
+	return nil, ErrInvalidCredentials
+}
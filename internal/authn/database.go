@@ -0,0 +1,59 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/password"
+
+	"gorm.io/gorm"
+)
+
+// Database checks passwords against the hashes in the users table.
+type Database struct{}
+
+func (Database) Name() string {
+	return BackendDatabase
+}
+
+func (Database) Authenticate(ctx context.Context, email, plaintext string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := user.ComparePassword(plaintext); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// The plaintext is only available now, so this is the chance to move
+	// hashes made with old settings to the configured ones
+	if user.PasswordNeedsRehash() {
+		rehashPassword(ctx, &user, plaintext)
+	}
+
+	return &user, nil
+}
+
+// rehashPassword replaces the user's stored hash with one made by the
+// configured hasher. Failing to do so only delays the upgrade to the next
+// login, so errors are logged rather than returned.
+func rehashPassword(ctx context.Context, user *models.User, plaintext string) {
+	hashed, err := password.Hash(plaintext)
+	if err != nil {
+		log.Printf("Error rehashing password: %v", err)
+		return
+	}
+
+	if err := database.DB.WithContext(ctx).Model(user).UpdateColumn("password", hashed).Error; err != nil {
+		log.Printf("Error rehashing password: %v", err)
+		return
+	}
+	user.Password = hashed
+}
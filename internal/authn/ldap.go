@@ -0,0 +1,250 @@
+package authn
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// LDAP authenticates against a directory with search-then-bind: a service
+// account looks the user up by email, then the password is checked by
+// binding as the user's DN. Directory users are created in the users table
+// on their first login and linked through an "ldap" identity, and their
+// names and mapped roles are synced on every login.
+type LDAP struct {
+	cfg config.LDAPConfig
+}
+
+func NewLDAP(cfg config.LDAPConfig) *LDAP {
+	return &LDAP{cfg: cfg}
+}
+
+func (l *LDAP) Name() string {
+	return BackendLDAP
+}
+
+func (l *LDAP) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	// An empty password would be an unauthenticated bind, which many
+	// directories accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	entry, err := l.bind(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.provision(ctx, entry)
+}
+
+// bind finds the user's entry and checks the password against it.
+func (l *LDAP) bind(email, password string) (*ldap.Entry, error) {
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("binding as the service account: %w", err)
+		}
+	}
+
+	attributes := []string{l.cfg.EmailAttribute, l.cfg.FirstNameAttribute, l.cfg.LastNameAttribute}
+	if l.cfg.IDAttribute != "" {
+		attributes = append(attributes, l.cfg.IDAttribute)
+	}
+	if l.cfg.GroupAttribute != "" {
+		attributes = append(attributes, l.cfg.GroupAttribute)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(l.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(l.cfg.UserFilter, "%s", ldap.EscapeFilter(email)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("searching for the user: %w", err)
+	}
+	if result == nil || len(result.Entries) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	if len(result.Entries) > 1 {
+		log.Printf("LDAP filter matched several entries for %s; refusing the login", email)
+		return nil, ErrInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("binding as the user: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: l.cfg.Timeout}
+	conn, err := ldap.DialURL(l.cfg.URL, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.cfg.Timeout)
+
+	if l.cfg.StartTLS {
+		host := l.cfg.URL
+		if parsed, err := url.Parse(l.cfg.URL); err == nil {
+			host = parsed.Hostname()
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// provision returns the local user for a directory entry, creating it on
+// the first login.
+func (l *LDAP) provision(ctx context.Context, entry *ldap.Entry) (*models.User, error) {
+	db := database.DB.WithContext(ctx)
+
+	user, err := Provision(db, External{
+		Provider:    BackendLDAP,
+		Subject:     l.entryID(entry),
+		Email:       entry.GetAttributeValue(l.cfg.EmailAttribute),
+		FirstName:   entry.GetAttributeValue(l.cfg.FirstNameAttribute),
+		LastName:    entry.GetAttributeValue(l.cfg.LastNameAttribute),
+		LinkByEmail: l.cfg.LinkByEmail,
+	})
+	switch {
+	case errors.Is(err, ErrNoEmail):
+		log.Printf("LDAP entry %s has no %s attribute; refusing the login", entry.DN, l.cfg.EmailAttribute)
+		return nil, ErrInvalidCredentials
+	case errors.Is(err, ErrAccountExists):
+		log.Printf("LDAP user %s matches an existing account; set LDAP_LINK_BY_EMAIL to link them", entry.DN)
+		return nil, ErrInvalidCredentials
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, ErrInvalidCredentials
+	case err != nil:
+		return nil, err
+	}
+
+	if err := l.syncRoles(db, user, entry.GetAttributeValues(l.cfg.GroupAttribute)); err != nil {
+		log.Printf("Error syncing roles from LDAP groups: %v", err)
+	}
+
+	return user, nil
+}
+
+// syncRoles gives the user the roles mapped to the groups they are in and
+// takes away mapped roles for groups they have left. Roles that aren't in
+// the mapping are managed locally and left alone.
+func (l *LDAP) syncRoles(db *gorm.DB, user *models.User, groups []string) error {
+	if len(l.cfg.GroupRoles) == 0 {
+		return nil
+	}
+
+	wanted := map[string]bool{}
+	managed := []string{}
+	for group, role := range l.cfg.GroupRoles {
+		managed = append(managed, role)
+		if memberOf(groups, group) {
+			wanted[role] = true
+		}
+	}
+
+	var roles []models.Role
+	if err := db.Where("name IN ?", managed).Find(&roles).Error; err != nil {
+		return err
+	}
+
+	var current []models.Role
+	if err := db.Model(user).Association("Roles").Find(&current); err != nil {
+		return err
+	}
+	has := map[string]bool{}
+	for _, role := range current {
+		has[role.Name] = true
+	}
+
+	for _, role := range roles {
+		role := role
+		switch {
+		case wanted[role.Name] && !has[role.Name]:
+			if err := db.Model(user).Association("Roles").Append(&role); err != nil {
+				return err
+			}
+		case !wanted[role.Name] && has[role.Name]:
+			if err := db.Model(user).Association("Roles").Delete(&role); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// entryID is the stable ID of a directory entry. Binary IDs such as Active
+// Directory's objectGUID are hex encoded; without an ID attribute the DN is
+// used, which breaks the link when the entry is renamed.
+func (l *LDAP) entryID(entry *ldap.Entry) string {
+	if l.cfg.IDAttribute != "" {
+		if raw := entry.GetRawAttributeValue(l.cfg.IDAttribute); len(raw) > 0 {
+			if printable(raw) {
+				return string(raw)
+			}
+			return hex.EncodeToString(raw)
+		}
+	}
+	return strings.ToLower(entry.DN)
+}
+
+// memberOf reports whether group is one of the DNs, ignoring case and
+// spacing differences.
+func memberOf(groups []string, group string) bool {
+	want, err := ldap.ParseDN(group)
+	if err != nil {
+		return false
+	}
+	for _, g := range groups {
+		if dn, err := ldap.ParseDN(g); err == nil && dn.EqualFold(want) {
+			return true
+		}
+	}
+	return false
+}
+
+func printable(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package authn
+
+import (
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"go-auth-boilerplate/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoEmail       = errors.New("external account has no email")
+	ErrAccountExists = errors.New("external account matches an existing user")
+)
+
+// External is an account at a directory or identity provider as of the
+// current login. Subject is the stable ID the provider knows it by.
+type External struct {
+	Provider  string
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+	// LinkByEmail lets the first login take over a local account with the
+	// same email.
+	LinkByEmail bool
+}
+
+// Provision returns the local user for an external account. On the first
+// login the user is created, or an existing account is linked when
+// LinkByEmail is set; afterwards the identity row finds it. Names and email
+// are synced from the provider every time.
+func Provision(db *gorm.DB, external External) (*models.User, error) {
+	var user models.User
+	var identity models.Identity
+	err := db.Where("provider = ? AND subject = ?", external.Provider, external.Subject).First(&identity).Error
+	switch {
+	case err == nil:
+		if err := db.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if external.Email == "" {
+			return nil, ErrNoEmail
+		}
+		if err := createOrLink(db, &user, external); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	syncProfile(db, &user, external)
+
+	return &user, nil
+}
+
+// createOrLink creates a user for an external account seen for the first
+// time. A local account with the same email is only taken over with
+// LinkByEmail, since otherwise anyone able to set that address at the
+// provider would get into it.
+func createOrLink(db *gorm.DB, user *models.User, external External) error {
+	identity := models.Identity{Provider: external.Provider, Subject: external.Subject, Email: external.Email}
+
+	err := db.Unscoped().Where("email = ?", external.Email).First(user).Error
+	if err == nil {
+		if !external.LinkByEmail || user.DeletedAt.Valid {
+			return ErrAccountExists
+		}
+		identity.UserID = user.ID
+		return db.Create(&identity).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// The provider vouches for the address. Age isn't known, and the user
+	// has no local password.
+	now := time.Now()
+	*user = models.User{
+		FirstName:       TruncateName(external.FirstName),
+		LastName:        TruncateName(external.LastName),
+		Email:           external.Email,
+		EmailVerifiedAt: &now,
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+
+		var role models.Role
+		err := tx.Where("name = ?", models.RoleUser).First(&role).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(user).Association("Roles").Append(&role)
+	})
+}
+
+// syncProfile copies changed names and email from the provider. Failures
+// are logged; the login itself is still valid.
+func syncProfile(db *gorm.DB, user *models.User, external External) {
+	updates := map[string]interface{}{}
+	if firstName := TruncateName(external.FirstName); firstName != "" && firstName != user.FirstName {
+		updates["first_name"] = firstName
+	}
+	if lastName := TruncateName(external.LastName); lastName != "" && lastName != user.LastName {
+		updates["last_name"] = lastName
+	}
+	if external.Email != "" && external.Email != user.Email {
+		updates["email"] = external.Email
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	if err := db.Model(user).Updates(updates).Error; err != nil {
+		log.Printf("Error syncing profile from %s: %v", external.Provider, err)
+	}
+}
+
+// TruncateName fits a name from an external source into the users table.
+func TruncateName(name string) string {
+	if utf8.RuneCountInString(name) <= 50 {
+		return name
+	}
+	return string([]rune(name)[:50])
+}
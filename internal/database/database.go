@@ -28,7 +28,9 @@ func InitDB() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Post{})
+	// AutoMigrate can't add the trigger that keeps audit_events append-only;
+	// that comes from the SQL migrations
+	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.RecoveryCode{}, &models.Role{}, &models.Permission{}, &models.PersonalAccessToken{}, &models.PasswordHistory{}, &models.OAuthClient{}, &models.Identity{}, &models.Passkey{}, &models.AuditEvent{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
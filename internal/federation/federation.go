@@ -0,0 +1,71 @@
+// Package federation lets users log in with an account at an external OpenID
+// Connect provider such as Google, Microsoft or a company IdP.
+package federation
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-auth-boilerplate/config"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid ID token from identity provider")
+)
+
+// httpTimeout bounds every call to a provider so a slow IdP can't hold up
+// logins indefinitely.
+const httpTimeout = 10 * time.Second
+
+var (
+	providers = map[string]*Provider{}
+	order     []string
+	mu        sync.RWMutex
+)
+
+// Init registers the configured providers. Their discovery documents and
+// keys are only fetched when first needed, so an unreachable provider does
+// not stop the service from starting.
+func Init(cfgs []config.IdentityProviderConfig) {
+	registered := make(map[string]*Provider, len(cfgs))
+	names := make([]string, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		registered[cfg.Name] = &Provider{
+			cfg:    cfg,
+			client: &http.Client{Timeout: httpTimeout},
+		}
+		names = append(names, cfg.Name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	providers = registered
+	order = names
+}
+
+// Lookup returns the provider registered under name.
+func Lookup(name string) (*Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	provider, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// List returns the registered providers in the order they were configured.
+func List() []*Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]*Provider, 0, len(order))
+	for _, name := range order {
+		list = append(list, providers[name])
+	}
+	return list
+}
@@ -0,0 +1,286 @@
+package federation
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrCodeRejected means the provider refused to exchange the authorization
+// code, e.g. because it expired or was already used.
+var ErrCodeRejected = errors.New("identity provider rejected the authorization code")
+
+// keyRefreshInterval limits how often an unknown key ID makes us refetch the
+// provider's keys, so forged tokens can't be used to hammer it.
+const keyRefreshInterval = time.Minute
+
+// maxResponseSize caps what is read from a provider.
+const maxResponseSize = 1 << 20
+
+// signingMethods are the algorithms accepted on ID tokens. Symmetric
+// algorithms are left out on purpose: the client secret is not a signing key.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Provider is an external OpenID Connect provider.
+type Provider struct {
+	cfg    config.IdentityProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims is what the provider asserts about the user in its ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+// AuthorizationURL is where to send the browser to log in at the provider.
+func (p *Provider) AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider and returns the
+// claims of the verified ID token. The token must carry the nonce the login
+// was started with.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return nil, ErrCodeRejected
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	return p.verifyIDToken(ctx, metadata, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, metadata *providerMetadata, idToken, nonce string) (*Claims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(signingMethods))
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if !claims.VerifyIssuer(metadata.Issuer, true) ||
+		!claims.VerifyAudience(p.cfg.ClientID, true) ||
+		!claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrInvalidIDToken
+	}
+	// With several audiences the token must say it was issued to us
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, ErrInvalidIDToken
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, ErrInvalidIDToken
+	}
+
+	result := &Claims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.GivenName, _ = claims["given_name"].(string)
+	result.FamilyName, _ = claims["family_name"].(string)
+	result.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	if result.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+	return result, nil
+}
+
+// discover fetches the provider's discovery document once and caches it.
+func (p *Provider) discover(ctx context.Context) (*providerMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata providerMetadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.cfg.Name, err)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovering %s: issuer %q does not match the configured one", p.cfg.Name, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: incomplete discovery document", p.cfg.Name)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key returns the provider's verification key with the given ID. An unknown
+// ID makes it refetch the key set, since the provider may have rotated its
+// keys. Tokens without a key ID are accepted when the set has a single key.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	var set auth.JWKSet
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Skip keys we can't use rather than failing on the whole set
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func toAccessTokenResponse(pat models.PersonalAccessToken) models.AccessTokenResponse {
+	return models.AccessTokenResponse{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Prefix:     pat.Prefix,
+		Scopes:     pat.ScopeList(),
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+		CreatedAt:  pat.CreatedAt,
+	}
+}
+
+// GetAccessTokens godoc
+// @Summary List personal access tokens
+// @Description List the authenticated user's personal access tokens. The tokens themselves are never shown again after creation.
+// @Tags tokens
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.AccessTokensResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /tokens [get]
+func GetAccessTokens(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+
+	var tokens []models.PersonalAccessToken
+	if err := db.Where("user_id = ?", userId).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch access tokens",
+		})
+	}
+
+	items := make([]models.AccessTokenResponse, len(tokens))
+	for i, token := range tokens {
+		items[i] = toAccessTokenResponse(token)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.AccessTokensResponse{Items: items})
+}
+
+// CreateAccessToken godoc
+// @Summary Create a personal access token
+// @Description Create a named, scoped API key for scripts and other machine clients. The token is only returned in this response.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.CreateAccessTokenRequest true "Token details"
+// @Success 201 {object} models.CreatedAccessTokenResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /tokens [post]
+func CreateAccessToken(c *fiber.Ctx) error {
+	var request models.CreateAccessTokenRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Expiry must be in the future",
+		})
+	}
+
+	token, prefix, hash, err := auth.NewPersonalAccessToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create access token",
+		})
+	}
+
+	pat := models.PersonalAccessToken{
+		UserID:    uint(c.Locals("user_id").(float64)),
+		Name:      request.Name,
+		Prefix:    prefix,
+		TokenHash: hash,
+		Scopes:    strings.Join(request.Scopes, " "),
+		ExpiresAt: request.ExpiresAt,
+	}
+	if err := db.Create(&pat).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create access token",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.CreatedAccessTokenResponse{
+		AccessTokenResponse: toAccessTokenResponse(pat),
+		Token:               token,
+	})
+}
+
+// DeleteAccessToken godoc
+// @Summary Revoke a personal access token
+// @Description Revoke one of the authenticated user's personal access tokens
+// @Tags tokens
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Token ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /tokens/{id} [delete]
+func DeleteAccessToken(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	tokenId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid token ID",
+		})
+	}
+
+	result := db.Where("id = ? AND user_id = ?", tokenId, userId).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not revoke access token",
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Access token not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Access token revoked successfully",
+	})
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxAdminPageSize = 100
+
+func toAdminUserResponse(user models.User) models.AdminUserResponse {
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+
+	var deletedAt *time.Time
+	if user.DeletedAt.Valid {
+		deletedAt = &user.DeletedAt.Time
+	}
+
+	return models.AdminUserResponse{
+		ID:              user.ID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Age:             user.Age,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		MFAEnabled:      user.TOTPEnabledAt != nil,
+		Roles:           roles,
+		SuspendedAt:     user.SuspendedAt,
+		DeletedAt:       deletedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+}
+
+// isCurrentUser guards actions an admin shouldn't be able to take against
+// their own account, such as locking themselves out.
+func isCurrentUser(c *fiber.Ctx, user *models.User) bool {
+	return uint(c.Locals("user_id").(float64)) == user.ID
+}
+
+// escapeLike makes user input match literally in a LIKE pattern with
+// ESCAPE '\'.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// AdminGetUsers godoc
+// @Summary List users
+// @Description List users with pagination. Search matches email, first name and last name.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page (max 100)"
+// @Param q query string false "Search term"
+// @Param status query string false "active, suspended or deleted"
+// @Success 200 {object} models.AdminUsersResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users [get]
+func AdminGetUsers(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	offset := (page - 1) * limit
+
+	query := db.Model(&models.User{})
+	switch c.Query("status") {
+	case "":
+	case "active":
+		query = query.Where("suspended_at IS NULL")
+	case "suspended":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "deleted":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid status filter",
+		})
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+		query = query.Where(`LOWER(email) LIKE ? ESCAPE '\' OR LOWER(first_name) LIKE ? ESCAPE '\' OR LOWER(last_name) LIKE ? ESCAPE '\'`, pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch users",
+		})
+	}
+
+	var users []models.User
+	if err := query.Preload("Roles").Order("id").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch users",
+		})
+	}
+
+	items := make([]models.AdminUserResponse, len(users))
+	for i, user := range users {
+		items[i] = toAdminUserResponse(user)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.AdminUsersResponse{
+		TotalItems: int(total),
+		Items:      items,
+		Limit:      limit,
+		HasNext:    (offset + len(users)) < int(total),
+	})
+}
+
+// AdminGetUser godoc
+// @Summary Get a user
+// @Description Get a user's account details, roles and post count
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.AdminUserDetailResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id} [get]
+func AdminGetUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	var postCount int64
+	if err := db.Model(&models.Post{}).Where("user_id = ?", user.ID).Count(&postCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch user",
+		})
+	}
+
+	lockedFor, err := auth.LoginLockedFor(context.Background(), user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch user",
+		})
+	}
+
+	var lockedUntil *time.Time
+	if lockedFor > 0 {
+		until := time.Now().Add(lockedFor)
+		lockedUntil = &until
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.AdminUserDetailResponse{
+		AdminUserResponse: toAdminUserResponse(*user),
+		PostCount:         postCount,
+		LoginLockedUntil:  lockedUntil,
+	})
+}
+
+// SuspendUser godoc
+// @Summary Suspend a user
+// @Description Block a user from logging in and sign out all of their sessions
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/suspend [post]
+func SuspendUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	if isCurrentUser(c, user) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot suspend your own account",
+		})
+	}
+
+	if user.SuspendedAt == nil {
+		if err := db.Model(user).Update("suspended_at", time.Now()).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not suspend user",
+			})
+		}
+	}
+
+	if err := auth.RevokeUserSessions(context.Background(), user.ID, ""); err != nil {
+		log.Printf("Error deleting sessions from Redis: %v", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User suspended successfully",
+	})
+}
+
+// UnsuspendUser godoc
+// @Summary Unsuspend a user
+// @Description Allow a suspended user to log in again
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/unsuspend [post]
+func UnsuspendUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	if err := db.Model(user).Update("suspended_at", nil).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not unsuspend user",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unsuspended successfully",
+	})
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user's login
+// @Description Lift a lockout caused by too many failed login attempts
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/unlock [post]
+func UnlockUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	if err := auth.UnlockLogin(context.Background(), user.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not unlock user",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User unlocked successfully",
+	})
+}
+
+// ForcePasswordReset godoc
+// @Summary Force a password reset
+// @Description Invalidate the user's password, sign out all of their sessions and email them a reset link
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 202 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/password_reset [post]
+func ForcePasswordReset(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	// Replace the password with one nobody knows, so the reset link is the
+	// only way back in
+	unusable, err := auth.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not reset password",
+		})
+	}
+	if err := savePassword(user, unusable); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not reset password",
+		})
+	}
+
+	if err := auth.RevokeUserSessions(context.Background(), user.ID, ""); err != nil {
+		log.Printf("Error deleting sessions from Redis: %v", err)
+	}
+
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPasswordForceReset,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetUser, user.ID))
+
+	go sendPasswordResetEmail(*user)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Password reset email sent",
+	})
+}
+
+// AdminRevokeSessions godoc
+// @Summary Sign a user out everywhere
+// @Description Revoke all of a user's sessions
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/sessions/revoke_all [post]
+func AdminRevokeSessions(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	if err := auth.RevokeUserSessions(context.Background(), user.ID, ""); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not revoke sessions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "All sessions revoked",
+	})
+}
+
+// AdminDeleteUser godoc
+// @Summary Delete a user
+// @Description Soft delete a user, or remove them and their posts permanently with hard=true. The last admin cannot be deleted.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param hard query bool false "Permanently delete the user"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id} [delete]
+func AdminDeleteUser(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	if isCurrentUser(c, user) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot delete your own account here",
+		})
+	}
+
+	last, err := lastAdmin(db, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not delete user",
+		})
+	}
+	if last {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Cannot delete the last admin",
+		})
+	}
+
+	if err := auth.RevokeUserSessions(context.Background(), user.ID, ""); err != nil {
+		log.Printf("Error deleting sessions from Redis: %v", err)
+	}
+
+	query := db
+	if c.QueryBool("hard") {
+		query = db.Unscoped()
+	}
+	if err := query.Delete(&models.User{}, user.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not delete user",
+		})
+	}
+
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditUserDelete,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetUser, user.ID))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User deleted successfully",
+	})
+}
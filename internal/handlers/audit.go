@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"go-auth-boilerplate/internal/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"gorm.io/gorm"
+)
+
+// recordAudit adds an event to the audit log, filling in who made the
+// request and from where. The request goes ahead even if the event can't be
+// written.
+func recordAudit(c *fiber.Ctx, event models.AuditEvent) {
+	if event.ActorID == nil {
+		if userId, ok := c.Locals("user_id").(float64); ok {
+			actorId := uint(userId)
+			event.ActorID = &actorId
+		}
+	}
+	event.IP = c.IP()
+	event.UserAgent = c.Get(fiber.HeaderUserAgent)
+	event.RequestID, _ = c.Locals(requestid.ConfigDefault.ContextKey).(string)
+
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Error recording audit event %s: %v", event.Action, err)
+	}
+}
+
+// auditTarget sets the resource an event is about.
+func auditTarget(event models.AuditEvent, targetType string, id uint) models.AuditEvent {
+	event.TargetType = targetType
+	event.TargetID = &id
+	return event
+}
+
+// recordLoginFailure records a failed login for an email address. The event
+// targets the account with that address, if there is one, so that its owner
+// sees it in their activity.
+func recordLoginFailure(c *fiber.Ctx, email, reason string) {
+	event := models.AuditEvent{
+		Action:  models.AuditLogin,
+		Outcome: models.AuditFailure,
+		Reason:  reason,
+		Email:   email,
+	}
+
+	var user models.User
+	err := db.Select("id").Where("email = ?", email).Take(&user).Error
+	if err == nil {
+		event = auditTarget(event, models.AuditTargetUser, user.ID)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error looking up login target: %v", err)
+	}
+
+	recordAudit(c, event)
+}
+
+// recordLoginSuccess records that a user signed in and got a session.
+func recordLoginSuccess(c *fiber.Ctx, user *models.User) {
+	actorId := user.ID
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditLogin,
+		Outcome: models.AuditSuccess,
+		ActorID: &actorId,
+		Email:   user.Email,
+	}, models.AuditTargetUser, user.ID))
+}
+
+// listAuditEvents responds with a page of the events the query selects,
+// newest first. The cursor is the ID of the last event of the previous page,
+// so pages stay stable while new events are written.
+func listAuditEvents(c *fiber.Ctx, query *gorm.DB) error {
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if limit < 1 || limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		query = query.Where("id < ?", id)
+	}
+
+	events := []models.AuditEvent{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&events).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch audit events",
+		})
+	}
+
+	response := models.AuditEventsResponse{Items: events}
+	if len(events) > limit {
+		response.Items = events[:limit]
+		response.NextCursor = strconv.FormatUint(uint64(events[limit-1].ID), 10)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// GetActivity godoc
+// @Summary List account activity
+// @Description List the audit events of the authenticated user's account, newest first: their own actions and login attempts made for their email address.
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Param limit query int false "Items per page (max 100)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.AuditEventsResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/activity [get]
+func GetActivity(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+
+	query := db.Model(&models.AuditEvent{}).
+		Where("(actor_id = ? OR (target_type = ? AND target_id = ?))", userId, models.AuditTargetUser, userId)
+	return listAuditEvents(c, query)
+}
+
+// AdminGetAuditEvents godoc
+// @Summary Query the audit log
+// @Description List audit events, newest first. Filters combine; user_id matches events where the user is the actor or the target.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param action query string false "Action, e.g. user.login"
+// @Param outcome query string false "success or failure"
+// @Param user_id query int false "Actor or target user ID"
+// @Param actor_id query int false "Actor user ID"
+// @Param target_type query string false "user or post"
+// @Param target_id query int false "Target ID"
+// @Param email query string false "Email a login or signup was attempted for"
+// @Param ip query string false "Client IP address"
+// @Param request_id query string false "Request ID"
+// @Param since query string false "Only events at or after this RFC 3339 time"
+// @Param until query string false "Only events before this RFC 3339 time"
+// @Param limit query int false "Items per page (max 100)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Success 200 {object} models.AuditEventsResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/audit_events [get]
+func AdminGetAuditEvents(c *fiber.Ctx) error {
+	query := db.Model(&models.AuditEvent{})
+
+	for _, filter := range []string{"action", "target_type", "ip", "request_id"} {
+		if value := c.Query(filter); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+
+	switch outcome := c.Query("outcome"); outcome {
+	case "":
+	case models.AuditSuccess, models.AuditFailure:
+		query = query.Where("outcome = ?", outcome)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid outcome filter",
+		})
+	}
+
+	if email := strings.TrimSpace(c.Query("email")); email != "" {
+		query = query.Where("LOWER(email) = ?", strings.ToLower(email))
+	}
+
+	for _, filter := range []string{"user_id", "actor_id", "target_id"} {
+		value := c.Query(filter)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid " + filter,
+			})
+		}
+		if filter == "user_id" {
+			query = query.Where("(actor_id = ? OR (target_type = ? AND target_id = ?))", id, models.AuditTargetUser, id)
+		} else {
+			query = query.Where(filter+" = ?", id)
+		}
+	}
+
+	for _, filter := range []string{"since", "until"} {
+		value := c.Query(filter)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid " + filter + " time; use RFC 3339",
+			})
+		}
+		if filter == "since" {
+			query = query.Where("created_at >= ?", at)
+		} else {
+			query = query.Where("created_at < ?", at)
+		}
+	}
+
+	return listAuditEvents(c, query)
+}
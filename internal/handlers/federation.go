@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/federation"
+	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// federatedStateCookie binds a login at an identity provider to the browser
+// that started it, so nobody can log a victim into the attacker's account by
+// sending them a callback link.
+const (
+	federatedStateCookie     = "federated_login_state"
+	federatedStateCookiePath = "/api/v1/user"
+)
+
+func setFederatedStateCookie(c *fiber.Ctx, state string, expires time.Time) {
+	c.Cookie(middleware.FlowCookie(federatedStateCookie, state, federatedStateCookiePath, expires))
+}
+
+func toIdentityResponse(identity models.Identity) models.IdentityResponse {
+	return models.IdentityResponse{
+		ID:        identity.ID,
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+}
+
+// startFederatedLogin sends the browser to the provider. linkUserID is zero
+// for a login and the signed-in user when linking an account.
+func startFederatedLogin(c *fiber.Ctx, linkUserID uint) error {
+	provider, err := federation.Lookup(c.Params("provider"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown identity provider",
+		})
+	}
+
+	ctx := context.Background()
+	state, login, err := auth.StartFederatedLogin(ctx, provider.Name(), linkUserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start login",
+		})
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(ctx, state, login.Nonce, login.CodeChallenge())
+	if err != nil {
+		log.Printf("Error contacting identity provider %s: %v", provider.Name(), err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Identity provider unavailable",
+		})
+	}
+
+	setFederatedStateCookie(c, state, time.Now().Add(auth.FederatedLoginExpiry))
+
+	return c.Status(fiber.StatusOK).JSON(models.FederatedLoginResponse{
+		AuthorizationURL: authorizationURL,
+	})
+}
+
+// GetIdentityProviders godoc
+// @Summary List identity providers
+// @Description List the external identity providers users can log in with
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.IdentityProvidersResponse
+// @Router /user/login/providers [get]
+func GetIdentityProviders(c *fiber.Ctx) error {
+	items := []models.IdentityProviderResponse{}
+	for _, provider := range federation.List() {
+		items = append(items, models.IdentityProviderResponse{
+			Name:        provider.Name(),
+			DisplayName: provider.DisplayName(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.IdentityProvidersResponse{Items: items})
+}
+
+// StartFederatedLogin godoc
+// @Summary Log in with an identity provider
+// @Description Start a login at an external OpenID Connect provider. Send the browser to the returned authorization_url; the provider sends it back to the configured redirect URL with a code and state, which go to the callback. The request sets a state cookie the callback checks.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} models.FederatedLoginResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 502 {object} models.APIResponse
+// @Router /user/login/providers/{provider} [post]
+func StartFederatedLogin(c *fiber.Ctx) error {
+	return startFederatedLogin(c, 0)
+}
+
+// FederatedLoginCallback godoc
+// @Summary Finish logging in with an identity provider
+// @Description Exchange the code and state the provider sent back. Logs in the user the provider account is linked to, or links it when the login was started from /user/identities. If no account is linked yet, a signup token is returned to finish at /user/signup/federated. If two-factor authentication is enabled, an MFA token is returned instead and must be exchanged at /user/login/mfa.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string false "State"
+// @Param request body models.FederatedCallbackRequest false "Code and state"
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Success 200 {object} models.MFAChallengeResponse
+// @Success 200 {object} models.FederatedSignupRequiredResponse
+// @Success 201 {object} models.IdentityResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
+// @Failure 502 {object} models.APIResponse
+// @Router /user/login/providers/{provider}/callback [get]
+// @Router /user/login/providers/{provider}/callback [post]
+func FederatedLoginCallback(c *fiber.Ctx) error {
+	provider, err := federation.Lookup(c.Params("provider"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown identity provider",
+		})
+	}
+
+	var request models.FederatedCallbackRequest
+	if c.Method() == fiber.MethodGet {
+		request.Code = c.Query("code")
+		request.State = c.Query("state")
+		request.Error = c.Query("error")
+	} else if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// The provider reports a cancelled or failed login instead of a code
+	if request.Error != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": fmt.Sprintf("Login with %s was not completed: %s", provider.DisplayName(), request.Error),
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	cookie := c.Cookies(federatedStateCookie)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(request.State)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login state",
+		})
+	}
+
+	ctx := context.Background()
+	login, err := auth.ConsumeFederatedLogin(ctx, request.State, provider.Name())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidFederatedLogin) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired login state",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	setFederatedStateCookie(c, "", time.Now().Add(-time.Hour))
+
+	claims, err := provider.Exchange(ctx, request.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("Error logging in with %s: %v", provider.Name(), err)
+		if errors.Is(err, federation.ErrCodeRejected) || errors.Is(err, federation.ErrInvalidIDToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": fmt.Sprintf("Could not log in with %s", provider.DisplayName()),
+			})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Identity provider unavailable",
+		})
+	}
+
+	if login.LinkUserID != 0 {
+		return linkIdentity(c, login.LinkUserID, provider, claims)
+	}
+
+	var identity models.Identity
+	err = db.Where("provider = ? AND subject = ?", provider.Name(), claims.Subject).First(&identity).Error
+	if err == nil {
+		return federatedLogin(c, identity.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	return federatedSignupRequired(c, provider, claims)
+}
+
+func federatedLogin(c *fiber.Ctx, userId uint) error {
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account not found",
+		})
+	}
+
+	if user.SuspendedAt != nil {
+		recordLoginFailure(c, user.Email, "account_suspended")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account suspended",
+		})
+	}
+
+	// The provider replaces the password, not the second factor
+	if user.TOTPEnabledAt != nil {
+		return mfaChallenge(c, &user, false)
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	recordLoginSuccess(c, &user)
+	return respondWithTokens(c, fiber.StatusOK, tokens)
+}
+
+// federatedSignupRequired hands out a signup token for a provider account
+// nobody has linked yet. Accounts are never linked by email alone: the owner
+// of an existing account has to log in and link the provider themselves.
+func federatedSignupRequired(c *fiber.Ctx, provider *federation.Provider, claims *federation.Claims) error {
+	if claims.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("%s did not share an email address", provider.DisplayName()),
+		})
+	}
+
+	var count int64
+	if err := db.Unscoped().Model(&models.User{}).Where("email = ?", claims.Email).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("An account with this email already exists. Log in and link %s from your account settings.", provider.DisplayName()),
+		})
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+
+	token, err := auth.CreateFederatedSignup(context.Background(), auth.FederatedSignup{
+		Provider:      provider.Name(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FirstName:     firstName,
+		LastName:      lastName,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.FederatedSignupRequiredResponse{
+		SignupRequired: true,
+		SignupToken:    token,
+		ExpiresIn:      int64(auth.FederatedLoginExpiry.Seconds()),
+		Email:          claims.Email,
+		FirstName:      firstName,
+		LastName:       lastName,
+	})
+}
+
+func linkIdentity(c *fiber.Ctx, userId uint, provider *federation.Provider, claims *federation.Claims) error {
+	var existing models.Identity
+	err := db.Where("provider = ? AND (subject = ? OR user_id = ?)", provider.Name(), claims.Subject, userId).First(&existing).Error
+	if err == nil {
+		if existing.UserID != userId {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("This %s account is linked to another user", provider.DisplayName()),
+			})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("A %s account is already linked", provider.DisplayName()),
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not link account",
+		})
+	}
+
+	identity := models.Identity{
+		UserID:   userId,
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if err := db.Create(&identity).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not link account",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toIdentityResponse(identity))
+}
+
+// FederatedSignUp godoc
+// @Summary Sign up with an identity provider
+// @Description Create an account for a provider login that isn't linked to one yet, using the signup token from the callback. The email comes from the provider and counts as verified if the provider says so. The account has no password until one is set through the password reset flow.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.FederatedSignupRequest true "Signup token and profile"
+// @Success 201 {object} models.TokenResponse
+// @Success 201 {object} models.CookieSessionResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/signup/federated [post]
+func FederatedSignUp(c *fiber.Ctx) error {
+	var request models.FederatedSignupRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+	signup, err := auth.ConsumeFederatedSignup(ctx, request.SignupToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidFederatedSignup) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired signup token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create user",
+		})
+	}
+
+	user := models.User{
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+		Age:       request.Age,
+		Email:     signup.Email,
+	}
+	if signup.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Identity{
+			UserID:   user.ID,
+			Provider: signup.Provider,
+			Subject:  signup.Subject,
+			Email:    signup.Email,
+		}).Error
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "uni_users_email") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Email already registered",
+			})
+		}
+		if strings.Contains(err.Error(), "idx_identities_provider_subject") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "This account is already linked to another user",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create user",
+		})
+	}
+
+	if err := assignDefaultRole(&user); err != nil {
+		log.Printf("Error assigning default role: %v", err)
+	}
+
+	actorId := user.ID
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditSignUp,
+		Outcome: models.AuditSuccess,
+		ActorID: &actorId,
+		Email:   user.Email,
+	}, models.AuditTargetUser, user.ID))
+
+	if user.EmailVerifiedAt == nil {
+		if _, err := auth.ReserveVerificationEmail(ctx, user.ID); err != nil {
+			log.Printf("Error throttling verification email: %v", err)
+		}
+		go sendVerificationEmail(user)
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate token",
+		})
+	}
+
+	return respondWithTokens(c, fiber.StatusCreated, tokens)
+}
+
+// GetIdentities godoc
+// @Summary List linked identity providers
+// @Description List the external accounts linked to the authenticated user
+// @Tags identities
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.IdentitiesResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/identities [get]
+func GetIdentities(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+
+	var identities []models.Identity
+	if err := db.Where("user_id = ?", userId).Order("id").Find(&identities).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch identities",
+		})
+	}
+
+	items := make([]models.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		items = append(items, toIdentityResponse(identity))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.IdentitiesResponse{Items: items})
+}
+
+// LinkIdentity godoc
+// @Summary Link an identity provider
+// @Description Start linking an external account to the authenticated user. Works like /user/login/providers/{provider}: send the browser to authorization_url and pass the code and state to the callback, which links the account instead of logging in.
+// @Tags identities
+// @Produce json
+// @Security ApiKeyAuth
+// @Param provider path string true "Provider name"
+// @Success 200 {object} models.FederatedLoginResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 502 {object} models.APIResponse
+// @Router /user/identities/{provider} [post]
+func LinkIdentity(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	return startFederatedLogin(c, userId)
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink an identity provider
+// @Description Remove a linked external account. Users without a password cannot remove their last way to log in.
+// @Tags identities
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Identity ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/identities/{id} [delete]
+func UnlinkIdentity(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	identityId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid identity ID",
+		})
+	}
+
+	var identity models.Identity
+	if err := db.Where("id = ? AND user_id = ?", identityId, userId).First(&identity).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Identity not found",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.HasPassword() {
+		count, err := countSignInMethods(userId)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not unlink identity",
+			})
+		}
+		if count <= 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Set a password before unlinking your last identity provider",
+			})
+		}
+	}
+
+	if err := db.Delete(&identity).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not unlink identity",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Identity unlinked successfully",
+	})
+}
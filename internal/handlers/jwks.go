@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"go-auth-boilerplate/internal/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens issued by this service
+// @Tags auth
+// @Produce json
+// @Success 200 {object} auth.JWKSet
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(auth.JWKS())
+}
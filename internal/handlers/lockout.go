@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"go-auth-boilerplate/internal/auth"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func setRetryAfter(c *fiber.Ctx, d time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// loginThrottled responds to a login attempt refused by the brute-force
+// protection: 423 when the account is locked, 429 when the client only has to
+// slow down.
+func loginThrottled(c *fiber.Ctx, throttle *auth.LoginThrottle) error {
+	setRetryAfter(c, throttle.RetryAfter)
+	if throttle.Locked {
+		return c.Status(fiber.StatusLocked).JSON(fiber.Map{
+			"error": "Account temporarily locked due to too many failed login attempts",
+		})
+	}
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": "Too many login attempts, please try again later",
+	})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/mailer"
+	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// magicLinkNonceCookie binds a login link to the browser that asked for it;
+// the link only works where the cookie is present.
+const (
+	magicLinkNonceCookie     = "magic_link_nonce"
+	magicLinkNonceCookiePath = "/api/v1/user/login/magic"
+)
+
+// RequestMagicLink godoc
+// @Summary Request a login link
+// @Description Email a single-use link that logs the user in without a password. The link only works in the browser that requested it, which receives a nonce cookie. The response is the same whether or not the email is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MagicLinkRequest true "Account email"
+// @Success 202 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 429 {object} models.APIResponse
+// @Router /user/login/magic [post]
+func RequestMagicLink(c *fiber.Ctx) error {
+	var request models.MagicLinkRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	nonce, err := auth.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not send login link",
+		})
+	}
+
+	c.Cookie(middleware.FlowCookie(magicLinkNonceCookie, nonce, magicLinkNonceCookiePath, time.Now().Add(cfg.Auth.MagicLinkExpiry)))
+
+	// Look up the account and send the email in the background so the
+	// response time doesn't reveal whether the address is registered
+	go sendMagicLink(request.Email, nonce)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If the email is registered, a login link has been sent",
+	})
+}
+
+func sendMagicLink(email, nonce string) {
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error looking up user for login link: %v", err)
+		}
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		return
+	}
+
+	ctx := context.Background()
+	token, err := auth.CreateMagicLink(ctx, user.ID, nonce)
+	if err != nil {
+		log.Printf("Error creating login link: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/login/magic?token=%s", cfg.Server.AppURL, url.QueryEscape(token))
+	err = mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to log in. It expires in %s, can only be used once and only works in the browser you requested it from.\n\n%s\n\nIf you didn't ask to log in, you can ignore this email.\n",
+			user.FirstName, cfg.Auth.MagicLinkExpiry, link),
+	})
+	if err != nil {
+		log.Printf("Error sending login link email: %v", err)
+	}
+}
+
+// VerifyMagicLink godoc
+// @Summary Log in with a login link
+// @Description Exchange a login link token for a session. The request must carry the nonce cookie set when the link was requested. If two-factor authentication is enabled, an MFA token is returned instead and must be exchanged at /user/login/mfa.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token query string false "Login link token"
+// @Param request body models.MagicLinkVerifyRequest false "Login link token"
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Success 200 {object} models.MFAChallengeResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/login/magic/verify [get]
+// @Router /user/login/magic/verify [post]
+func VerifyMagicLink(c *fiber.Ctx) error {
+	var request models.MagicLinkVerifyRequest
+
+	if c.Method() == fiber.MethodGet {
+		request.Token = c.Query("token")
+	} else if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+	userId, err := auth.ConsumeMagicLink(ctx, request.Token, c.Cookies(magicLinkNonceCookie))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidMagicLink) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired login link",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	c.Cookie(middleware.FlowCookie(magicLinkNonceCookie, "", magicLinkNonceCookiePath, time.Unix(0, 0)))
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login link",
+		})
+	}
+
+	if user.SuspendedAt != nil {
+		recordLoginFailure(c, user.Email, "account_suspended")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account suspended",
+		})
+	}
+
+	// Following the link proves the user controls the address
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := db.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			log.Printf("Error marking email as verified: %v", err)
+		}
+	}
+
+	// The link replaces the password, not the second factor
+	if user.TOTPEnabledAt != nil {
+		return mfaChallenge(c, &user, false)
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	recordLoginSuccess(c, &user)
+	return respondWithTokens(c, fiber.StatusOK, tokens)
+}
@@ -0,0 +1,554 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/totp"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// replaceRecoveryCodes discards the user's existing recovery codes and
+// returns a fresh set. Only hashes are stored.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	records := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: auth.HashRecoveryCode(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifyTOTPCode checks a code against the user's secret and rejects codes
+// that have already been used.
+func verifyTOTPCode(ctx context.Context, userID uint, secret, code string) (bool, error) {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return auth.MarkTOTPStepUsed(ctx, userID, step)
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+// A recovery code is consumed by this call.
+func verifySecondFactor(ctx context.Context, user models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		return verifyTOTPCode(ctx, user.ID, user.TOTPSecret, code)
+	}
+
+	// The used_at condition makes redeeming a code atomic
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, auth.HashRecoveryCode(recoveryCode)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// reauthenticate confirms that the user is present before a sensitive
+// change. Users with a password must send it. Users without one, such as
+// those provisioned by a directory or identity provider, can use an
+// authenticator code or a passkey instead.
+func reauthenticate(ctx context.Context, user *models.User, password, code string, passkey *models.PasskeyAssertion) (bool, error) {
+	if user.HasPassword() {
+		return user.ComparePassword(password) == nil, nil
+	}
+
+	if passkey != nil {
+		verified, err := verifyPasskey(ctx, auth.WebAuthnReauthentication, *passkey, true)
+		if errors.Is(err, errInvalidPasskey) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return verified.UserID == user.ID, nil
+	}
+
+	if code != "" && user.TOTPEnabledAt != nil {
+		return verifyTOTPCode(ctx, user.ID, user.TOTPSecret, code)
+	}
+	return false, nil
+}
+
+// reauthenticationFailed answers a request whose re-authentication was
+// rejected, naming what the user was expected to send.
+func reauthenticationFailed(c *fiber.Ctx, user *models.User) error {
+	message := "Invalid password"
+	if !user.HasPassword() {
+		message = "Invalid code or passkey"
+	}
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// mfaChallenge answers a login whose first factor was accepted but which
+// still needs a second one, listing the factors the user can complete it
+// with. localPassword is set when the first factor was the password in the
+// users table, whose maximum age is checked once the login completes.
+func mfaChallenge(c *fiber.Ctx, user *models.User, localPassword bool) error {
+	mfaToken, err := auth.CreateMFAChallenge(context.Background(), auth.MFAChallenge{
+		UserID:        user.ID,
+		LocalPassword: localPassword,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	methods := []string{models.MFAMethodTOTP, models.MFAMethodRecoveryCode}
+	var passkeys int64
+	if err := db.Model(&models.Passkey{}).Where("user_id = ?", user.ID).Count(&passkeys).Error; err != nil {
+		log.Printf("Error counting passkeys: %v", err)
+	} else if passkeys > 0 {
+		methods = append(methods, models.MFAMethodPasskey)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int64(cfg.Auth.MFAChallengeExpiry.Seconds()),
+		Methods:     methods,
+	})
+}
+
+// EnrollTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a new authenticator secret. Two-factor authentication is only enabled once a code is confirmed.
+// @Tags mfa
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.TOTPEnrollmentResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/mfa/totp/enroll [post]
+func EnrollTOTP(c *fiber.Ctx) error {
+	userId := c.Locals("user_id").(float64)
+	var user models.User
+	if err := db.First(&user, uint(userId)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start enrollment",
+		})
+	}
+
+	if err := auth.SetPendingTOTPSecret(context.Background(), user.ID, secret); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start enrollment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(cfg.Auth.MFAIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with a code from the authenticator app. Returns one-time recovery codes, which are only shown once.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.TOTPCodeRequest true "Authenticator code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/mfa/totp/confirm [post]
+func ConfirmTOTP(c *fiber.Ctx) error {
+	var request models.TOTPCodeRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId := c.Locals("user_id").(float64)
+	var user models.User
+	if err := db.First(&user, uint(userId)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	ctx := context.Background()
+	secret, err := auth.PendingTOTPSecret(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not confirm enrollment",
+		})
+	}
+	if secret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No enrollment in progress",
+		})
+	}
+
+	ok, err := verifyTOTPCode(ctx, user.ID, secret, request.Code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not confirm enrollment",
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     secret,
+			"totp_enabled_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not confirm enrollment",
+		})
+	}
+
+	if err := auth.ClearPendingTOTPSecret(ctx, user.ID); err != nil {
+		log.Printf("Error clearing pending TOTP secret: %v", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes with a new set. Requires the current password, or an authenticator code or passkey for users without a password.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.ReauthenticateRequest true "Re-authentication"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/mfa/recovery_codes [post]
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var request models.ReauthenticateRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId := c.Locals("user_id").(float64)
+	var user models.User
+	if err := db.First(&user, uint(userId)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+
+	ok, err := reauthenticate(context.Background(), &user, request.Password, request.Code, request.Passkey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate recovery codes",
+		})
+	}
+	if !ok {
+		return reauthenticationFailed(c, &user)
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not generate recovery codes",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTOTP godoc
+// @Summary Disable two-factor authentication
+// @Description Turn off TOTP and delete recovery codes. Requires the current password and either an authenticator code or a recovery code. Users without a password send an authenticator code or a passkey.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.DisableTOTPRequest true "Re-authentication"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/mfa/totp/disable [post]
+func DisableTOTP(c *fiber.Ctx) error {
+	var request models.DisableTOTPRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId := c.Locals("user_id").(float64)
+	var user models.User
+	if err := db.First(&user, uint(userId)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+
+	ctx := context.Background()
+	ok, err := reauthenticate(ctx, &user, request.Password, request.Code, request.Passkey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not disable two-factor authentication",
+		})
+	}
+	if !ok {
+		return reauthenticationFailed(c, &user)
+	}
+
+	// Without a password, the code or passkey above was the only factor
+	// available, so it isn't asked for twice
+	if user.HasPassword() {
+		ok, err = verifySecondFactor(ctx, user, request.Code, request.RecoveryCode)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not disable two-factor authentication",
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid code",
+			})
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not disable two-factor authentication",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// LoginMFA godoc
+// @Summary Complete two-factor login
+// @Description Exchange the MFA token returned by login and an authenticator code, recovery code or passkey for a session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFALoginRequest true "MFA token and second factor"
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 403 {object} models.PasswordExpiredResponse
+// @Failure 423 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/login/mfa [post]
+func LoginMFA(c *fiber.Ctx) error {
+	var request models.MFALoginRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+	challenge, err := auth.AttemptMFAChallenge(ctx, request.MFAToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidMFAChallenge) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired MFA token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not verify code",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, challenge.UserID).Error; err != nil || user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if user.SuspendedAt != nil {
+		recordLoginFailure(c, user.Email, "account_suspended")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account suspended",
+		})
+	}
+
+	// The account may have been locked by guessing codes on other challenges
+	lockedFor, err := auth.LoginLockedFor(ctx, user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not verify code",
+		})
+	}
+	if lockedFor > 0 {
+		recordLoginFailure(c, user.Email, "throttled")
+		return loginThrottled(c, &auth.LoginThrottle{Locked: true, RetryAfter: lockedFor})
+	}
+
+	var ok bool
+	if request.Passkey != nil {
+		ok, err = verifyPasskeySecondFactor(ctx, user.ID, *request.Passkey)
+	} else {
+		ok, err = verifySecondFactor(ctx, user, request.Code, request.RecoveryCode)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not verify code",
+		})
+	}
+	if !ok {
+		if err := auth.RecordMFAFailure(ctx, user.Email); err != nil {
+			log.Printf("Error recording failed login: %v", err)
+		}
+		recordLoginFailure(c, user.Email, "invalid_mfa_code")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	if err := auth.CompleteMFAChallenge(ctx, request.MFAToken); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if err := auth.ClearLoginFailures(ctx, user.Email); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+
+	// Only checked once the second factor is verified, so the password alone
+	// can't be used to obtain a reset token. Directory passwords expire under
+	// the directory's own policy.
+	if challenge.LocalPassword && user.PasswordExpired(cfg.Password.MaxAge) {
+		recordLoginFailure(c, user.Email, "password_expired")
+		return passwordExpired(c, &user)
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	recordLoginSuccess(c, &user)
+	return respondWithTokens(c, fiber.StatusOK, tokens)
+}
@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	return c.Status(status).JSON(models.OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+// authorizationRedirect builds the URL the browser is sent back to the client
+// with, carrying either the code or an error.
+func authorizationRedirect(redirectURI, state string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// authenticateOAuthClient identifies the client making a token or revocation
+// request from HTTP Basic credentials, falling back to the credentials in the
+// request body.
+func authenticateOAuthClient(c *fiber.Ctx, clientId, secret string) (*models.OAuthClient, error) {
+	if header := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, "Basic ") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err != nil {
+			return nil, auth.ErrInvalidOAuthClient
+		}
+
+		id, password, _ := strings.Cut(string(decoded), ":")
+		// RFC 6749 form-encodes both values before they are joined
+		if clientId, err = url.QueryUnescape(id); err != nil {
+			return nil, auth.ErrInvalidOAuthClient
+		}
+		if secret, err = url.QueryUnescape(password); err != nil {
+			return nil, auth.ErrInvalidOAuthClient
+		}
+	}
+
+	return auth.AuthenticateOAuthClient(context.Background(), clientId, secret)
+}
+
+// Authorize godoc
+// @Summary Start an OAuth authorization
+// @Description Validate an authorization code request from a client application and redirect the browser to the consent screen at APP_URL/oauth/consent?request=<id>. Public clients must send an S256 PKCE code challenge. Errors found after the client and redirect URI check out are reported to the redirect URI.
+// @Tags oauth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Registered redirect URI; optional if the client has exactly one"
+// @Param scope query string false "Space-separated scopes; defaults to all of the client's scopes"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "OpenID Connect nonce copied into the ID token"
+// @Param code_challenge query string false "PKCE code challenge"
+// @Param code_challenge_method query string false "Must be S256"
+// @Success 302
+// @Failure 400 {object} models.OAuthErrorResponse
+// @Router /oauth/authorize [get]
+func Authorize(c *fiber.Ctx) error {
+	var client models.OAuthClient
+	if err := db.Where("client_id = ?", c.Query("client_id")).First(&client).Error; err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_client", "Unknown client")
+	}
+
+	redirectURI := c.Query("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIList()) == 1 {
+		redirectURI = client.RedirectURIList()[0]
+	}
+
+	// Never redirect to an address the client didn't register
+	if !client.AllowsRedirectURI(redirectURI) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "Redirect URI is not registered for this client")
+	}
+
+	state := c.Query("state")
+	fail := func(code, description string) error {
+		return c.Redirect(authorizationRedirect(redirectURI, state, url.Values{
+			"error":             {code},
+			"error_description": {description},
+		}), fiber.StatusFound)
+	}
+
+	if c.Query("response_type") != "code" {
+		return fail("unsupported_response_type", "Only the code response type is supported")
+	}
+	if !client.AllowsGrantType(models.GrantTypeAuthorizationCode) {
+		return fail("unauthorized_client", "Client may not use the authorization code grant")
+	}
+
+	scopes := strings.Fields(c.Query("scope"))
+	if len(scopes) == 0 {
+		scopes = client.ScopeList()
+	}
+	if !client.AllowsScopes(scopes) {
+		return fail("invalid_scope", "Requested scope is not allowed for this client")
+	}
+
+	challenge := c.Query("code_challenge")
+	if challenge != "" && c.Query("code_challenge_method") != "S256" {
+		return fail("invalid_request", "Only the S256 code challenge method is supported")
+	}
+	if challenge == "" && client.Public {
+		return fail("invalid_request", "Public clients must use PKCE")
+	}
+
+	id, err := auth.CreateAuthorizationRequest(context.Background(), auth.AuthorizationRequest{
+		ClientID:            client.ClientID,
+		RedirectURI:         redirectURI,
+		RedirectURIProvided: c.Query("redirect_uri") != "",
+		Scopes:              scopes,
+		State:               state,
+		Nonce:               c.Query("nonce"),
+		CodeChallenge:       challenge,
+	})
+	if err != nil {
+		log.Printf("Error storing authorization request: %v", err)
+		return fail("server_error", "Could not start authorization")
+	}
+
+	return c.Redirect(fmt.Sprintf("%s/oauth/consent?request=%s", cfg.Server.AppURL, url.QueryEscape(id)), fiber.StatusFound)
+}
+
+// GetAuthorizationRequest godoc
+// @Summary Get a pending OAuth authorization
+// @Description Describe an authorization request waiting for the user's consent, for the consent screen to show
+// @Tags oauth
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Authorization request ID"
+// @Success 200 {object} models.OAuthConsentResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Router /oauth/requests/{id} [get]
+func GetAuthorizationRequest(c *fiber.Ctx) error {
+	request, err := auth.PendingAuthorizationRequest(context.Background(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Authorization request not found",
+		})
+	}
+
+	var client models.OAuthClient
+	if err := db.Where("client_id = ?", request.ClientID).First(&client).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Authorization request not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.OAuthConsentResponse{
+		ID:          c.Params("id"),
+		ClientID:    client.ClientID,
+		ClientName:  client.Name,
+		Scopes:      request.Scopes,
+		RedirectURI: request.RedirectURI,
+	})
+}
+
+// ApproveAuthorizationRequest godoc
+// @Summary Approve an OAuth authorization
+// @Description Grant the client the requested access to the authenticated user's account. The browser should be sent to the returned address, which carries the authorization code.
+// @Tags oauth
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Authorization request ID"
+// @Success 200 {object} models.OAuthRedirectResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /oauth/requests/{id}/approve [post]
+func ApproveAuthorizationRequest(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	sessionId, _ := c.Locals("session_id").(string)
+
+	request, err := auth.ConsumeAuthorizationRequest(context.Background(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Authorization request not found",
+		})
+	}
+
+	code, err := auth.CreateAuthorizationCode(context.Background(), *request, userId, sessionId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not approve authorization",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.OAuthRedirectResponse{
+		RedirectTo: authorizationRedirect(request.RedirectURI, request.State, url.Values{"code": {code}}),
+	})
+}
+
+// DenyAuthorizationRequest godoc
+// @Summary Deny an OAuth authorization
+// @Description Refuse the client access. The browser should be sent to the returned address, which tells the client access was denied.
+// @Tags oauth
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Authorization request ID"
+// @Success 200 {object} models.OAuthRedirectResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Router /oauth/requests/{id}/deny [post]
+func DenyAuthorizationRequest(c *fiber.Ctx) error {
+	request, err := auth.ConsumeAuthorizationRequest(context.Background(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Authorization request not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.OAuthRedirectResponse{
+		RedirectTo: authorizationRedirect(request.RedirectURI, request.State, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"The user denied access"},
+		}),
+	})
+}
+
+// OAuthToken godoc
+// @Summary Issue OAuth tokens
+// @Description Token endpoint of the OAuth 2.0 authorization server. Supports the authorization_code (with PKCE), refresh_token and client_credentials grants. Confidential clients authenticate with HTTP Basic or client_id and client_secret in the body. Grants with the openid scope also get an ID token.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param request body models.OAuthTokenRequest true "Token request"
+// @Success 200 {object} models.OAuthTokenResponse
+// @Failure 400 {object} models.OAuthErrorResponse
+// @Failure 401 {object} models.OAuthErrorResponse
+// @Failure 500 {object} models.OAuthErrorResponse
+// @Router /oauth/token [post]
+func OAuthToken(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	var request models.OAuthTokenRequest
+	if err := c.BodyParser(&request); err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+	}
+
+	client, err := authenticateOAuthClient(c, request.ClientID, request.ClientSecret)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOAuthClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not authenticate client")
+	}
+
+	grantTypes := []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken, models.GrantTypeClientCredentials}
+	if !slices.Contains(grantTypes, request.GrantType) {
+		return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+	if !client.AllowsGrantType(request.GrantType) {
+		return oauthError(c, fiber.StatusBadRequest, "unauthorized_client", "Client may not use this grant type")
+	}
+
+	ctx := context.Background()
+	var tokens *models.OAuthTokenResponse
+	switch request.GrantType {
+	case models.GrantTypeAuthorizationCode:
+		authorization, err := auth.ExchangeAuthorizationCode(ctx, request.Code, client, request.RedirectURI, request.CodeVerifier)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidGrant) {
+				return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+			}
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not redeem authorization code")
+		}
+
+		tokens, err = auth.IssueOAuthTokens(ctx, auth.OAuthGrant{
+			UserID:    authorization.UserID,
+			ClientID:  client.ClientID,
+			Scopes:    authorization.Scopes,
+			SessionID: authorization.SessionID,
+			Nonce:     authorization.Nonce,
+		}, client.AllowsGrantType(models.GrantTypeRefreshToken))
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not issue tokens")
+		}
+	case models.GrantTypeRefreshToken:
+		tokens, err = auth.RefreshOAuthTokens(ctx, request.RefreshToken, client, strings.Fields(request.Scope))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidScope):
+				return oauthError(c, fiber.StatusBadRequest, "invalid_scope", "Requested scope exceeds the granted scope")
+			case errors.Is(err, auth.ErrInvalidGrant), errors.Is(err, auth.ErrRefreshTokenReused):
+				return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Invalid or expired refresh token")
+			}
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not refresh tokens")
+		}
+	case models.GrantTypeClientCredentials:
+		scopes := strings.Fields(request.Scope)
+		if len(scopes) == 0 {
+			scopes = client.ScopeList()
+		}
+		if !client.AllowsScopes(scopes) {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for this client")
+		}
+
+		tokens, err = auth.IssueOAuthTokens(ctx, auth.OAuthGrant{
+			ClientID: client.ClientID,
+			Scopes:   scopes,
+		}, false)
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not issue tokens")
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+// RevokeOAuthToken godoc
+// @Summary Revoke an OAuth token
+// @Description Revoke an access or refresh token issued to the client (RFC 7009). Revoking a refresh token also revokes the access tokens issued with it. Session access and refresh tokens end their session. Unknown tokens are ignored.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param request body models.OAuthRevokeRequest true "Revocation request"
+// @Success 200
+// @Failure 400 {object} models.OAuthErrorResponse
+// @Failure 401 {object} models.OAuthErrorResponse
+// @Failure 500 {object} models.OAuthErrorResponse
+// @Router /oauth/revoke [post]
+func RevokeOAuthToken(c *fiber.Ctx) error {
+	var request models.OAuthRevokeRequest
+	if err := c.BodyParser(&request); err != nil || request.Token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "A token is required")
+	}
+
+	client, err := authenticateOAuthClient(c, request.ClientID, request.ClientSecret)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOAuthClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not authenticate client")
+	}
+
+	if err := auth.RevokeOAuthToken(context.Background(), request.Token, client); err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not revoke token")
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// IntrospectOAuthToken godoc
+// @Summary Introspect a token
+// @Description Tell a resource server whether a token is active and what it grants (RFC 7662). Describes session, personal access and OAuth tokens. Only confidential clients may introspect. Tokens that are unknown, expired or revoked are cached as inactive for OAUTH_INTROSPECTION_CACHE_EXPIRY.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param request body models.OAuthIntrospectionRequest true "Introspection request"
+// @Success 200 {object} models.OAuthIntrospectionResponse
+// @Failure 400 {object} models.OAuthErrorResponse
+// @Failure 401 {object} models.OAuthErrorResponse
+// @Failure 500 {object} models.OAuthErrorResponse
+// @Router /oauth/introspect [post]
+func IntrospectOAuthToken(c *fiber.Ctx) error {
+	var request models.OAuthIntrospectionRequest
+	if err := c.BodyParser(&request); err != nil || request.Token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "A token is required")
+	}
+
+	client, err := authenticateOAuthClient(c, request.ClientID, request.ClientSecret)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOAuthClient) {
+			return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		}
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not authenticate client")
+	}
+	// Anyone can claim to be a public client, so they could probe tokens
+	if client.Public {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Public clients cannot introspect tokens")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	info, err := auth.IntrospectToken(context.Background(), request.Token)
+	if errors.Is(err, auth.ErrInactiveToken) {
+		return c.Status(fiber.StatusOK).JSON(models.OAuthIntrospectionResponse{Active: false})
+	}
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Could not introspect token")
+	}
+
+	response := models.OAuthIntrospectionResponse{
+		Active:   true,
+		Scope:    strings.Join(info.Scopes, " "),
+		ClientID: info.ClientID,
+		TokenUse: info.Use,
+		Iss:      cfg.OAuth.Issuer,
+		Sid:      info.SessionID,
+	}
+	if info.UserID != 0 {
+		response.Sub = strconv.FormatUint(uint64(info.UserID), 10)
+	}
+	if info.Use == auth.TokenUseAccess {
+		response.TokenType = "Bearer"
+	}
+	if !info.ExpiresAt.IsZero() {
+		response.Exp = info.ExpiresAt.Unix()
+	}
+	if !info.IssuedAt.IsZero() {
+		response.Iat = info.IssuedAt.Unix()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
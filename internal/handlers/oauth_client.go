@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func toOAuthClientResponse(client models.OAuthClient) models.OAuthClientResponse {
+	return models.OAuthClientResponse{
+		ID:                     client.ID,
+		ClientID:               client.ClientID,
+		Name:                   client.Name,
+		RedirectURIs:           client.RedirectURIList(),
+		PostLogoutRedirectURIs: client.PostLogoutRedirectURIList(),
+		Scopes:                 client.ScopeList(),
+		GrantTypes:             client.GrantTypeList(),
+		Public:                 client.Public,
+		CreatedAt:              client.CreatedAt,
+	}
+}
+
+// AdminGetOAuthClients godoc
+// @Summary List OAuth clients
+// @Description List the applications registered with the OAuth 2.0 authorization server
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.OAuthClientsResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/oauth/clients [get]
+func AdminGetOAuthClients(c *fiber.Ctx) error {
+	var clients []models.OAuthClient
+	if err := db.Order("created_at DESC").Find(&clients).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch OAuth clients",
+		})
+	}
+
+	items := make([]models.OAuthClientResponse, len(clients))
+	for i, client := range clients {
+		items[i] = toOAuthClientResponse(client)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.OAuthClientsResponse{Items: items})
+}
+
+// AdminCreateOAuthClient godoc
+// @Summary Register an OAuth client
+// @Description Register an application with the OAuth 2.0 authorization server. Confidential clients get a client secret, which is only returned in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.CreateOAuthClientRequest true "Client details"
+// @Success 201 {object} models.CreatedOAuthClientResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/oauth/clients [post]
+func AdminCreateOAuthClient(c *fiber.Ctx) error {
+	var request models.CreateOAuthClientRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if slices.Contains(request.GrantTypes, models.GrantTypeAuthorizationCode) && len(request.RedirectURIs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The authorization_code grant needs at least one redirect URI",
+		})
+	}
+
+	// A public client can't keep a secret, so it has nothing to
+	// authenticate itself with on its own behalf
+	if request.Public && slices.Contains(request.GrantTypes, models.GrantTypeClientCredentials) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Public clients cannot use the client_credentials grant",
+		})
+	}
+
+	clientId, secret, err := auth.NewOAuthClientCredentials()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create OAuth client",
+		})
+	}
+
+	client := models.OAuthClient{
+		ClientID:               clientId,
+		Name:                   request.Name,
+		RedirectURIs:           strings.Join(request.RedirectURIs, " "),
+		PostLogoutRedirectURIs: strings.Join(request.PostLogoutRedirectURIs, " "),
+		Scopes:                 strings.Join(request.Scopes, " "),
+		GrantTypes:             strings.Join(request.GrantTypes, " "),
+		Public:                 request.Public,
+	}
+	if request.Public {
+		secret = ""
+	} else {
+		client.SecretHash = auth.HashToken(secret)
+	}
+
+	if err := db.Create(&client).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create OAuth client",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.CreatedOAuthClientResponse{
+		OAuthClientResponse: toOAuthClientResponse(client),
+		ClientSecret:        secret,
+	})
+}
+
+// AdminDeleteOAuthClient godoc
+// @Summary Remove an OAuth client
+// @Description Remove an application from the OAuth 2.0 authorization server. Tokens already issued to it stop working immediately.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Client ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/oauth/clients/{id} [delete]
+func AdminDeleteOAuthClient(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid client ID",
+		})
+	}
+
+	result := db.Delete(&models.OAuthClient{}, id)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not remove OAuth client",
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "OAuth client not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "OAuth client removed successfully",
+	})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetOpenIDConfiguration godoc
+// @Summary OpenID Connect discovery
+// @Description Describe the OpenID Connect provider so client libraries can configure themselves
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} models.OpenIDConfiguration
+// @Router /.well-known/openid-configuration [get]
+func GetOpenIDConfiguration(c *fiber.Ctx) error {
+	issuer := cfg.OAuth.Issuer
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(models.OpenIDConfiguration{
+		Issuer:                 issuer,
+		AuthorizationEndpoint:  issuer + "/oauth/authorize",
+		TokenEndpoint:          issuer + "/oauth/token",
+		UserInfoEndpoint:       issuer + "/oauth/userinfo",
+		JWKSURI:                issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:     issuer + "/oauth/revoke",
+		IntrospectionEndpoint:  issuer + "/oauth/introspect",
+		EndSessionEndpoint:     issuer + "/oauth/logout",
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			models.GrantTypeAuthorizationCode,
+			models.GrantTypeRefreshToken,
+			models.GrantTypeClientCredentials,
+		},
+		ScopesSupported: []string{
+			models.ScopeOpenID,
+			models.ScopeProfile,
+			models.ScopeEmail,
+			models.ScopePostsRead,
+			models.ScopePostsWrite,
+			models.ScopeUserRead,
+		},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{auth.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce", "sid",
+			"name", "given_name", "family_name", "updated_at", "email", "email_verified",
+		},
+	})
+}
+
+// GetUserInfo godoc
+// @Summary OpenID Connect user info
+// @Description Claims about the user an OAuth access token was issued for. Which claims are returned depends on the profile and email scopes.
+// @Tags oauth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.UserInfoResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Router /oauth/userinfo [get]
+func GetUserInfo(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// A session can see everything; tokens only what their scopes allow
+	scopes, isAccessToken := c.Locals("scopes").([]string)
+	if !isAccessToken {
+		scopes = []string{models.ScopeProfile, models.ScopeEmail}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(user.OpenIDClaims(scopes))
+}
+
+// EndSession godoc
+// @Summary OpenID Connect logout
+// @Description RP-initiated logout. Ends the session the ID token was issued from and sends the browser to post_logout_redirect_uri, which must be registered for the client.
+// @Tags oauth
+// @Produce json
+// @Param id_token_hint query string true "ID token issued to the client"
+// @Param post_logout_redirect_uri query string false "Where to send the browser afterwards"
+// @Param client_id query string false "Client ID; must match the ID token"
+// @Param state query string false "Opaque value returned to the client"
+// @Success 200 {object} models.APIResponse
+// @Success 302
+// @Failure 400 {object} models.APIResponse
+// @Router /oauth/logout [get]
+func EndSession(c *fiber.Ctx) error {
+	// The spec allows the parameters in the query or a form body
+	param := func(key string) string {
+		if value := c.Query(key); value != "" {
+			return value
+		}
+		return c.FormValue(key)
+	}
+
+	hint, err := auth.ParseIDTokenHint(param("id_token_hint"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A valid id_token_hint is required",
+		})
+	}
+
+	if clientId := param("client_id"); clientId != "" && clientId != hint.ClientID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "client_id does not match the ID token",
+		})
+	}
+
+	redirectURI := param("post_logout_redirect_uri")
+	if redirectURI != "" {
+		var client models.OAuthClient
+		err := db.Where("client_id = ?", hint.ClientID).First(&client).Error
+		if err != nil || !client.AllowsPostLogoutRedirectURI(redirectURI) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Post-logout redirect URI is not registered for this client",
+			})
+		}
+	}
+
+	if hint.SessionID != "" {
+		ctx := context.Background()
+		active, err := auth.SessionActive(ctx, hint.SessionID, hint.UserID)
+		if err != nil {
+			log.Printf("Error checking session: %v", err)
+		} else if active {
+			if err := auth.RevokeSession(ctx, hint.SessionID); err != nil {
+				log.Printf("Error deleting session from Redis: %v", err)
+			}
+		}
+	}
+
+	if redirectURI == "" {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Successfully logged out",
+		})
+	}
+
+	return c.Redirect(authorizationRedirect(redirectURI, param("state"), nil), fiber.StatusFound)
+}
@@ -0,0 +1,708 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/webauthn"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const defaultPasskeyName = "Passkey"
+
+var errInvalidPasskey = errors.New("invalid passkey")
+
+func relyingParty() webauthn.RelyingParty {
+	return webauthn.RelyingParty{ID: cfg.WebAuthn.RPID, Origins: cfg.WebAuthn.Origins}
+}
+
+// passkeyUserHandle is the opaque user ID authenticators store with a
+// passkey. It is the same for all of a user's passkeys and carries nothing
+// personal, unlike the email.
+func passkeyUserHandle(userID uint) []byte {
+	return []byte(strconv.FormatUint(uint64(userID), 10))
+}
+
+func toPasskeyResponse(passkey models.Passkey) models.PasskeyResponse {
+	return models.PasskeyResponse{
+		ID:             passkey.ID,
+		Name:           passkey.Name,
+		BackupEligible: passkey.BackupEligible,
+		LastUsedAt:     passkey.LastUsedAt,
+		CreatedAt:      passkey.CreatedAt,
+	}
+}
+
+func passkeyDescriptors(passkeys []models.Passkey) []models.PasskeyCredentialDescriptor {
+	descriptors := make([]models.PasskeyCredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		var transports []string
+		if passkey.Transports != "" {
+			transports = strings.Split(passkey.Transports, ",")
+		}
+		descriptors = append(descriptors, models.PasskeyCredentialDescriptor{
+			Type:       "public-key",
+			ID:         webauthn.EncodeBase64(passkey.CredentialID),
+			Transports: transports,
+		})
+	}
+	return descriptors
+}
+
+// passkeyRequestOptions starts a login prompt. Without passkeys the browser
+// offers every discoverable passkey it has for this site.
+func passkeyRequestOptions(ctx context.Context, purpose string, userID uint, passkeys []models.Passkey, userVerification string) (*models.PasskeyRequestOptionsResponse, error) {
+	challenge, err := auth.CreateWebAuthnChallenge(ctx, purpose, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PasskeyRequestOptionsResponse{
+		PublicKey: models.PasskeyRequestOptions{
+			Challenge:        challenge,
+			Timeout:          cfg.WebAuthn.Timeout.Milliseconds(),
+			RPID:             cfg.WebAuthn.RPID,
+			AllowCredentials: passkeyDescriptors(passkeys),
+			UserVerification: userVerification,
+		},
+	}, nil
+}
+
+// verifyPasskey checks an assertion against the challenge it answers and the
+// passkey it claims to come from, and stores the new signature counter. Any
+// problem with the assertion itself is reported as errInvalidPasskey.
+func verifyPasskey(ctx context.Context, purpose string, assertion models.PasskeyAssertion, requireUserVerification bool) (*models.Passkey, error) {
+	credentialID, err := webauthn.DecodeBase64(assertion.RawID)
+	if err != nil {
+		return nil, errInvalidPasskey
+	}
+	clientDataJSON, err := webauthn.DecodeBase64(assertion.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errInvalidPasskey
+	}
+	authenticatorData, err := webauthn.DecodeBase64(assertion.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errInvalidPasskey
+	}
+	signature, err := webauthn.DecodeBase64(assertion.Response.Signature)
+	if err != nil {
+		return nil, errInvalidPasskey
+	}
+
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, errInvalidPasskey
+	}
+	ceremony, err := auth.ConsumeWebAuthnChallenge(ctx, purpose, clientData.Challenge)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidWebAuthnChallenge) {
+			return nil, errInvalidPasskey
+		}
+		return nil, err
+	}
+
+	var passkey models.Passkey
+	if err := db.Where("credential_id = ?", credentialID).First(&passkey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidPasskey
+		}
+		return nil, err
+	}
+	if ceremony.UserID != 0 && ceremony.UserID != passkey.UserID {
+		return nil, errInvalidPasskey
+	}
+	if assertion.Response.UserHandle != "" {
+		userHandle, err := webauthn.DecodeBase64(assertion.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, passkeyUserHandle(passkey.UserID)) {
+			return nil, errInvalidPasskey
+		}
+	}
+
+	authData, err := relyingParty().VerifyAssertion(clientData.Challenge, passkey.PublicKey, uint32(passkey.SignCount),
+		clientDataJSON, authenticatorData, signature, requireUserVerification)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			log.Printf("Passkey %d of user %d sent a signature counter that did not increase; it may have been cloned", passkey.ID, passkey.UserID)
+		}
+		return nil, errInvalidPasskey
+	}
+
+	// The counter condition keeps two concurrent logins from both succeeding
+	// with the same counter value
+	result := db.Model(&passkey).Where("sign_count = ?", passkey.SignCount).Updates(map[string]interface{}{
+		"sign_count":   int64(authData.SignCount),
+		"last_used_at": time.Now(),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInvalidPasskey
+	}
+
+	return &passkey, nil
+}
+
+// verifyPasskeySecondFactor checks a passkey used in place of an
+// authenticator code. User verification isn't required, since the password
+// was already checked.
+func verifyPasskeySecondFactor(ctx context.Context, userID uint, assertion models.PasskeyAssertion) (bool, error) {
+	passkey, err := verifyPasskey(ctx, auth.WebAuthnMFA, assertion, false)
+	if errors.Is(err, errInvalidPasskey) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return passkey.UserID == userID, nil
+}
+
+// countSignInMethods counts the linked identity providers and passkeys a
+// user can log in with besides a password.
+func countSignInMethods(userID uint) (int64, error) {
+	var identities, passkeys int64
+	if err := db.Model(&models.Identity{}).Where("user_id = ?", userID).Count(&identities).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&models.Passkey{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+		return 0, err
+	}
+	return identities + passkeys, nil
+}
+
+// BeginPasskeyRegistration godoc
+// @Summary Start registering a passkey
+// @Description Get the options to pass to navigator.credentials.create(). The browser's response goes to /user/passkeys/register.
+// @Tags passkeys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.PasskeyCreationOptionsResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/passkeys/register/options [post]
+func BeginPasskeyRegistration(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	var passkeys []models.Passkey
+	if err := db.Where("user_id = ?", user.ID).Find(&passkeys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey registration",
+		})
+	}
+
+	challenge, err := auth.CreateWebAuthnChallenge(context.Background(), auth.WebAuthnRegistration, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey registration",
+		})
+	}
+
+	params := make([]models.PasskeyCredentialParameter, 0, len(webauthn.SupportedAlgorithms))
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, models.PasskeyCredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.PasskeyCreationOptionsResponse{
+		PublicKey: models.PasskeyCreationOptions{
+			RP: models.PasskeyRelyingParty{
+				ID:   cfg.WebAuthn.RPID,
+				Name: cfg.WebAuthn.RPName,
+			},
+			User: models.PasskeyUser{
+				ID:          webauthn.EncodeBase64(passkeyUserHandle(user.ID)),
+				Name:        user.Email,
+				DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+			},
+			Challenge:        challenge,
+			PubKeyCredParams: params,
+			Timeout:          cfg.WebAuthn.Timeout.Milliseconds(),
+			// Registering the same authenticator twice would only add a
+			// duplicate
+			ExcludeCredentials: passkeyDescriptors(passkeys),
+			AuthenticatorSelection: models.PasskeyAuthenticatorSelection{
+				ResidentKey:      "preferred",
+				UserVerification: "preferred",
+			},
+			Attestation: webauthn.AttestationNone,
+		},
+	})
+}
+
+// RegisterPasskey godoc
+// @Summary Register a passkey
+// @Description Finish registration with the credential returned by navigator.credentials.create(). "none" and "packed" attestation are accepted.
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body models.PasskeyRegistrationRequest true "Name and credential"
+// @Success 201 {object} models.PasskeyResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/passkeys/register [post]
+func RegisterPasskey(c *fiber.Ctx) error {
+	var request models.PasskeyRegistrationRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId := uint(c.Locals("user_id").(float64))
+	credential := request.Credential
+
+	rawID, err := webauthn.DecodeBase64(credential.RawID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+	clientDataJSON, err := webauthn.DecodeBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+	attestationObject, err := webauthn.DecodeBase64(credential.Response.AttestationObject)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+
+	ceremony, err := auth.ConsumeWebAuthnChallenge(context.Background(), auth.WebAuthnRegistration, clientData.Challenge)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidWebAuthnChallenge) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired passkey registration",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not register passkey",
+		})
+	}
+	if ceremony.UserID != userId {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired passkey registration",
+		})
+	}
+
+	verified, err := relyingParty().VerifyRegistration(clientData.Challenge, clientDataJSON, attestationObject, false)
+	if err != nil {
+		log.Printf("Error verifying passkey registration: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+	if !bytes.Equal(rawID, verified.ID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+
+	var existing int64
+	if err := db.Model(&models.Passkey{}).Where("credential_id = ?", verified.ID).Count(&existing).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not register passkey",
+		})
+	}
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Passkey already registered",
+		})
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+
+	passkey := models.Passkey{
+		UserID:            userId,
+		Name:              name,
+		CredentialID:      verified.ID,
+		PublicKey:         verified.PublicKey,
+		SignCount:         int64(verified.SignCount),
+		AAGUID:            verified.AAGUID,
+		AttestationFormat: verified.AttestationFormat,
+		Transports:        strings.Join(credential.Response.Transports, ","),
+		BackupEligible:    verified.BackupEligible,
+	}
+	if err := db.Create(&passkey).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not register passkey",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toPasskeyResponse(passkey))
+}
+
+// GetPasskeys godoc
+// @Summary List passkeys
+// @Description List the passkeys registered to the authenticated user
+// @Tags passkeys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.PasskeysResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/passkeys [get]
+func GetPasskeys(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+
+	var passkeys []models.Passkey
+	if err := db.Where("user_id = ?", userId).Order("id").Find(&passkeys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch passkeys",
+		})
+	}
+
+	items := make([]models.PasskeyResponse, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		items = append(items, toPasskeyResponse(passkey))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.PasskeysResponse{Items: items})
+}
+
+// UpdatePasskey godoc
+// @Summary Rename a passkey
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Passkey ID"
+// @Param request body models.PasskeyUpdateRequest true "New name"
+// @Success 200 {object} models.PasskeyResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/passkeys/{id} [patch]
+func UpdatePasskey(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	passkeyId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey ID",
+		})
+	}
+
+	var request models.PasskeyUpdateRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var passkey models.Passkey
+	if err := db.Where("id = ? AND user_id = ?", passkeyId, userId).First(&passkey).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Passkey not found",
+		})
+	}
+
+	if err := db.Model(&passkey).Update("name", request.Name).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not update passkey",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(toPasskeyResponse(passkey))
+}
+
+// DeletePasskey godoc
+// @Summary Delete a passkey
+// @Description Remove a passkey. Users without a password cannot remove their last way to log in.
+// @Tags passkeys
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Passkey ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/passkeys/{id} [delete]
+func DeletePasskey(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+	passkeyId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey ID",
+		})
+	}
+
+	var passkey models.Passkey
+	if err := db.Where("id = ? AND user_id = ?", passkeyId, userId).First(&passkey).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Passkey not found",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.HasPassword() {
+		count, err := countSignInMethods(userId)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not delete passkey",
+			})
+		}
+		if count <= 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Set a password before removing your last passkey",
+			})
+		}
+	}
+
+	if err := db.Delete(&passkey).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not delete passkey",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Passkey deleted successfully",
+	})
+}
+
+// BeginPasskeyLogin godoc
+// @Summary Start a passkey login
+// @Description Get the options to pass to navigator.credentials.get(). The browser lets the user pick any of their passkeys for this site; the response goes to /user/login/passkey.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.PasskeyRequestOptionsResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/login/passkey/options [post]
+func BeginPasskeyLogin(c *fiber.Ctx) error {
+	options, err := passkeyRequestOptions(context.Background(), auth.WebAuthnLogin, 0, nil, "required")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey login",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(options)
+}
+
+// LoginWithPasskey godoc
+// @Summary Log in with a passkey
+// @Description Exchange the credential returned by navigator.credentials.get() for a session. The authenticator must have verified the user (PIN or biometrics), so no second factor is asked for.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.PasskeyLoginRequest true "Credential"
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 423 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/login/passkey [post]
+func LoginWithPasskey(c *fiber.Ctx) error {
+	var request models.PasskeyLoginRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+	passkey, err := verifyPasskey(ctx, auth.WebAuthnLogin, request.Credential, true)
+	if err != nil {
+		if errors.Is(err, errInvalidPasskey) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid passkey",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, passkey.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid passkey",
+		})
+	}
+
+	if user.SuspendedAt != nil {
+		recordLoginFailure(c, user.Email, "account_suspended")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account suspended",
+		})
+	}
+
+	// A lockout stops every way of logging in, not just the password
+	lockedFor, err := auth.LoginLockedFor(ctx, user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+	if lockedFor > 0 {
+		recordLoginFailure(c, user.Email, "throttled")
+		return loginThrottled(c, &auth.LoginThrottle{Locked: true, RetryAfter: lockedFor})
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	recordLoginSuccess(c, &user)
+	return respondWithTokens(c, fiber.StatusOK, tokens)
+}
+
+// BeginPasskeyMFA godoc
+// @Summary Start a passkey second factor
+// @Description Get the options to pass to navigator.credentials.get() to complete a two-factor login with a passkey instead of a code. The credential then goes to /user/login/mfa as passkey.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.PasskeyMFAOptionsRequest true "MFA token"
+// @Success 200 {object} models.PasskeyRequestOptionsResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/login/mfa/passkey/options [post]
+func BeginPasskeyMFA(c *fiber.Ctx) error {
+	var request models.PasskeyMFAOptionsRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+	userId, err := auth.MFAChallengeOwner(ctx, request.MFAToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidMFAChallenge) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired MFA token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey login",
+		})
+	}
+
+	var passkeys []models.Passkey
+	if err := db.Where("user_id = ?", userId).Find(&passkeys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey login",
+		})
+	}
+	if len(passkeys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No passkeys registered",
+		})
+	}
+
+	options, err := passkeyRequestOptions(ctx, auth.WebAuthnMFA, userId, passkeys, "discouraged")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey login",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(options)
+}
+
+// BeginPasskeyReauthentication godoc
+// @Summary Start a passkey re-authentication
+// @Description Get the options to pass to navigator.credentials.get() to confirm a sensitive change, such as disabling two-factor authentication, with a passkey. Meant for users without a password; the credential goes to the endpoint being confirmed as passkey.
+// @Tags passkeys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.PasskeyRequestOptionsResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/passkeys/reauthenticate/options [post]
+func BeginPasskeyReauthentication(c *fiber.Ctx) error {
+	userId := uint(c.Locals("user_id").(float64))
+
+	var passkeys []models.Passkey
+	if err := db.Where("user_id = ?", userId).Find(&passkeys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey re-authentication",
+		})
+	}
+	if len(passkeys) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No passkeys registered",
+		})
+	}
+
+	options, err := passkeyRequestOptions(context.Background(), auth.WebAuthnReauthentication, userId, passkeys, "required")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start passkey re-authentication",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(options)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/mailer"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/password"
+	"log"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset link. The response is the same whether or not the email is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Account email"
+// @Success 202 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Router /user/password/forgot [post]
+func ForgotPassword(c *fiber.Ctx) error {
+	var request models.ForgotPasswordRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Look up the account and send the email in the background so the
+	// response time doesn't reveal whether the address is registered
+	go sendPasswordReset(request.Email)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+func sendPasswordReset(email string) {
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+		return
+	}
+
+	sendPasswordResetEmail(user)
+}
+
+func sendPasswordResetEmail(user models.User) {
+	ctx := context.Background()
+
+	token, err := auth.CreatePasswordResetToken(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error creating password reset token: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", cfg.Server.AppURL, url.QueryEscape(token))
+	err = mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you didn't ask to reset your password, you can ignore this email.\n",
+			user.FirstName, cfg.Auth.PasswordResetExpiry, link),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email: %v", err)
+	}
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a reset token. All of the user's sessions are signed out and any login lockout is lifted.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 400 {object} models.PasswordPolicyErrorResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/password/reset [post]
+func ResetPassword(c *fiber.Ctx) error {
+	var request models.ResetPasswordRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Look the token up without redeeming it, so a password rejected by the
+	// policy can be corrected with the same link
+	ctx := context.Background()
+	userId, err := auth.PasswordResetTokenUser(ctx, request.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired reset token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not reset password",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+
+	if violations := checkPassword(request.NewPassword, &user); len(violations) > 0 {
+		return passwordRejected(c, violations)
+	}
+
+	if _, err := auth.ConsumePasswordResetToken(ctx, request.Token); err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired reset token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not reset password",
+		})
+	}
+
+	if err := savePassword(&user, request.NewPassword); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not reset password",
+		})
+	}
+
+	if err := auth.RevokeUserSessions(ctx, user.ID, ""); err != nil {
+		log.Printf("Error deleting sessions from Redis: %v", err)
+	}
+
+	// Proving access to the mailbox also lifts a login lockout
+	if err := auth.UnlockLogin(ctx, user.Email); err != nil {
+		log.Printf("Error unlocking login: %v", err)
+	}
+
+	actorId := user.ID
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPasswordReset,
+		Outcome: models.AuditSuccess,
+		ActorID: &actorId,
+	}, models.AuditTargetUser, user.ID))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Password reset successfully",
+	})
+}
+
+// checkPassword returns the password policy rules a new password for the user
+// breaks. Existing users may also not reuse their current or recent
+// passwords.
+func checkPassword(plaintext string, user *models.User) []password.Violation {
+	violations := password.Check(plaintext, user.Email, user.FirstName, user.LastName)
+
+	if user.ID != 0 && cfg.Password.HistorySize > 0 && passwordReused(user, plaintext) {
+		violations = append(violations, password.Violation{
+			Code:    password.ViolationReused,
+			Message: fmt.Sprintf("Password must differ from your last %d passwords", cfg.Password.HistorySize+1),
+		})
+	}
+
+	return violations
+}
+
+func passwordReused(user *models.User, plaintext string) bool {
+	if user.ComparePassword(plaintext) == nil {
+		return true
+	}
+
+	var history []models.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).Order("id DESC").Limit(cfg.Password.HistorySize).Find(&history).Error; err != nil {
+		log.Printf("Error loading password history: %v", err)
+		return false
+	}
+
+	for _, entry := range history {
+		if password.Verify(entry.PasswordHash, plaintext) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// savePassword sets a new password for the user and moves the old hash to
+// their password history, keeping only the configured number of entries.
+func savePassword(user *models.User, plaintext string) error {
+	previous := user.Password
+	if err := user.SetPassword(plaintext); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(user).Error; err != nil {
+			return err
+		}
+
+		if cfg.Password.HistorySize <= 0 || previous == "" {
+			return nil
+		}
+
+		if err := tx.Create(&models.PasswordHistory{UserID: user.ID, PasswordHash: previous}).Error; err != nil {
+			return err
+		}
+
+		var stale []uint
+		if err := tx.Model(&models.PasswordHistory{}).
+			Where("user_id = ?", user.ID).
+			Order("id DESC").
+			Offset(cfg.Password.HistorySize).
+			Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return tx.Delete(&models.PasswordHistory{}, stale).Error
+	})
+}
+
+// passwordExpired answers a login with a password older than the configured
+// maximum age. Instead of tokens the client gets a reset token to choose a new
+// password with at /user/password/reset.
+func passwordExpired(c *fiber.Ctx, user *models.User) error {
+	resetToken, err := auth.CreatePasswordResetToken(context.Background(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	return c.Status(fiber.StatusForbidden).JSON(models.PasswordExpiredResponse{
+		Error:      "Password expired",
+		Code:       "password_expired",
+		ResetToken: resetToken,
+		ExpiresIn:  int64(cfg.Auth.PasswordResetExpiry.Seconds()),
+	})
+}
+
+func passwordRejected(c *fiber.Ctx, violations []password.Violation) error {
+	return c.Status(fiber.StatusBadRequest).JSON(models.PasswordPolicyErrorResponse{
+		Error:      "Password does not meet the requirements",
+		Violations: violations,
+	})
+}
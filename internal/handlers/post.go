@@ -44,6 +44,11 @@ func CreatePost(c *fiber.Ctx) error {
 		})
 	}
 
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPostCreate,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetPost, post.ID))
+
 	return c.Status(fiber.StatusCreated).JSON(post)
 }
 
@@ -181,6 +186,11 @@ func UpdatePost(c *fiber.Ctx) error {
 		})
 	}
 
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPostUpdate,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetPost, post.ID))
+
 	return c.Status(fiber.StatusOK).JSON(post)
 }
 
@@ -218,6 +228,55 @@ func DeletePost(c *fiber.Ctx) error {
 		})
 	}
 
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPostDelete,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetPost, uint(postId)))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Post deleted successfully",
+	})
+}
+
+// DeleteAnyPost godoc
+// @Summary Delete any post
+// @Description Delete a post regardless of its author. Requires the posts:delete:any permission.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "Post ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Router /admin/posts/{id} [delete]
+func DeleteAnyPost(c *fiber.Ctx) error {
+	postId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	result := db.Delete(&models.Post{}, postId)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not delete post",
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPostDelete,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetPost, uint(postId)))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Post deleted successfully",
 	})
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"go-auth-boilerplate/internal/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// assignDefaultRole gives a new account the standard user role. It is a no-op
+// if the role hasn't been seeded.
+func assignDefaultRole(user *models.User) error {
+	var role models.Role
+	err := db.Where("name = ?", models.RoleUser).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return db.Model(user).Association("Roles").Append(&role)
+}
+
+// activeAdmins selects the user_roles rows of admins who can still sign in.
+// Soft-deleted and suspended admins don't count.
+func activeAdmins(tx *gorm.DB) *gorm.DB {
+	return tx.Table("user_roles").
+		Joins("JOIN users ON users.id = user_roles.user_id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ? AND users.deleted_at IS NULL AND users.suspended_at IS NULL", models.RoleAdmin)
+}
+
+// lastAdmin reports whether the user is the only admin left who can still
+// sign in, so that deleting, suspending or demoting them would leave nobody
+// to manage the service.
+func lastAdmin(tx *gorm.DB, userID uint) (bool, error) {
+	var admins []uint
+	if err := activeAdmins(tx).Limit(2).Pluck("users.id", &admins).Error; err != nil {
+		return false, err
+	}
+	return len(admins) == 1 && admins[0] == userID, nil
+}
+
+// findUserParam loads the user named by the :id route parameter along with
+// their roles, including soft-deleted users. On failure it writes the error
+// response and returns a nil user.
+func findUserParam(c *fiber.Ctx) (*models.User, error) {
+	userId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var user models.User
+	if err := db.Unscoped().Preload("Roles.Permissions").First(&user, userId).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return &user, nil
+}
+
+// GetRoles godoc
+// @Summary List roles
+// @Description List all roles and the permissions they grant
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.RolesResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/roles [get]
+func GetRoles(c *fiber.Ctx) error {
+	roles := []models.Role{}
+	if err := db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch roles",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.RolesResponse{Items: roles})
+}
+
+// GetUserRoles godoc
+// @Summary List a user's roles
+// @Description List the roles assigned to a user
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.RolesResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Router /admin/users/{id}/roles [get]
+func GetUserRoles(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	roles := user.Roles
+	if roles == nil {
+		roles = []models.Role{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.RolesResponse{Items: roles})
+}
+
+// AssignRole godoc
+// @Summary Assign a role
+// @Description Assign a role to a user. Takes effect when the user's access token is next refreshed.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param request body models.AssignRoleRequest true "Role name"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/roles [post]
+func AssignRole(c *fiber.Ctx) error {
+	var request models.AssignRoleRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	var role models.Role
+	if err := db.Where("name = ?", request.Role).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown role",
+		})
+	}
+
+	if err := db.Model(user).Association("Roles").Append(&role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not assign role",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Role assigned successfully",
+	})
+}
+
+// RemoveRole godoc
+// @Summary Remove a role
+// @Description Remove a role from a user. The last remaining admin cannot lose the admin role.
+// @Tags admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /admin/users/{id}/roles/{role} [delete]
+func RemoveRole(c *fiber.Ctx) error {
+	user, err := findUserParam(c)
+	if user == nil {
+		return err
+	}
+
+	var role *models.Role
+	for i := range user.Roles {
+		if user.Roles[i].Name == c.Params("role") {
+			role = &user.Roles[i]
+		}
+	}
+	if role == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User does not have this role",
+		})
+	}
+
+	if role.Name == models.RoleAdmin {
+		last, err := lastAdmin(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not remove role",
+			})
+		}
+		if last {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Cannot remove the last admin",
+			})
+		}
+	}
+
+	if err := db.Model(user).Association("Roles").Delete(role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not remove role",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Role removed successfully",
+	})
+}
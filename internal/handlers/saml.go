@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/authn"
+	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/saml"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// samlProvider is the identity provider name SAML users of a tenant are
+// linked under.
+func samlProvider(tenant *saml.Tenant) string {
+	return "saml:" + tenant.Name()
+}
+
+// GetSAMLMetadata godoc
+// @Summary SAML service provider metadata
+// @Description The metadata document to import into the tenant's identity provider. It names this service's entity ID and assertion consumer service.
+// @Tags saml
+// @Produce xml
+// @Param tenant path string true "Tenant name"
+// @Success 200 {string} string "SAML metadata"
+// @Failure 404 {object} models.APIResponse
+// @Router /saml/{tenant}/metadata [get]
+func GetSAMLMetadata(c *fiber.Ctx) error {
+	tenant, err := saml.Lookup(c.Params("tenant"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown SAML tenant",
+		})
+	}
+
+	metadata, err := tenant.Metadata()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create metadata",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return c.Status(fiber.StatusOK).Send(metadata)
+}
+
+// StartSAMLLogin godoc
+// @Summary Log in with SAML single sign-on
+// @Description Send the browser here to start an SP-initiated login. It is redirected to the tenant's identity provider with an AuthnRequest, and the IdP posts its response to the assertion consumer service.
+// @Tags saml
+// @Param tenant path string true "Tenant name"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} models.APIResponse
+// @Router /saml/{tenant}/login [get]
+func StartSAMLLogin(c *fiber.Ctx) error {
+	tenant, err := saml.Lookup(c.Params("tenant"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown SAML tenant",
+		})
+	}
+
+	id, err := saml.NewRequestID()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start login",
+		})
+	}
+	if err := auth.StoreSAMLRequest(context.Background(), tenant.Name(), id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start login",
+		})
+	}
+
+	redirectURL, err := tenant.AuthnRequestURL(id, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not start login",
+		})
+	}
+
+	return c.Redirect(redirectURL, fiber.StatusFound)
+}
+
+// SAMLAssertionConsumer godoc
+// @Summary SAML assertion consumer service
+// @Description Receives the identity provider's response through the HTTP-POST binding. The signed assertion is validated and the user is created on their first login. The browser is then redirected to the tenant's redirect URL with a single-use code, which the frontend exchanges at /user/login/saml.
+// @Tags saml
+// @Accept x-www-form-urlencoded
+// @Param tenant path string true "Tenant name"
+// @Param SAMLResponse formData string true "Base64 encoded SAML response"
+// @Param RelayState formData string false "Relay state"
+// @Success 303 "Redirect to the frontend with a login code"
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
+// @Router /saml/{tenant}/acs [post]
+func SAMLAssertionConsumer(c *fiber.Ctx) error {
+	tenant, err := saml.Lookup(c.Params("tenant"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unknown SAML tenant",
+		})
+	}
+
+	samlResponse := c.FormValue("SAMLResponse")
+	if samlResponse == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SAMLResponse is required",
+		})
+	}
+
+	assertion, err := tenant.ParseResponse(samlResponse, time.Now())
+	if err != nil {
+		log.Printf("Rejected SAML response for tenant %s: %v", tenant.Name(), err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid SAML response",
+		})
+	}
+
+	ctx := context.Background()
+	if assertion.InResponseTo != "" {
+		if err := auth.ConsumeSAMLRequest(ctx, tenant.Name(), assertion.InResponseTo); err != nil {
+			if errors.Is(err, auth.ErrInvalidSAMLRequest) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired SAML login",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not create session",
+			})
+		}
+	} else if !tenant.Config().AllowIDPInitiated {
+		// Nothing ties an unsolicited response to the browser posting it
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "IdP-initiated login is not enabled for this tenant",
+		})
+	}
+
+	if err := auth.MarkSAMLAssertionUsed(ctx, tenant.Name(), assertion.ID, assertion.NotOnOrAfter); err != nil {
+		if errors.Is(err, auth.ErrSAMLAssertionReplay) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid SAML response",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	// A transient NameID changes with every login, so it can't be linked
+	if assertion.NameIDFormat == saml.NameIDFormatTransient {
+		log.Printf("SAML tenant %s sent a transient NameID; configure a persistent or email NameID at the IdP", tenant.Name())
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The identity provider did not send a stable user ID",
+		})
+	}
+
+	user, err := provisionSAMLUser(tenant, assertion)
+	if err != nil {
+		switch {
+		case errors.Is(err, authn.ErrNoEmail):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The identity provider did not share an email address",
+			})
+		case errors.Is(err, authn.ErrAccountExists):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "An account with this email already exists",
+			})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// The identity is linked to an account that has been deleted
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Account not found",
+			})
+		}
+		log.Printf("Error provisioning SAML user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	code, err := auth.CreateSAMLLoginCode(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	redirectURL, err := url.Parse(tenant.Config().RedirectURL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+	query := redirectURL.Query()
+	query.Set("code", code)
+	redirectURL.RawQuery = query.Encode()
+
+	return c.Redirect(redirectURL.String(), fiber.StatusSeeOther)
+}
+
+// LoginWithSAML godoc
+// @Summary Finish logging in with SAML single sign-on
+// @Description Exchange the code the assertion consumer service redirected the browser with. If two-factor authentication is enabled, an MFA token is returned instead and must be exchanged at /user/login/mfa.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.SAMLLoginRequest true "Login code"
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Success 200 {object} models.MFAChallengeResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Router /user/login/saml [post]
+func LoginWithSAML(c *fiber.Ctx) error {
+	var request models.SAMLLoginRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId, err := auth.ConsumeSAMLLoginCode(context.Background(), request.Code)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidSAMLLoginCode) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired login code",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account not found",
+		})
+	}
+
+	if user.SuspendedAt != nil {
+		recordLoginFailure(c, user.Email, "account_suspended")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account suspended",
+		})
+	}
+
+	// The IdP replaces the password, not the second factor
+	if user.TOTPEnabledAt != nil {
+		return mfaChallenge(c, &user, false)
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	recordLoginSuccess(c, &user)
+	return respondWithTokens(c, fiber.StatusOK, tokens)
+}
+
+// provisionSAMLUser returns the local user for an assertion, creating it on
+// the first login, and syncs the profile from the assertion's attributes.
+func provisionSAMLUser(tenant *saml.Tenant, assertion *saml.Assertion) (*models.User, error) {
+	profile := tenant.Profile(assertion)
+
+	user, err := authn.Provision(db, authn.External{
+		Provider:    samlProvider(tenant),
+		Subject:     assertion.NameID,
+		Email:       profile.Email,
+		FirstName:   profile.FirstName,
+		LastName:    profile.LastName,
+		LinkByEmail: tenant.Config().LinkByEmail,
+	})
+	switch {
+	case errors.Is(err, authn.ErrNoEmail):
+		log.Printf("SAML assertion from tenant %s has no %s attribute", tenant.Name(), tenant.Config().EmailAttribute)
+	case errors.Is(err, authn.ErrAccountExists):
+		log.Printf("SAML user %s of tenant %s matches an existing account; set LINK_BY_EMAIL to link them", assertion.NameID, tenant.Name())
+	}
+	return user, err
+}
@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/authn"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/scim"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxSCIMPageSize = 100
+
+// scimUserAttributes are the user attributes lists can be filtered on.
+// userName and the email are the same column.
+var scimUserAttributes = map[string]scim.Attribute{
+	"id":                {Column: "id", Type: scim.ID},
+	"username":          {Column: "email"},
+	"emails.value":      {Column: "email"},
+	"name.givenname":    {Column: "first_name"},
+	"name.familyname":   {Column: "last_name"},
+	"externalid":        {Column: "external_id", CaseExact: true},
+	"active":            {Column: "(suspended_at IS NULL)", Type: scim.Boolean},
+	"meta.created":      {Column: "created_at", Type: scim.DateTime},
+	"meta.lastmodified": {Column: "updated_at", Type: scim.DateTime},
+}
+
+// scimError answers with err in the SCIM error envelope. Errors that aren't
+// SCIM errors are logged and reported as internal errors.
+func scimError(c *fiber.Ctx, err error) error {
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) {
+		log.Printf("SCIM request failed: %v", err)
+		scimErr = scim.Errorf(fiber.StatusInternalServerError, "", "Internal server error")
+	}
+	return c.Status(scimErr.Status).JSON(scimErr, scim.ContentType)
+}
+
+func scimJSON(c *fiber.Ctx, status int, body interface{}) error {
+	return c.Status(status).JSON(body, scim.ContentType)
+}
+
+// parseSCIMBody decodes the request body. Fiber's BodyParser doesn't know
+// the application/scim+json content type SCIM clients send.
+func parseSCIMBody(c *fiber.Ctx, out interface{}) error {
+	if err := json.Unmarshal(c.Body(), out); err != nil {
+		return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidSyntax, "Invalid request body")
+	}
+	return nil
+}
+
+// scimQuery narrows a list query by the filter parameter.
+func scimQuery(c *fiber.Ctx, query *gorm.DB, attributes map[string]scim.Attribute) (*gorm.DB, error) {
+	filter := strings.TrimSpace(c.Query("filter"))
+	if filter == "" {
+		return query, nil
+	}
+
+	expr, err := scim.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := scim.SQL(expr, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where(where, args...), nil
+}
+
+// scimPage reads the 1-based startIndex and count parameters.
+func scimPage(c *fiber.Ctx) (startIndex, count int) {
+	startIndex = c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count = c.QueryInt("count", maxSCIMPageSize)
+	if count < 0 {
+		count = 0
+	}
+	if count > maxSCIMPageSize {
+		count = maxSCIMPageSize
+	}
+	return startIndex, count
+}
+
+func scimID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func scimLocation(resourceType string, id uint) string {
+	return cfg.OAuth.Issuer + "/scim/v2/" + resourceType + "/" + scimID(id)
+}
+
+// scimBool reads a boolean value. Some clients send booleans as strings,
+// like "False".
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "Expected a boolean, got %s", value)
+}
+
+func scimString(value json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "Expected a string, got %s", value)
+	}
+	return s, nil
+}
+
+// patchOperations checks a PATCH request and returns its operations with the
+// op lowercased. Operations without a path whose value sets several
+// attributes are split into one operation per attribute.
+func patchOperations(request models.SCIMPatchRequest) ([]models.SCIMPatchOperation, error) {
+	if len(request.Operations) == 0 {
+		return nil, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidSyntax, "No operations given")
+	}
+
+	var operations []models.SCIMPatchOperation
+	for _, op := range request.Operations {
+		op.Op = strings.ToLower(op.Op)
+		switch op.Op {
+		case "add", "replace", "remove":
+		default:
+			return nil, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidSyntax, "Unknown operation %q", op.Op)
+		}
+
+		if op.Path != "" {
+			operations = append(operations, op)
+			continue
+		}
+		if op.Op == "remove" {
+			return nil, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeNoTarget, "remove needs a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return nil, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "Operations without a path need an object value")
+		}
+		for attribute, value := range values {
+			operations = append(operations, models.SCIMPatchOperation{Op: op.Op, Path: attribute, Value: value})
+		}
+	}
+	return operations, nil
+}
+
+// extensionAttribute reports whether a path belongs to a schema extension,
+// such as the enterprise user. Those attributes aren't stored, and setting
+// them is ignored rather than failing the whole request.
+func extensionAttribute(path *scim.Path) bool {
+	return strings.HasPrefix(path.Attribute, "urn:")
+}
+
+func toSCIMUser(user models.User) models.SCIMUser {
+	displayName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	active := user.SuspendedAt == nil
+
+	groups := make([]models.SCIMRef, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		groups = append(groups, models.SCIMRef{
+			Value:   scimID(role.ID),
+			Ref:     scimLocation("Groups", role.ID),
+			Display: role.Name,
+		})
+	}
+
+	return models.SCIMUser{
+		Schemas:    []string{scim.SchemaUser},
+		ID:         scimID(user.ID),
+		ExternalID: user.ExternalID,
+		UserName:   user.Email,
+		Name: models.SCIMName{
+			Formatted:  displayName,
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		DisplayName: displayName,
+		Emails:      []models.SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      groups,
+		Meta: &models.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimLocation("Users", user.ID),
+		},
+	}
+}
+
+// findSCIMUser loads a user and their roles. Deleted users are gone as far
+// as SCIM is concerned.
+func findSCIMUser(id string) (*models.User, error) {
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, scim.Errorf(fiber.StatusNotFound, "", "User %s not found", id)
+	}
+
+	var user models.User
+	err = db.Preload("Roles").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, scim.Errorf(fiber.StatusNotFound, "", "User %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// applySCIMUser copies a SCIM user onto the account and checks the result.
+// userName is the account's email; the emails attribute is only used when
+// there is no userName. A password is checked but not set, since creating
+// and replacing a user store it differently.
+func applySCIMUser(user *models.User, resource *models.SCIMUser) error {
+	email := strings.TrimSpace(resource.UserName)
+	if email == "" {
+		for _, e := range resource.Emails {
+			if email == "" || e.Primary {
+				email = strings.TrimSpace(e.Value)
+			}
+		}
+	}
+	if err := validate.Var(email, "required,email"); err != nil {
+		return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "userName must be an email address")
+	}
+
+	if email != user.Email {
+		var taken int64
+		if err := db.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", email, user.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return scim.Errorf(fiber.StatusConflict, scim.ScimTypeUniqueness, "userName %s is already taken", email)
+		}
+	}
+
+	user.Email = email
+	user.FirstName = authn.TruncateName(strings.TrimSpace(resource.Name.GivenName))
+	user.LastName = authn.TruncateName(strings.TrimSpace(resource.Name.FamilyName))
+	user.ExternalID = resource.ExternalID
+
+	if resource.Active != nil {
+		switch {
+		case !*resource.Active && user.SuspendedAt == nil:
+			last, err := lastAdmin(db, user.ID)
+			if err != nil {
+				return err
+			}
+			if last {
+				return scim.Errorf(fiber.StatusConflict, "", "Cannot deactivate the last admin")
+			}
+			now := time.Now()
+			user.SuspendedAt = &now
+		case *resource.Active:
+			user.SuspendedAt = nil
+		}
+	}
+
+	if resource.Password != "" {
+		if violations := checkPassword(resource.Password, user); len(violations) > 0 {
+			messages := make([]string, len(violations))
+			for i, violation := range violations {
+				messages[i] = violation.Message
+			}
+			return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "%s", strings.Join(messages, "; "))
+		}
+	}
+
+	return nil
+}
+
+// saveSCIMUser stores a changed user. A deactivated user is signed out of
+// all sessions, which fails the request if it fails so the client retries.
+func saveSCIMUser(user *models.User, resource *models.SCIMUser) error {
+	var err error
+	if resource.Password != "" {
+		err = savePassword(user, resource.Password)
+	} else {
+		err = db.Omit(clause.Associations).Save(user).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if user.SuspendedAt != nil && resource.Active != nil && !*resource.Active {
+		return auth.RevokeUserSessions(context.Background(), user.ID, "")
+	}
+	return nil
+}
+
+// SCIMCreateUser godoc
+// @Summary Provision a user
+// @Description Create a user from a SCIM User resource. The email is treated as verified and the password is optional. Requires the SCIM bearer token.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param user body models.SCIMUser true "SCIM user"
+// @Success 201 {object} models.SCIMUser
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Users [post]
+func SCIMCreateUser(c *fiber.Ctx) error {
+	var resource models.SCIMUser
+	if err := parseSCIMBody(c, &resource); err != nil {
+		return scimError(c, err)
+	}
+
+	// Only the SCIM client can provision users, and it is trusted with the
+	// address
+	now := time.Now()
+	user := models.User{EmailVerifiedAt: &now}
+	if err := applySCIMUser(&user, &resource); err != nil {
+		return scimError(c, err)
+	}
+	if resource.Password != "" {
+		if err := user.SetPassword(resource.Password); err != nil {
+			return scimError(c, err)
+		}
+	}
+
+	if err := db.Create(&user).Error; err != nil {
+		if strings.Contains(err.Error(), "uni_users_email") {
+			return scimError(c, scim.Errorf(fiber.StatusConflict, scim.ScimTypeUniqueness, "userName %s is already taken", user.Email))
+		}
+		return scimError(c, err)
+	}
+
+	if err := assignDefaultRole(&user); err != nil {
+		log.Printf("Error assigning default role: %v", err)
+	}
+	if err := db.Model(&user).Association("Roles").Find(&user.Roles); err != nil {
+		return scimError(c, err)
+	}
+
+	c.Set(fiber.HeaderLocation, scimLocation("Users", user.ID))
+	return scimJSON(c, fiber.StatusCreated, toSCIMUser(user))
+}
+
+// SCIMGetUser godoc
+// @Summary Get a provisioned user
+// @Description Get a user as a SCIM User resource. Requires the SCIM bearer token.
+// @Tags scim
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.SCIMUser
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Router /scim/v2/Users/{id} [get]
+func SCIMGetUser(c *fiber.Ctx) error {
+	user, err := findSCIMUser(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, toSCIMUser(*user))
+}
+
+// SCIMListUsers godoc
+// @Summary List provisioned users
+// @Description List users as SCIM User resources. Filters can use id, userName, emails.value, name.givenName, name.familyName, externalId, active, meta.created and meta.lastModified. Requires the SCIM bearer token.
+// @Tags scim
+// @Produce json
+// @Param filter query string false "SCIM filter, e.g. userName eq \"jane@example.com\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Results per page (max 100)"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Users [get]
+func SCIMListUsers(c *fiber.Ctx) error {
+	query, err := scimQuery(c, db.Model(&models.User{}), scimUserAttributes)
+	if err != nil {
+		return scimError(c, err)
+	}
+	startIndex, count := scimPage(c)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return scimError(c, err)
+	}
+
+	var users []models.User
+	if count > 0 {
+		if err := query.Preload("Roles").Order("id").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+			return scimError(c, err)
+		}
+	}
+
+	resources := make([]models.SCIMUser, len(users))
+	for i, user := range users {
+		resources[i] = toSCIMUser(user)
+	}
+
+	return scimJSON(c, fiber.StatusOK, models.SCIMListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// SCIMReplaceUser godoc
+// @Summary Replace a provisioned user
+// @Description Replace a user's attributes. active=false suspends the user and signs them out everywhere. Requires the SCIM bearer token.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param user body models.SCIMUser true "SCIM user"
+// @Success 200 {object} models.SCIMUser
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Users/{id} [put]
+func SCIMReplaceUser(c *fiber.Ctx) error {
+	user, err := findSCIMUser(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	var resource models.SCIMUser
+	if err := parseSCIMBody(c, &resource); err != nil {
+		return scimError(c, err)
+	}
+	if err := applySCIMUser(user, &resource); err != nil {
+		return scimError(c, err)
+	}
+	if err := saveSCIMUser(user, &resource); err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, toSCIMUser(*user))
+}
+
+// SCIMPatchUser godoc
+// @Summary Update a provisioned user
+// @Description Apply SCIM PATCH operations to a user. active=false suspends the user and signs them out everywhere. Requires the SCIM bearer token.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body models.SCIMPatchRequest true "PATCH operations"
+// @Success 200 {object} models.SCIMUser
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Users/{id} [patch]
+func SCIMPatchUser(c *fiber.Ctx) error {
+	user, err := findSCIMUser(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	var request models.SCIMPatchRequest
+	if err := parseSCIMBody(c, &request); err != nil {
+		return scimError(c, err)
+	}
+	operations, err := patchOperations(request)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	// Operations edit the current resource, which is then stored like a PUT.
+	// active is left unset unless an operation changes it.
+	resource := toSCIMUser(*user)
+	resource.Active = nil
+	for _, op := range operations {
+		if err := patchSCIMUser(&resource, op); err != nil {
+			return scimError(c, err)
+		}
+	}
+
+	if err := applySCIMUser(user, &resource); err != nil {
+		return scimError(c, err)
+	}
+	if err := saveSCIMUser(user, &resource); err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, toSCIMUser(*user))
+}
+
+// patchSCIMUser applies one operation to a user resource.
+func patchSCIMUser(resource *models.SCIMUser, op models.SCIMPatchOperation) error {
+	path, err := scim.ParsePath(op.Path)
+	if err != nil {
+		return err
+	}
+	if path.Filter != nil && !strings.HasPrefix(path.Attribute, "emails") {
+		return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidPath, "%s cannot be filtered", path.Attribute)
+	}
+	remove := op.Op == "remove"
+
+	switch path.Attribute {
+	case "username", "active":
+		if remove {
+			return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeMutability, "%s cannot be removed", op.Path)
+		}
+		if path.Attribute == "active" {
+			active, err := scimBool(op.Value)
+			resource.Active = &active
+			return err
+		}
+		resource.UserName, err = scimString(op.Value)
+		return err
+
+	case "name":
+		if remove {
+			resource.Name = models.SCIMName{}
+			return nil
+		}
+		// Sub-attributes that aren't given keep their value
+		var name models.SCIMName
+		if err := json.Unmarshal(op.Value, &name); err != nil {
+			return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "name must be an object")
+		}
+		if name.GivenName != "" {
+			resource.Name.GivenName = name.GivenName
+		}
+		if name.FamilyName != "" {
+			resource.Name.FamilyName = name.FamilyName
+		}
+		return nil
+
+	case "name.givenname", "name.familyname", "externalid", "password":
+		var value string
+		if !remove {
+			if value, err = scimString(op.Value); err != nil {
+				return err
+			}
+		}
+		switch path.Attribute {
+		case "name.givenname":
+			resource.Name.GivenName = value
+		case "name.familyname":
+			resource.Name.FamilyName = value
+		case "externalid":
+			resource.ExternalID = value
+		case "password":
+			if remove {
+				return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeMutability, "password cannot be removed")
+			}
+			resource.Password = value
+		}
+		return nil
+
+	case "displayname", "name.formatted", "emails", "emails.value", "emails.type", "emails.primary":
+		// Derived from userName and the names. Clients send them along with
+		// those, so changes are accepted and ignored.
+		return nil
+
+	case "groups":
+		return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeMutability, "Group membership is changed through /Groups")
+	}
+
+	if extensionAttribute(path) {
+		return nil
+	}
+	return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidPath, "Unknown attribute %s", op.Path)
+}
+
+// SCIMDeleteUser godoc
+// @Summary Deprovision a user
+// @Description Permanently delete a user, along with their role memberships, and revoke all of their sessions. The userName can then be provisioned again. The last remaining admin cannot be deleted. Requires the SCIM bearer token.
+// @Tags scim
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Users/{id} [delete]
+func SCIMDeleteUser(c *fiber.Ctx) error {
+	user, err := findSCIMUser(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	last, err := lastAdmin(db, user.ID)
+	if err != nil {
+		return scimError(c, err)
+	}
+	if last {
+		return scimError(c, scim.Errorf(fiber.StatusConflict, "", "Cannot delete the last admin"))
+	}
+
+	// Sessions go first: if that fails the user still exists and the
+	// client retries the delete
+	if err := auth.RevokeUserSessions(context.Background(), user.ID, ""); err != nil {
+		return scimError(c, err)
+	}
+
+	// A soft delete would keep the email taken and the role links in place,
+	// so a deprovisioned user is removed for good
+	if err := db.Unscoped().Delete(&models.User{}, user.ID).Error; err != nil {
+		return scimError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SCIMServiceProviderConfig godoc
+// @Summary SCIM service provider configuration
+// @Description Describe the SCIM features this service supports. Requires the SCIM bearer token.
+// @Tags scim
+// @Produce json
+// @Success 200 {object} models.SCIMServiceProviderConfig
+// @Failure 401 {object} scim.Error
+// @Router /scim/v2/ServiceProviderConfig [get]
+func SCIMServiceProviderConfig(c *fiber.Ctx) error {
+	return scimJSON(c, fiber.StatusOK, models.SCIMServiceProviderConfig{
+		Schemas:        []string{scim.SchemaServiceProviderConfig},
+		Patch:          models.SCIMSupported{Supported: true},
+		Bulk:           models.SCIMBulkSupported{Supported: false},
+		Filter:         models.SCIMFilterSupported{Supported: true, MaxResults: maxSCIMPageSize},
+		ChangePassword: models.SCIMSupported{Supported: true},
+		Sort:           models.SCIMSupported{Supported: false},
+		ETag:           models.SCIMSupported{Supported: false},
+		AuthenticationSchemes: []models.SCIMAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Bearer token",
+			Description: "The SCIM token configured on the server",
+			Primary:     true,
+		}},
+	})
+}
@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/scim"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scimGroupAttributes are the group attributes lists can be filtered on.
+var scimGroupAttributes = map[string]scim.Attribute{
+	"id":          {Column: "id", Type: scim.ID},
+	"displayname": {Column: "name"},
+	"externalid":  {Column: "external_id", CaseExact: true},
+}
+
+// scimGroup is the part of a group SCIM clients can change. Groups are
+// roles: the display name is the role name and the members are the users
+// that have the role.
+type scimGroup struct {
+	DisplayName string
+	ExternalID  string
+	Members     []uint
+}
+
+// builtInRole reports whether a role is one the application itself relies
+// on. Those can't be renamed or deleted through SCIM.
+func builtInRole(name string) bool {
+	return name == models.RoleAdmin || name == models.RoleUser
+}
+
+// findSCIMGroup loads a role by its SCIM ID.
+func findSCIMGroup(id string) (*models.Role, error) {
+	roleID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, scim.Errorf(fiber.StatusNotFound, "", "Group %s not found", id)
+	}
+
+	var role models.Role
+	err = db.First(&role, roleID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, scim.Errorf(fiber.StatusNotFound, "", "Group %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// scimGroupMembers lists the users that have the role, leaving out deleted
+// users.
+func scimGroupMembers(role *models.Role) ([]models.User, error) {
+	var users []models.User
+	err := db.Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Where("user_roles.role_id = ?", role.ID).
+		Order("users.id").
+		Find(&users).Error
+	return users, err
+}
+
+// withMembers reports whether the client wants group members in the
+// response. Large groups are expensive to list, so clients exclude them.
+func withMembers(c *fiber.Ctx) bool {
+	return !strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+}
+
+// toSCIMGroup converts a role. Members are left out when nil.
+func toSCIMGroup(role models.Role, members []models.User) models.SCIMGroup {
+	group := models.SCIMGroup{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          scimID(role.ID),
+		ExternalID:  role.ExternalID,
+		DisplayName: role.Name,
+		Meta: &models.SCIMMeta{
+			ResourceType: "Group",
+			Created:      role.CreatedAt,
+			LastModified: role.UpdatedAt,
+			Location:     scimLocation("Groups", role.ID),
+		},
+	}
+
+	if members != nil {
+		group.Members = make([]models.SCIMRef, len(members))
+		for i, user := range members {
+			group.Members[i] = models.SCIMRef{
+				Value:   scimID(user.ID),
+				Ref:     scimLocation("Users", user.ID),
+				Display: user.Email,
+			}
+		}
+	}
+
+	return group
+}
+
+// respondWithSCIMGroup answers with the group, loading its members unless
+// they are excluded.
+func respondWithSCIMGroup(c *fiber.Ctx, status int, role *models.Role) error {
+	var members []models.User
+	if withMembers(c) {
+		var err error
+		if members, err = scimGroupMembers(role); err != nil {
+			return scimError(c, err)
+		}
+		if members == nil {
+			members = []models.User{}
+		}
+	}
+
+	return scimJSON(c, status, toSCIMGroup(*role, members))
+}
+
+// parseSCIMMembers reads member references as user IDs, without duplicates.
+func parseSCIMMembers(refs []models.SCIMRef) ([]uint, error) {
+	ids := make([]uint, 0, len(refs))
+	for _, ref := range refs {
+		id, err := strconv.ParseUint(ref.Value, 10, 64)
+		if err != nil {
+			return nil, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "Unknown member %q", ref.Value)
+		}
+		if !slices.Contains(ids, uint(id)) {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, nil
+}
+
+// saveSCIMGroup creates or updates the role and makes its members exactly
+// the given users. Role changes reach a member's access token when it is
+// next refreshed, as with roles assigned by an admin.
+func saveSCIMGroup(role *models.Role, group scimGroup) error {
+	group.DisplayName = strings.TrimSpace(group.DisplayName)
+	if group.DisplayName == "" || utf8.RuneCountInString(group.DisplayName) > 50 {
+		return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "displayName must be 1 to 50 characters")
+	}
+
+	if group.DisplayName != role.Name {
+		if role.ID != 0 && builtInRole(role.Name) {
+			return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeMutability, "The %s role cannot be renamed", role.Name)
+		}
+		var taken int64
+		if err := db.Model(&models.Role{}).Where("name = ? AND id <> ?", group.DisplayName, role.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return scim.Errorf(fiber.StatusConflict, scim.ScimTypeUniqueness, "displayName %s is already taken", group.DisplayName)
+		}
+	}
+
+	var current []models.User
+	if role.ID != 0 {
+		var err error
+		if current, err = scimGroupMembers(role); err != nil {
+			return err
+		}
+	}
+
+	var added []uint
+	for _, id := range group.Members {
+		if !slices.ContainsFunc(current, func(user models.User) bool { return user.ID == id }) {
+			added = append(added, id)
+		}
+	}
+	var removed []uint
+	for _, user := range current {
+		if !slices.Contains(group.Members, user.ID) {
+			removed = append(removed, user.ID)
+		}
+	}
+
+	if len(added) > 0 {
+		var found int64
+		if err := db.Model(&models.User{}).Where("id IN ?", added).Count(&found).Error; err != nil {
+			return err
+		}
+		if found != int64(len(added)) {
+			return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "Members must be existing users")
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		role.Name = group.DisplayName
+		role.ExternalID = group.ExternalID
+		if err := tx.Omit(clause.Associations).Save(role).Error; err != nil {
+			return err
+		}
+
+		// Only a change that takes away the last usable admin is refused
+		var adminsBefore int64
+		if role.Name == models.RoleAdmin && len(removed) > 0 {
+			if err := activeAdmins(tx).Count(&adminsBefore).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(removed) > 0 {
+			if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ? AND user_id IN ?", role.ID, removed).Error; err != nil {
+				return err
+			}
+		}
+		if len(added) > 0 {
+			rows := make([]map[string]interface{}, len(added))
+			for i, id := range added {
+				rows[i] = map[string]interface{}{"user_id": id, "role_id": role.ID}
+			}
+			if err := tx.Table("user_roles").Create(rows).Error; err != nil {
+				return err
+			}
+		}
+
+		if adminsBefore > 0 {
+			var admins int64
+			if err := activeAdmins(tx).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins == 0 {
+				return scim.Errorf(fiber.StatusConflict, "", "Cannot remove the last admin")
+			}
+		}
+		return nil
+	})
+}
+
+// SCIMCreateGroup godoc
+// @Summary Provision a group
+// @Description Create a role from a SCIM Group resource. The role grants no permissions until an admin adds them. Requires the SCIM bearer token.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param group body models.SCIMGroup true "SCIM group"
+// @Success 201 {object} models.SCIMGroup
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Groups [post]
+func SCIMCreateGroup(c *fiber.Ctx) error {
+	var resource models.SCIMGroup
+	if err := parseSCIMBody(c, &resource); err != nil {
+		return scimError(c, err)
+	}
+	members, err := parseSCIMMembers(resource.Members)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	var role models.Role
+	group := scimGroup{DisplayName: resource.DisplayName, ExternalID: resource.ExternalID, Members: members}
+	if err := saveSCIMGroup(&role, group); err != nil {
+		return scimError(c, err)
+	}
+
+	c.Set(fiber.HeaderLocation, scimLocation("Groups", role.ID))
+	return respondWithSCIMGroup(c, fiber.StatusCreated, &role)
+}
+
+// SCIMGetGroup godoc
+// @Summary Get a provisioned group
+// @Description Get a role as a SCIM Group resource. Requires the SCIM bearer token.
+// @Tags scim
+// @Produce json
+// @Param id path string true "Group ID"
+// @Param excludedAttributes query string false "members to leave out the members"
+// @Success 200 {object} models.SCIMGroup
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Groups/{id} [get]
+func SCIMGetGroup(c *fiber.Ctx) error {
+	role, err := findSCIMGroup(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return respondWithSCIMGroup(c, fiber.StatusOK, role)
+}
+
+// SCIMListGroups godoc
+// @Summary List provisioned groups
+// @Description List roles as SCIM Group resources. Filters can use id, displayName and externalId. Requires the SCIM bearer token.
+// @Tags scim
+// @Produce json
+// @Param filter query string false "SCIM filter, e.g. displayName eq \"engineering\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Results per page (max 100)"
+// @Param excludedAttributes query string false "members to leave out the members"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Groups [get]
+func SCIMListGroups(c *fiber.Ctx) error {
+	query, err := scimQuery(c, db.Model(&models.Role{}), scimGroupAttributes)
+	if err != nil {
+		return scimError(c, err)
+	}
+	startIndex, count := scimPage(c)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return scimError(c, err)
+	}
+
+	var roles []models.Role
+	if count > 0 {
+		if err := query.Order("id").Offset(startIndex - 1).Limit(count).Find(&roles).Error; err != nil {
+			return scimError(c, err)
+		}
+	}
+
+	resources := make([]models.SCIMGroup, len(roles))
+	for i := range roles {
+		var members []models.User
+		if withMembers(c) {
+			if members, err = scimGroupMembers(&roles[i]); err != nil {
+				return scimError(c, err)
+			}
+			if members == nil {
+				members = []models.User{}
+			}
+		}
+		resources[i] = toSCIMGroup(roles[i], members)
+	}
+
+	return scimJSON(c, fiber.StatusOK, models.SCIMListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// SCIMReplaceGroup godoc
+// @Summary Replace a provisioned group
+// @Description Replace a role's name and members. The admin and user roles cannot be renamed, and the last admin cannot be removed. Requires the SCIM bearer token.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "Group ID"
+// @Param group body models.SCIMGroup true "SCIM group"
+// @Success 200 {object} models.SCIMGroup
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Groups/{id} [put]
+func SCIMReplaceGroup(c *fiber.Ctx) error {
+	role, err := findSCIMGroup(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	var resource models.SCIMGroup
+	if err := parseSCIMBody(c, &resource); err != nil {
+		return scimError(c, err)
+	}
+	members, err := parseSCIMMembers(resource.Members)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	group := scimGroup{DisplayName: resource.DisplayName, ExternalID: resource.ExternalID, Members: members}
+	if err := saveSCIMGroup(role, group); err != nil {
+		return scimError(c, err)
+	}
+
+	return respondWithSCIMGroup(c, fiber.StatusOK, role)
+}
+
+// SCIMPatchGroup godoc
+// @Summary Update a provisioned group
+// @Description Apply SCIM PATCH operations to a role, typically adding or removing members. Requires the SCIM bearer token.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Param id path string true "Group ID"
+// @Param request body models.SCIMPatchRequest true "PATCH operations"
+// @Success 200 {object} models.SCIMGroup
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 409 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Groups/{id} [patch]
+func SCIMPatchGroup(c *fiber.Ctx) error {
+	role, err := findSCIMGroup(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	var request models.SCIMPatchRequest
+	if err := parseSCIMBody(c, &request); err != nil {
+		return scimError(c, err)
+	}
+	operations, err := patchOperations(request)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	members, err := scimGroupMembers(role)
+	if err != nil {
+		return scimError(c, err)
+	}
+	group := scimGroup{DisplayName: role.Name, ExternalID: role.ExternalID}
+	for _, user := range members {
+		group.Members = append(group.Members, user.ID)
+	}
+
+	for _, op := range operations {
+		if err := patchSCIMGroup(&group, op); err != nil {
+			return scimError(c, err)
+		}
+	}
+
+	if err := saveSCIMGroup(role, group); err != nil {
+		return scimError(c, err)
+	}
+
+	return respondWithSCIMGroup(c, fiber.StatusOK, role)
+}
+
+// patchSCIMGroup applies one operation to a group. Members can be removed
+// by filter, as in members[value eq "2"], or by listing them in the value.
+func patchSCIMGroup(group *scimGroup, op models.SCIMPatchOperation) error {
+	path, err := scim.ParsePath(op.Path)
+	if err != nil {
+		return err
+	}
+	if path.Filter != nil && (path.Attribute != "members" || op.Op != "remove") {
+		return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidPath, "Filters can only be used to remove members")
+	}
+	remove := op.Op == "remove"
+
+	switch path.Attribute {
+	case "displayname":
+		if remove {
+			return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeMutability, "displayName cannot be removed")
+		}
+		group.DisplayName, err = scimString(op.Value)
+		return err
+
+	case "externalid":
+		if remove {
+			group.ExternalID = ""
+			return nil
+		}
+		group.ExternalID, err = scimString(op.Value)
+		return err
+
+	case "members":
+		var refs []models.SCIMRef
+		if len(op.Value) > 0 && string(op.Value) != "null" {
+			if err := json.Unmarshal(op.Value, &refs); err != nil {
+				return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidValue, "members must be a list")
+			}
+		}
+		ids, err := parseSCIMMembers(refs)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case remove && path.Filter != nil:
+			group.Members = slices.DeleteFunc(group.Members, func(id uint) bool {
+				return scim.Matches(path.Filter, map[string]string{"value": scimID(id)})
+			})
+		case remove && len(ids) > 0:
+			group.Members = slices.DeleteFunc(group.Members, func(id uint) bool {
+				return slices.Contains(ids, id)
+			})
+		case remove:
+			group.Members = nil
+		case op.Op == "replace":
+			group.Members = ids
+		default:
+			for _, id := range ids {
+				if !slices.Contains(group.Members, id) {
+					group.Members = append(group.Members, id)
+				}
+			}
+		}
+		return nil
+	}
+
+	if extensionAttribute(path) {
+		return nil
+	}
+	return scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeInvalidPath, "Unknown attribute %s", op.Path)
+}
+
+// SCIMDeleteGroup godoc
+// @Summary Delete a provisioned group
+// @Description Delete a role, taking it from all of its members. The admin and user roles cannot be deleted. Requires the SCIM bearer token.
+// @Tags scim
+// @Param id path string true "Group ID"
+// @Success 204
+// @Failure 400 {object} scim.Error
+// @Failure 401 {object} scim.Error
+// @Failure 404 {object} scim.Error
+// @Failure 500 {object} scim.Error
+// @Router /scim/v2/Groups/{id} [delete]
+func SCIMDeleteGroup(c *fiber.Ctx) error {
+	role, err := findSCIMGroup(c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	if builtInRole(role.Name) {
+		return scimError(c, scim.Errorf(fiber.StatusBadRequest, scim.ScimTypeMutability, "The %s role cannot be deleted", role.Name))
+	}
+
+	// Memberships and permissions go with the role
+	if err := db.Delete(role).Error; err != nil {
+		return scimError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
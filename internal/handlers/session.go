@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSessions godoc
+// @Summary List active sessions
+// @Description List the authenticated user's active sessions across all devices
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.SessionsResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /sessions [get]
+func GetSessions(c *fiber.Ctx) error {
+	userId := c.Locals("user_id").(float64)
+	currentSessionId := c.Locals("session_id").(string)
+
+	sessions, err := auth.ListSessions(context.Background(), uint(userId))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not fetch sessions",
+		})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionId
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.SessionsResponse{
+		Items: sessions,
+	})
+}
+
+// DeleteSession godoc
+// @Summary Revoke a session
+// @Description Sign out one of the authenticated user's sessions
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 404 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /sessions/{id} [delete]
+func DeleteSession(c *fiber.Ctx) error {
+	userId := c.Locals("user_id").(float64)
+
+	err := auth.RevokeUserSession(context.Background(), uint(userId), c.Params("id"))
+	if err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not revoke session",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeAllSessions godoc
+// @Summary Log out everywhere
+// @Description Revoke every session of the authenticated user, including the current one
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /sessions/revoke_all [post]
+func RevokeAllSessions(c *fiber.Ctx) error {
+	userId := c.Locals("user_id").(float64)
+
+	if err := auth.RevokeUserSessions(context.Background(), uint(userId), ""); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not revoke sessions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "All sessions revoked successfully",
+	})
+}
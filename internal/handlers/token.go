@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access/refresh token pair. Each refresh token can be used only once; reusing one revokes the whole session. With cookie sessions the refresh token is read from its cookie when the body doesn't contain one, and the session's CSRF token must then be sent in X-CSRF-Token.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /token/refresh [post]
+func RefreshToken(c *fiber.Ctx) error {
+	var request models.RefreshTokenRequest
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	fromCookie := false
+	if request.RefreshToken == "" && cfg.Cookie.Enabled {
+		request.RefreshToken = c.Cookies(middleware.RefreshCookie)
+		fromCookie = request.RefreshToken != ""
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx := context.Background()
+
+	// The browser attaches the cookie to cross-site requests too, so they
+	// must prove they come from the frontend before the token is used up
+	if fromCookie {
+		sessionID, err := auth.RefreshTokenSession(ctx, request.RefreshToken)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidRefreshToken) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not refresh token",
+			})
+		}
+		if !middleware.ValidCSRFToken(c, sessionID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid or missing CSRF token",
+			})
+		}
+	}
+
+	tokens, err := auth.Refresh(ctx, request.RefreshToken, middleware.SessionMetadata(c))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not refresh token",
+		})
+	}
+
+	return respondWithTokens(c, fiber.StatusOK, tokens)
+}
+
+// respondWithTokens sends a new token pair to the client: in the body, or in
+// cookies when cookie sessions are enabled, in which case the body only
+// carries the session's CSRF token.
+func respondWithTokens(c *fiber.Ctx, status int, tokens *models.TokenResponse) error {
+	if !cfg.Cookie.Enabled {
+		return c.Status(status).JSON(tokens)
+	}
+
+	csrfToken, err := middleware.SetSessionCookies(c, tokens)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+
+	return c.Status(status).JSON(models.CookieSessionResponse{
+		CSRFToken: csrfToken,
+		ExpiresIn: tokens.ExpiresIn,
+	})
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"context"
-	"go-auth-boilerplate/internal/database"
+	"errors"
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/authn"
 	"go-auth-boilerplate/internal/middleware"
 	"go-auth-boilerplate/internal/models"
 	"log"
@@ -10,15 +13,18 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
 	"gorm.io/gorm"
 )
 
 var (
+	cfg      *config.Config
 	db       *gorm.DB
 	redisURL string
 )
 
-func InitHandlers(database *gorm.DB, redis string) {
+func InitHandlers(config *config.Config, database *gorm.DB, redis string) {
+	cfg = config
 	db = database
 	redisURL = redis
 }
@@ -32,8 +38,10 @@ var validate = validator.New()
 // @Accept json
 // @Produce json
 // @Param user body models.User true "User registration info"
-// @Success 201 {object} models.UserResponse
+// @Success 201 {object} models.TokenResponse
+// @Success 201 {object} models.CookieSessionResponse
 // @Failure 400 {object} models.APIResponse
+// @Failure 400 {object} models.PasswordPolicyErrorResponse
 // @Failure 500 {object} models.APIResponse
 // @Router /user/signup [post]
 func SignUp(c *fiber.Ctx) error {
@@ -51,10 +59,26 @@ func SignUp(c *fiber.Ctx) error {
 		})
 	}
 
+	if violations := checkPassword(user.Password, &user); len(violations) > 0 {
+		return passwordRejected(c, violations)
+	}
+
+	if err := user.SetPassword(user.Password); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create user",
+		})
+	}
+
 	result := db.Create(&user)
 	if result.Error != nil {
 		// Check for duplicate email error
 		if strings.Contains(result.Error.Error(), "uni_users_email") {
+			recordAudit(c, models.AuditEvent{
+				Action:  models.AuditSignUp,
+				Outcome: models.AuditFailure,
+				Reason:  "email_taken",
+				Email:   user.Email,
+			})
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Email already registered",
 			})
@@ -64,29 +88,51 @@ func SignUp(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT token
-	token, err := middleware.CreateToken(user.ID)
+	if err := assignDefaultRole(&user); err != nil {
+		log.Printf("Error assigning default role: %v", err)
+	}
+
+	actorId := user.ID
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditSignUp,
+		Outcome: models.AuditSuccess,
+		ActorID: &actorId,
+		Email:   user.Email,
+	}, models.AuditTargetUser, user.ID))
+
+	// Reserve the resend slot so a resend right after signup is throttled
+	if _, err := auth.ReserveVerificationEmail(context.Background(), user.ID); err != nil {
+		log.Printf("Error throttling verification email: %v", err)
+	}
+	go sendVerificationEmail(user)
+
+	// Generate JWT tokens
+	tokens, err := middleware.CreateToken(c, user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not generate token",
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"token": token,
-	})
+	return respondWithTokens(c, fiber.StatusCreated, tokens)
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Login with email and password
+// @Description Login with email and password. If two-factor authentication is enabled, an MFA token is returned instead and must be exchanged at /user/login/mfa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body models.LoginRequest true "Login credentials"
-// @Success 200 {object} models.APIResponse
+// @Success 200 {object} models.TokenResponse
+// @Success 200 {object} models.CookieSessionResponse
+// @Success 200 {object} models.MFAChallengeResponse
 // @Failure 400 {object} models.APIResponse
 // @Failure 401 {object} models.APIResponse
+// @Failure 403 {object} models.APIResponse
+// @Failure 403 {object} models.PasswordExpiredResponse
+// @Failure 423 {object} models.APIResponse
+// @Failure 429 {object} models.APIResponse
 // @Router /user/login [post]
 func Login(c *fiber.Ctx) error {
 	var loginData struct {
@@ -106,34 +152,67 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	var user models.User
-	if err := db.Where("email = ?", loginData.Email).First(&user).Error; err != nil {
-		log.Printf("User not found: %v", err)
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+	ctx := context.Background()
+	throttle, err := auth.CheckLoginAllowed(ctx, loginData.Email, c.IP())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
 		})
 	}
+	if throttle != nil {
+		recordLoginFailure(c, loginData.Email, "throttled")
+		return loginThrottled(c, throttle)
+	}
 
-	log.Printf("Found user: ID=%d, Email=%s, Password=%s", user.ID, user.Email, user.Password)
-	log.Printf("Attempting to compare password: %s", loginData.Password)
+	result, err := authn.Authenticate(ctx, loginData.Email, loginData.Password)
+	if err != nil {
+		if errors.Is(err, authn.ErrInvalidCredentials) {
+			if err := auth.RecordLoginFailure(ctx, loginData.Email, c.IP()); err != nil {
+				log.Printf("Error recording failed login: %v", err)
+			}
+			recordLoginFailure(c, loginData.Email, "invalid_credentials")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid credentials",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not create session",
+		})
+	}
+	user := result.User
 
-	if err := user.ComparePassword(loginData.Password); err != nil {
-		log.Printf("Password comparison failed: %v", err)
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+	if user.SuspendedAt != nil {
+		recordLoginFailure(c, user.Email, "account_suspended")
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account suspended",
 		})
 	}
 
-	token, err := middleware.CreateToken(user.ID)
+	// Failures are only cleared once the second factor is verified too, so
+	// an attacker who knows the password can't use it to reset the count
+	if user.TOTPEnabledAt != nil {
+		return mfaChallenge(c, user, result.Backend == authn.BackendDatabase)
+	}
+
+	if err := auth.ClearLoginFailures(ctx, user.Email); err != nil {
+		log.Printf("Error clearing failed logins: %v", err)
+	}
+
+	// Directory passwords expire under the directory's own policy
+	if result.Backend == authn.BackendDatabase && user.PasswordExpired(cfg.Password.MaxAge) {
+		recordLoginFailure(c, user.Email, "password_expired")
+		return passwordExpired(c, user)
+	}
+
+	tokens, err := middleware.CreateToken(c, user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not create session",
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"token": token,
-	})
+	recordLoginSuccess(c, user)
+	return respondWithTokens(c, fiber.StatusOK, tokens)
 }
 
 // Logout godoc
@@ -144,22 +223,46 @@ func Login(c *fiber.Ctx) error {
 // @Success 200 {object} models.APIResponse
 // @Router /user/logout [post]
 func Logout(c *fiber.Ctx) error {
-	token := c.Get("Authorization")
-	if token != "" {
-		token = strings.TrimPrefix(token, "Bearer ")
+	// Personal access tokens aren't sessions; they are revoked through the
+	// tokens API instead
+	var loggedOut []string
+	token := middleware.ExtractBearerToken(c)
+	if token != "" && !auth.IsPersonalAccessToken(token) {
 		ctx := context.Background()
-		if err := database.RedisClient.Del(ctx, token).Err(); err != nil {
+		if err := auth.RevokeToken(ctx, token); err != nil {
 			log.Printf("Error deleting session from Redis: %v", err)
 		}
+		loggedOut = append(loggedOut, token)
 	}
 
-	cookieToken := c.Cookies("session")
+	cookieToken := c.Cookies(middleware.SessionCookieName())
 	if cookieToken != "" {
 		ctx := context.Background()
-		database.RedisClient.Del(ctx, cookieToken)
+		if err := auth.RevokeToken(ctx, cookieToken); err != nil {
+			log.Printf("Error deleting session from Redis: %v", err)
+		}
+		loggedOut = append(loggedOut, cookieToken)
 	}
 
-	c.ClearCookie("session")
+	// The route isn't protected, so the user is known from the token alone.
+	// Expired tokens are accepted here as they are by RevokeToken.
+	for _, token := range loggedOut {
+		claims, err := auth.ParseAccessToken(token, jwt.WithoutClaimsValidation())
+		if err != nil {
+			continue
+		}
+		if userId, ok := claims["user_id"].(float64); ok {
+			actorId := uint(userId)
+			recordAudit(c, auditTarget(models.AuditEvent{
+				Action:  models.AuditLogout,
+				Outcome: models.AuditSuccess,
+				ActorID: &actorId,
+			}, models.AuditTargetUser, actorId))
+			break
+		}
+	}
+
+	middleware.ClearSessionCookies(c)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Successfully logged out",
 	})
@@ -175,13 +278,14 @@ func Logout(c *fiber.Ctx) error {
 // @Param passwords body models.PasswordUpdateRequest true "Password update data"
 // @Success 200 {object} models.APIResponse
 // @Failure 400 {object} models.APIResponse
+// @Failure 400 {object} models.PasswordPolicyErrorResponse
 // @Failure 401 {object} models.APIResponse
 // @Failure 500 {object} models.APIResponse
 // @Router /user/update_password [patch]
 func UpdatePassword(c *fiber.Ctx) error {
 	var passwordData struct {
 		CurrentPassword string `json:"current_password" validate:"required"`
-		NewPassword     string `json:"new_password" validate:"required,min=6"`
+		NewPassword     string `json:"new_password" validate:"required"`
 	}
 
 	if err := c.BodyParser(&passwordData); err != nil {
@@ -205,18 +309,37 @@ func UpdatePassword(c *fiber.Ctx) error {
 	}
 
 	if err := user.ComparePassword(passwordData.CurrentPassword); err != nil {
+		recordAudit(c, auditTarget(models.AuditEvent{
+			Action:  models.AuditPasswordChange,
+			Outcome: models.AuditFailure,
+			Reason:  "invalid_current_password",
+		}, models.AuditTargetUser, user.ID))
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid current password",
 		})
 	}
 
-	user.Password = passwordData.NewPassword
-	if err := db.Save(&user).Error; err != nil {
+	if violations := checkPassword(passwordData.NewPassword, &user); len(violations) > 0 {
+		return passwordRejected(c, violations)
+	}
+
+	if err := savePassword(&user, passwordData.NewPassword); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not update password",
 		})
 	}
 
+	// Sign out every other device; the current session stays valid
+	sessionId := c.Locals("session_id").(string)
+	if err := auth.RevokeUserSessions(context.Background(), user.ID, sessionId); err != nil {
+		log.Printf("Error deleting sessions from Redis: %v", err)
+	}
+
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditPasswordChange,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetUser, user.ID))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Password updated successfully",
 	})
@@ -242,13 +365,15 @@ func GetSession(c *fiber.Ctx) error {
 	}
 
 	userResponse := models.UserResponse{
-		ID:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Age:       user.Age,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:              user.ID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Age:             user.Age,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		MFAEnabled:      user.TOTPEnabledAt != nil,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
 	}
 
 	return c.Status(fiber.StatusOK).JSON(userResponse)
@@ -256,33 +381,50 @@ func GetSession(c *fiber.Ctx) error {
 
 // DeleteUser godoc
 // @Summary Delete user account
-// @Description Delete the authenticated user's account
+// @Description Delete the authenticated user's account. The last remaining admin cannot delete their account.
 // @Tags user
 // @Produce json
 // @Security ApiKeyAuth
 // @Success 200 {object} models.APIResponse
 // @Failure 401 {object} models.APIResponse
 // @Failure 404 {object} models.APIResponse
+// @Failure 409 {object} models.APIResponse
 // @Failure 500 {object} models.APIResponse
 // @Router /user [delete]
 func DeleteUser(c *fiber.Ctx) error {
 	userId := c.Locals("user_id").(float64)
 
-	token := c.Get("Authorization")
-	if token != "" {
-		token = strings.TrimPrefix(token, "Bearer ")
-		ctx := context.Background()
-		if err := database.RedisClient.Del(ctx, token).Err(); err != nil {
-			log.Printf("Error deleting session from Redis: %v", err)
-		}
+	last, err := lastAdmin(db, uint(userId))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not delete user",
+		})
+	}
+	if last {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Cannot delete the last admin",
+		})
 	}
 
-	if err := db.Delete(&models.User{}, uint(userId)).Error; err != nil {
+	ctx := context.Background()
+	if err := auth.RevokeUserSessions(ctx, uint(userId), ""); err != nil {
+		log.Printf("Error deleting sessions from Redis: %v", err)
+	}
+
+	// Closing your own account always removes it; soft deletion is reserved
+	// for admins
+	if err := db.Unscoped().Delete(&models.User{}, uint(userId)).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not delete user",
 		})
 	}
 
+	// The event keeps the account's ID after the account is gone
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditUserDelete,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetUser, uint(userId)))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User deleted successfully",
 	})
@@ -346,6 +488,11 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	recordAudit(c, auditTarget(models.AuditEvent{
+		Action:  models.AuditUserUpdate,
+		Outcome: models.AuditSuccess,
+	}, models.AuditTargetUser, user.ID))
+
 	return c.JSON(fiber.Map{
 		"message": "User updated successfully",
 		"user": fiber.Map{
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/mailer"
+	"go-auth-boilerplate/internal/models"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func sendVerificationEmail(user models.User) {
+	token, err := auth.CreateEmailVerificationToken(user.ID, user.Email)
+	if err != nil {
+		log.Printf("Error creating email verification token: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", cfg.Server.AppURL, url.QueryEscape(token))
+	err = mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.FirstName, cfg.Auth.EmailVerificationExpiry, link),
+	})
+	if err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the user's email address with the token from the verification email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/verify_email [post]
+func VerifyEmail(c *fiber.Ctx) error {
+	var request models.VerifyEmailRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId, email, err := auth.ParseEmailVerificationToken(request.Token)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, userId).Error; err != nil || user.Email != email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := db.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not verify email",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerificationEmail godoc
+// @Summary Resend verification email
+// @Description Send a new verification email to the authenticated user. Limited to one email per resend interval.
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} models.APIResponse
+// @Failure 400 {object} models.APIResponse
+// @Failure 401 {object} models.APIResponse
+// @Failure 429 {object} models.APIResponse
+// @Failure 500 {object} models.APIResponse
+// @Router /user/verify_email/resend [post]
+func ResendVerificationEmail(c *fiber.Ctx) error {
+	userId := c.Locals("user_id").(float64)
+	var user models.User
+	if err := db.First(&user, uint(userId)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email already verified",
+		})
+	}
+
+	retryAfter, err := auth.ReserveVerificationEmail(context.Background(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not send verification email",
+		})
+	}
+	if retryAfter > 0 {
+		setRetryAfter(c, retryAfter)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Verification email was sent recently, please try again later",
+		})
+	}
+
+	go sendVerificationEmail(user)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
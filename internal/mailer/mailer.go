@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"go-auth-boilerplate/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers outgoing email. Implementations must be safe for
+// concurrent use.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	sender Sender = LogSender{}
+	mu     sync.RWMutex
+)
+
+// Init selects the sender configured by cfg.Driver: "smtp", "memory" or
+// "log" (the default, which only writes messages to the application log).
+func Init(cfg config.MailConfig) error {
+	switch cfg.Driver {
+	case "smtp":
+		SetSender(&SMTPSender{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		})
+	case "memory":
+		SetSender(&MemorySender{})
+	case "log", "":
+		SetSender(LogSender{})
+	default:
+		return fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+	return nil
+}
+
+func SetSender(s Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+	sender = s
+}
+
+func Send(ctx context.Context, msg Message) error {
+	mu.RLock()
+	s := sender
+	mu.RUnlock()
+	return s.Send(ctx, msg)
+}
+
+// LogSender writes messages to the application log instead of sending them.
+// Useful in development where no mail server is available.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("\n=== Email ===\nTo: %s\nSubject: %s\n\n%s\n=============\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{msg.To}, []byte(b.String()))
+}
+
+// MemorySender keeps sent messages in memory so tests can inspect them.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *MemorySender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns every message sent to the given address, oldest first.
+func (s *MemorySender) Messages(to string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []Message
+	for _, msg := range s.messages {
+		if msg.To == to {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// Last returns the most recent message sent to the given address.
+func (s *MemorySender) Last(to string) (Message, bool) {
+	messages := s.Messages(to)
+	if len(messages) == 0 {
+		return Message{}, false
+	}
+	return messages[len(messages)-1], true
+}
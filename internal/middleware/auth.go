@@ -2,72 +2,152 @@ package middleware
 
 import (
 	"context"
+	"go-auth-boilerplate/internal/auth"
 	"go-auth-boilerplate/internal/database"
-	"os"
+	"go-auth-boilerplate/internal/models"
+	"log"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// Protected authenticates the request with a session access token, a
+// personal access token or an access token issued to an OAuth client.
+// Requests made with either of the latter carry the token's scopes in the
+// "scopes" local; see RequireScope. When cookie sessions are
+// enabled the access token may come from the session cookie instead, and
+// state-changing requests must then carry the session's CSRF token.
 func Protected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get token from Authorization header
+		// Get token from Authorization header, falling back to the cookie
 		token := ExtractBearerToken(c)
+		fromCookie := false
+		if token == "" {
+			token = sessionCookieToken(c)
+			fromCookie = token != ""
+		}
 		if token == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Unauthorized - No token provided",
 			})
 		}
 
-		// Verify token in Redis
-		ctx := context.Background()
-		val, err := database.RedisClient.Get(ctx, token).Result()
-		if err != nil || val == "" {
+		var userId uint
+		var sessionId string
+		if !fromCookie && auth.IsPersonalAccessToken(token) {
+			pat, err := auth.AuthenticatePersonalAccessToken(context.Background(), token)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired access token",
+				})
+			}
+
+			userId = pat.UserID
+			c.Locals("roles", []string{})
+			c.Locals("scopes", pat.ScopeList())
+			c.Locals("access_token_id", pat.ID)
+		} else if !fromCookie && auth.IsOAuthAccessToken(token) {
+			grant, err := auth.AuthenticateOAuthAccessToken(context.Background(), token)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired access token",
+				})
+			}
+
+			// Client credentials tokens have no user to act as
+			if grant.UserID == 0 {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "This endpoint requires a token issued for a user",
+				})
+			}
+
+			userId = grant.UserID
+			c.Locals("roles", []string{})
+			c.Locals("scopes", grant.Scopes)
+			c.Locals("oauth_client_id", grant.ClientID)
+		} else {
+			// Parse the JWT token
+			claims, err := auth.ParseAccessToken(token)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid token",
+				})
+			}
+
+			// Verify the session is still active in Redis
+			claimedUserId, _ := claims["user_id"].(float64)
+			userId = uint(claimedUserId)
+			sessionId, _ = claims["sid"].(string)
+			active, err := auth.SessionActive(context.Background(), sessionId, userId)
+			if err != nil || !active {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid or expired session",
+				})
+			}
+
+			if fromCookie && !ValidCSRFToken(c, sessionId) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Invalid or missing CSRF token",
+				})
+			}
+
+			c.Locals("roles", rolesFromClaims(claims))
+		}
+
+		// Deleted and suspended accounts lose access even if they still hold
+		// a valid session or access token
+		var user models.User
+		if err := database.DB.Select("id", "suspended_at").First(&user, userId).Error; err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid or expired session",
 			})
 		}
-
-		// Parse the JWT token
-		tokenObj, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err != nil || !tokenObj.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
+		if user.SuspendedAt != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account suspended",
 			})
 		}
 
-		// Get claims
-		claims := tokenObj.Claims.(jwt.MapClaims)
-		c.Locals("user_id", claims["user_id"])
+		if sessionId != "" {
+			if err := auth.TouchSession(context.Background(), sessionId, SessionMetadata(c)); err != nil {
+				log.Printf("Error updating session activity: %v", err)
+			}
+		}
+
+		c.Locals("user_id", float64(userId))
+		c.Locals("session_id", sessionId)
 
 		return c.Next()
 	}
 }
 
-func CreateToken(userId uint) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = userId
-	claims["exp"] = time.Now().Add(24 * time.Hour).Unix()
-
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		return "", err
+func rolesFromClaims(claims jwt.MapClaims) []string {
+	values, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(values))
+	for _, value := range values {
+		if role, ok := value.(string); ok {
+			roles = append(roles, role)
+		}
 	}
+	return roles
+}
 
-	// Store in Redis
-	ctx := context.Background()
-	err = database.RedisClient.Set(ctx, t, userId, 24*time.Hour).Err()
-	if err != nil {
-		return "", err
-	}
+// CreateToken starts a new session for the user on the requesting device and
+// returns the access and refresh tokens for it.
+func CreateToken(c *fiber.Ctx, userId uint) (*models.TokenResponse, error) {
+	return auth.IssueTokens(context.Background(), userId, SessionMetadata(c))
+}
 
-	return t, nil
+// SessionMetadata describes the client behind the request. Clients may name
+// themselves with the X-Device-Name header so users can tell their sessions
+// apart.
+func SessionMetadata(c *fiber.Ctx) auth.SessionMetadata {
+	return auth.SessionMetadata{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Device:    c.Get("X-Device-Name"),
+	}
 }
 
 func ExtractBearerToken(c *fiber.Ctx) string {
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// CSRFHeader carries the CSRF token on state-changing requests
+	// authenticated with the session cookie.
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFCookie holds a copy of the CSRF token that the frontend can read
+	// after a page reload.
+	CSRFCookie    = "csrf_token"
+	RefreshCookie = "refresh_token"
+)
+
+var (
+	sessionCookie config.SessionCookieConfig
+	cookieExpiry  time.Duration
+)
+
+// InitSessionCookies configures the cookies set by SetSessionCookies and
+// whether Protected accepts them.
+func InitSessionCookies(cfg *config.Config) {
+	sessionCookie = cfg.Cookie
+	cookieExpiry = cfg.JWT.SessionExpiry
+}
+
+// SessionCookieName returns the name of the cookie holding the access token.
+func SessionCookieName() string {
+	return sessionCookie.Name
+}
+
+// SetSessionCookies stores a token pair in cookies and returns the CSRF token
+// of its session. The access and refresh tokens are HttpOnly so scripts can't
+// read them; the refresh token is only sent to the refresh endpoint.
+func SetSessionCookies(c *fiber.Ctx, tokens *models.TokenResponse) (string, error) {
+	csrfToken, err := auth.SessionCSRFToken(context.Background(), tokens.SessionID)
+	if err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(cookieExpiry)
+	c.Cookie(newCookie(sessionCookie.Name, tokens.Token, "/api/v1", expires, true))
+	c.Cookie(newCookie(RefreshCookie, tokens.RefreshToken, "/api/v1/token", expires, true))
+	c.Cookie(newCookie(CSRFCookie, csrfToken, "/", expires, false))
+	return csrfToken, nil
+}
+
+// ClearSessionCookies removes the cookies set by SetSessionCookies.
+func ClearSessionCookies(c *fiber.Ctx) {
+	expired := time.Unix(0, 0)
+	c.Cookie(newCookie(sessionCookie.Name, "", "/api/v1", expired, true))
+	c.Cookie(newCookie(RefreshCookie, "", "/api/v1/token", expired, true))
+	c.Cookie(newCookie(CSRFCookie, "", "/", expired, false))
+}
+
+func newCookie(name, value, path string, expires time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   sessionCookie.Domain,
+		Expires:  expires,
+		Secure:   sessionCookie.Secure,
+		HTTPOnly: httpOnly,
+		SameSite: sessionCookie.SameSite,
+	}
+}
+
+// FlowCookie returns an HttpOnly cookie for the state of a login that
+// passes through another site, such as an identity provider or an email
+// link. It follows the session cookie settings, except that SameSite=Strict
+// becomes Lax so the cookie comes back on the cross-site redirect.
+func FlowCookie(name, value, path string, expires time.Time) *fiber.Cookie {
+	cookie := newCookie(name, value, path, expires, true)
+	if strings.EqualFold(cookie.SameSite, fiber.CookieSameSiteStrictMode) {
+		cookie.SameSite = fiber.CookieSameSiteLaxMode
+	}
+	return cookie
+}
+
+// sessionCookieToken returns the access token from the session cookie, or an
+// empty string if cookie sessions are disabled or the cookie isn't set.
+func sessionCookieToken(c *fiber.Ctx) string {
+	if !sessionCookie.Enabled {
+		return ""
+	}
+	return c.Cookies(sessionCookie.Name)
+}
+
+// ValidCSRFToken reports whether a cookie-authenticated request may go on.
+// Safe methods never need a token; all others must send the session's CSRF
+// token in the X-CSRF-Token header, which a cross-site form or script can't
+// do.
+func ValidCSRFToken(c *fiber.Ctx, sessionId string) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+
+	sent := c.Get(CSRFHeader)
+	if sent == "" {
+		return false
+	}
+
+	expected, err := auth.SessionCSRFToken(context.Background(), sessionId)
+	if err != nil || expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"go-auth-boilerplate/internal/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission rejects users whose roles don't grant the permission. It
+// must run after Protected. Roles come from the access token, so a role that
+// was just assigned or removed applies once the client refreshes its token.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roles, _ := c.Locals("roles").([]string)
+
+		allowed, err := auth.RolesHavePermission(roles, permission)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Could not check permissions",
+			})
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"go-auth-boilerplate/internal/scim"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SCIMAuth admits requests that carry the configured SCIM bearer token.
+// Errors use the SCIM error envelope, since only provisioning clients call
+// these routes. With no token configured the API doesn't exist.
+func SCIMAuth(token string) fiber.Handler {
+	expected := sha256.Sum256([]byte(token))
+
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return c.Status(fiber.StatusNotFound).JSON(
+				scim.Errorf(fiber.StatusNotFound, "", "SCIM provisioning is not enabled"), scim.ContentType)
+		}
+
+		// Hashing first keeps the comparison constant-time whatever the length
+		actual := sha256.Sum256([]byte(ExtractBearerToken(c)))
+		if subtle.ConstantTimeCompare(actual[:], expected[:]) != 1 {
+			c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+			return c.Status(fiber.StatusUnauthorized).JSON(
+				scim.Errorf(fiber.StatusUnauthorized, "", "Invalid or missing bearer token"), scim.ContentType)
+		}
+
+		return c.Next()
+	}
+}
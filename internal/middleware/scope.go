@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope limits requests made with a personal or OAuth access token to
+// tokens granted the scope. Session-authenticated requests have full access
+// and are always let through. It must run after Protected.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, isAccessToken := c.Locals("scopes").([]string)
+		if isAccessToken && !slices.Contains(scopes, scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access token is missing the " + scope + " scope",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// SessionOnly rejects requests made with a personal or OAuth access token.
+// Routes that manage the account itself, like changing the password or
+// minting new tokens, require a real login. It must run after Protected.
+func SessionOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, isAccessToken := c.Locals("scopes").([]string); isAccessToken {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This endpoint cannot be used with an access token",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireVerifiedEmail rejects users who haven't confirmed their email
+// address yet. It must run after Protected. When enabled is false it lets
+// every request through, so routes can be wired the same way regardless of
+// configuration.
+func RequireVerifiedEmail(enabled bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !enabled {
+			return c.Next()
+		}
+
+		userId := c.Locals("user_id").(float64)
+		var user models.User
+		if err := database.DB.Select("id", "email_verified_at").First(&user, uint(userId)).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+
+		if user.EmailVerifiedAt == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Email address not verified",
+			})
+		}
+
+		return c.Next()
+	}
+}
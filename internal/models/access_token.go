@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Scopes a personal access token can be granted. Requests authenticated with
+// a token may only use routes that accept one of its scopes.
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+	ScopeUserRead   = "user:read"
+)
+
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"index"`
+	User       *User      `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write user:read"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type AccessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreatedAccessTokenResponse struct {
+	AccessTokenResponse
+	Token string `json:"token"`
+}
+
+type AccessTokensResponse struct {
+	Items []AccessTokenResponse `json:"items"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+type AdminUserResponse struct {
+	ID              uint       `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Age             int        `json:"age"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	MFAEnabled      bool       `json:"mfa_enabled"`
+	Roles           []string   `json:"roles"`
+	SuspendedAt     *time.Time `json:"suspended_at"`
+	DeletedAt       *time.Time `json:"deleted_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type AdminUserDetailResponse struct {
+	AdminUserResponse
+	PostCount        int64      `json:"post_count"`
+	LoginLockedUntil *time.Time `json:"login_locked_until"`
+}
+
+type AdminUsersResponse struct {
+	TotalItems int                 `json:"total_items"`
+	Items      []AdminUserResponse `json:"items"`
+	Limit      int                 `json:"limit"`
+	HasNext    bool                `json:"has_next"`
+}
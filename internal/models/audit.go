@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Actions recorded in the audit log.
+const (
+	AuditSignUp             = "user.signup"
+	AuditLogin              = "user.login"
+	AuditLogout             = "user.logout"
+	AuditPasswordChange     = "user.password_change"
+	AuditPasswordReset      = "user.password_reset"
+	AuditPasswordForceReset = "user.password_force_reset"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditPostCreate         = "post.create"
+	AuditPostUpdate         = "post.update"
+	AuditPostDelete         = "post.delete"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// Kinds of resource an audit event can target.
+const (
+	AuditTargetUser = "user"
+	AuditTargetPost = "post"
+)
+
+// AuditEvent records a security-relevant action. Events are never changed or
+// deleted, and they keep the IDs of their actor and target after those are
+// gone. ActorID is nil when nobody was signed in, as with a failed login.
+// Reason says why an action failed, and Email is the address a login or
+// signup attempt was made for, which may not belong to any account.
+type AuditEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Action     string    `json:"action" gorm:"index"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	ActorID    *uint     `json:"actor_id" gorm:"index"`
+	TargetType string    `json:"target_type,omitempty" gorm:"index:idx_audit_events_target"`
+	TargetID   *uint     `json:"target_id,omitempty" gorm:"index:idx_audit_events_target"`
+	Email      string    `json:"email,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	RequestID  string    `json:"request_id"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// AuditEventsResponse is a page of events, newest first. NextCursor is
+// passed as cursor to get the next page and is empty on the last one.
+type AuditEventsResponse struct {
+	Items      []AuditEvent `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
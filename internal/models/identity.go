@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Identity links a user to their account at an external identity provider.
+// Subject is the provider's stable ID for that account; a user can link at
+// most one account per provider.
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"uniqueIndex:idx_identities_user_id_provider"`
+	User      *User     `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identities_provider_subject;uniqueIndex:idx_identities_user_id_provider"`
+	Subject   string    `json:"-" gorm:"uniqueIndex:idx_identities_provider_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type IdentityProvidersResponse struct {
+	Items []IdentityProviderResponse `json:"items"`
+}
+
+type FederatedLoginResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// FederatedCallbackRequest carries what the identity provider sent back to
+// the redirect URL. Error is set instead of Code when the login failed.
+type FederatedCallbackRequest struct {
+	Code  string `json:"code" form:"code" validate:"required"`
+	State string `json:"state" form:"state" validate:"required"`
+	Error string `json:"error" form:"error"`
+}
+
+// FederatedSignupRequiredResponse is returned when nobody has linked the
+// provider account yet. The profile fields are prefilled from the provider.
+type FederatedSignupRequiredResponse struct {
+	SignupRequired bool   `json:"signup_required"`
+	SignupToken    string `json:"signup_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+	Email          string `json:"email"`
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+}
+
+type FederatedSignupRequest struct {
+	SignupToken string `json:"signup_token" validate:"required"`
+	FirstName   string `json:"first_name" validate:"required,min=2,max=50"`
+	LastName    string `json:"last_name" validate:"required,min=2,max=50"`
+	Age         int    `json:"age" validate:"required,min=1,max=150"`
+}
+
+type IdentityResponse struct {
+	ID        uint      `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentitiesResponse struct {
+	Items []IdentityResponse `json:"items"`
+}
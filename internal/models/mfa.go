@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Second factors listed in MFAChallengeResponse.Methods.
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+	MFAMethodPasskey      = "passkey"
+)
+
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	User      *User      `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ReauthenticateRequest confirms a sensitive change. Users with a password
+// send it; users without one send an authenticator code or a passkey.
+type ReauthenticateRequest struct {
+	Password string            `json:"password" validate:"required_without_all=Code Passkey"`
+	Code     string            `json:"code"`
+	Passkey  *PasskeyAssertion `json:"passkey"`
+}
+
+// DisableTOTPRequest needs the password and a code or recovery code. Users
+// without a password send an authenticator code or a passkey instead.
+type DisableTOTPRequest struct {
+	Password     string            `json:"password"`
+	Code         string            `json:"code" validate:"required_without_all=RecoveryCode Passkey"`
+	RecoveryCode string            `json:"recovery_code"`
+	Passkey      *PasskeyAssertion `json:"passkey"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	ExpiresIn   int64    `json:"expires_in"`
+	Methods     []string `json:"methods"`
+}
+
+// MFALoginRequest completes a login with one of an authenticator code, a
+// recovery code or a passkey.
+type MFALoginRequest struct {
+	MFAToken     string            `json:"mfa_token" validate:"required"`
+	Code         string            `json:"code" validate:"required_without_all=RecoveryCode Passkey"`
+	RecoveryCode string            `json:"recovery_code"`
+	Passkey      *PasskeyAssertion `json:"passkey"`
+}
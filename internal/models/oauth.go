@@ -0,0 +1,227 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Grant types an OAuth client can be allowed to use at the token endpoint.
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OpenID Connect scopes. Only OAuth clients can be granted them: openid asks
+// for an ID token, profile and email for the claims about the user they name.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// OAuthClient is an application registered with the OAuth 2.0 authorization
+// server. Public clients, like single-page and native apps, cannot keep a
+// secret and must use PKCE instead.
+type OAuthClient struct {
+	ID                     uint      `json:"id" gorm:"primaryKey"`
+	ClientID               string    `json:"client_id" gorm:"uniqueIndex"`
+	SecretHash             string    `json:"-"`
+	Name                   string    `json:"name"`
+	RedirectURIs           string    `json:"-"`
+	PostLogoutRedirectURIs string    `json:"-"`
+	Scopes                 string    `json:"-"`
+	GrantTypes             string    `json:"-"`
+	Public                 bool      `json:"public"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+func (c *OAuthClient) PostLogoutRedirectURIList() []string {
+	return strings.Fields(c.PostLogoutRedirectURIs)
+}
+
+func (c *OAuthClient) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+func (c *OAuthClient) GrantTypeList() []string {
+	return strings.Fields(c.GrantTypes)
+}
+
+// AllowsRedirectURI reports whether uri exactly matches one of the client's
+// registered redirect URIs.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIList(), uri)
+}
+
+// AllowsPostLogoutRedirectURI reports whether uri exactly matches one of the
+// addresses the client registered for returning users to after logout.
+func (c *OAuthClient) AllowsPostLogoutRedirectURI(uri string) bool {
+	return slices.Contains(c.PostLogoutRedirectURIList(), uri)
+}
+
+func (c *OAuthClient) AllowsGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypeList(), grantType)
+}
+
+// AllowsScopes reports whether every requested scope was registered for the
+// client.
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	allowed := c.ScopeList()
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+type CreateOAuthClientRequest struct {
+	Name                   string   `json:"name" validate:"required,max=100"`
+	RedirectURIs           []string `json:"redirect_uris" validate:"dive,url"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris" validate:"dive,url"`
+	Scopes                 []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write user:read openid profile email"`
+	GrantTypes             []string `json:"grant_types" validate:"required,min=1,dive,oneof=authorization_code refresh_token client_credentials"`
+	Public                 bool     `json:"public"`
+}
+
+type OAuthClientResponse struct {
+	ID                     uint      `json:"id"`
+	ClientID               string    `json:"client_id"`
+	Name                   string    `json:"name"`
+	RedirectURIs           []string  `json:"redirect_uris"`
+	PostLogoutRedirectURIs []string  `json:"post_logout_redirect_uris"`
+	Scopes                 []string  `json:"scopes"`
+	GrantTypes             []string  `json:"grant_types"`
+	Public                 bool      `json:"public"`
+	CreatedAt              time.Time `json:"created_at"`
+}
+
+// CreatedOAuthClientResponse carries the client secret, which is only shown
+// once. Public clients have none.
+type CreatedOAuthClientResponse struct {
+	OAuthClientResponse
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type OAuthClientsResponse struct {
+	Items []OAuthClientResponse `json:"items"`
+}
+
+// OAuthConsentResponse describes a pending authorization request so the
+// consent screen can ask the user whether to allow it.
+type OAuthConsentResponse struct {
+	ID          string   `json:"id"`
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	Scopes      []string `json:"scopes"`
+	RedirectURI string   `json:"redirect_uri"`
+}
+
+// OAuthRedirectResponse tells the consent screen where to send the browser
+// once the user has decided.
+type OAuthRedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// OAuthTokenRequest is the body of a token request. Clients normally send it
+// form-encoded; JSON is accepted as well. Confidential clients may pass
+// their credentials here instead of using HTTP Basic authentication.
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"`
+	Code         string `json:"code" form:"code"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	Scope        string `json:"scope" form:"scope"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+type OAuthRevokeRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
+
+type OAuthIntrospectionRequest struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
+
+// OAuthIntrospectionResponse describes a token (RFC 7662). Inactive tokens
+// are described by active alone. TokenUse tells access and refresh tokens
+// apart.
+type OAuthIntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	TokenUse  string `json:"token_use,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Sid       string `json:"sid,omitempty"`
+}
+
+// OAuthErrorResponse is the error format defined by RFC 6749, used by the
+// token and revocation endpoints.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// UserInfoResponse holds the OpenID Connect claims about a user, as returned
+// by the userinfo endpoint and embedded in ID tokens.
+type UserInfoResponse struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	UpdatedAt     int64  `json:"updated_at,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
@@ -0,0 +1,138 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered to a user. PublicKey is the
+// COSE key the authenticator sent at registration. SignCount is the
+// authenticator's signature counter from the last login; it has to increase
+// with every login unless the authenticator doesn't keep one.
+type Passkey struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"-" gorm:"index"`
+	User              *User      `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Name              string     `json:"name"`
+	CredentialID      []byte     `json:"-" gorm:"uniqueIndex"`
+	PublicKey         []byte     `json:"-"`
+	SignCount         int64      `json:"-"`
+	AAGUID            []byte     `json:"-"`
+	AttestationFormat string     `json:"-"`
+	Transports        string     `json:"-"`
+	BackupEligible    bool       `json:"backup_eligible"`
+	LastUsedAt        *time.Time `json:"last_used_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// WebAuthn option types are passed to the browser's navigator.credentials
+// calls as they are, so they use the WebAuthn JSON field names. Binary
+// values are base64url encoded.
+
+type PasskeyRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PasskeyUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type PasskeyCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type PasskeyCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type PasskeyAuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type PasskeyCreationOptions struct {
+	RP                     PasskeyRelyingParty           `json:"rp"`
+	User                   PasskeyUser                   `json:"user"`
+	Challenge              string                        `json:"challenge"`
+	PubKeyCredParams       []PasskeyCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"`
+	ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                        `json:"attestation"`
+}
+
+type PasskeyRequestOptions struct {
+	Challenge        string                        `json:"challenge"`
+	Timeout          int64                         `json:"timeout"`
+	RPID             string                        `json:"rpId"`
+	AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                        `json:"userVerification"`
+}
+
+type PasskeyCreationOptionsResponse struct {
+	PublicKey PasskeyCreationOptions `json:"publicKey"`
+}
+
+type PasskeyRequestOptionsResponse struct {
+	PublicKey PasskeyRequestOptions `json:"publicKey"`
+}
+
+// PasskeyAttestation is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.create(), as produced by its toJSON() method.
+type PasskeyAttestation struct {
+	ID       string `json:"id" validate:"required"`
+	RawID    string `json:"rawId" validate:"required"`
+	Type     string `json:"type" validate:"eq=public-key"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON" validate:"required"`
+		AttestationObject string   `json:"attestationObject" validate:"required"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// PasskeyAssertion is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get().
+type PasskeyAssertion struct {
+	ID       string `json:"id" validate:"required"`
+	RawID    string `json:"rawId" validate:"required"`
+	Type     string `json:"type" validate:"eq=public-key"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AuthenticatorData string `json:"authenticatorData" validate:"required"`
+		Signature         string `json:"signature" validate:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type PasskeyRegistrationRequest struct {
+	Name       string             `json:"name" validate:"max=64"`
+	Credential PasskeyAttestation `json:"credential"`
+}
+
+type PasskeyLoginRequest struct {
+	Credential PasskeyAssertion `json:"credential"`
+}
+
+type PasskeyMFAOptionsRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type PasskeyUpdateRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+type PasskeyResponse struct {
+	ID             uint       `json:"id"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"backup_eligible"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type PasskeysResponse struct {
+	Items []PasskeyResponse `json:"items"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// PasswordHistory keeps a hash of a password the user had before, so it
+// cannot be chosen again.
+type PasswordHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"-" gorm:"index"`
+	User         *User     `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
+
+// PasswordExpiredResponse is returned instead of tokens when the password is
+// older than the configured maximum age. ResetToken can be redeemed at
+// /user/password/reset to choose a new password.
+type PasswordExpiredResponse struct {
+	Error      string `json:"error"`
+	Code       string `json:"code"`
+	ResetToken string `json:"reset_token"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
@@ -1,10 +1,19 @@
 package models
 
+import "go-auth-boilerplate/internal/password"
+
 type APIResponse struct {
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
 }
 
+// PasswordPolicyErrorResponse lists every password policy rule a new
+// password breaks.
+type PasswordPolicyErrorResponse struct {
+	Error      string               `json:"error"`
+	Violations []password.Violation `json:"violations"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
@@ -12,10 +21,50 @@ type LoginRequest struct {
 
 type PasswordUpdateRequest struct {
 	CurrentPassword string `json:"current_password" validate:"required"`
-	NewPassword     string `json:"new_password" validate:"required,min=6"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
 }
 
 type PostUpdateRequest struct {
 	Title string `json:"title" validate:"omitempty,min=3,max=100"`
 	Body  string `json:"body" validate:"omitempty,min=10"`
 }
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	SessionID    string `json:"-"`
+}
+
+// CookieSessionResponse replaces TokenResponse when cookie sessions are
+// enabled. The tokens travel in HttpOnly cookies; CSRFToken must be sent in
+// the X-CSRF-Token header of every state-changing request.
+type CookieSessionResponse struct {
+	CSRFToken string `json:"csrf_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+const (
+	PermissionPostsDeleteAny = "posts:delete:any"
+	PermissionRolesRead      = "roles:read"
+	PermissionRolesAssign    = "roles:assign"
+	PermissionUsersRead      = "users:read"
+	PermissionUsersManage    = "users:manage"
+	PermissionOAuthClients   = "oauth_clients:manage"
+	PermissionAuditRead      = "audit:read"
+)
+
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE"`
+	ExternalID  string       `json:"-"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex;not null"`
+	Description string `json:"description"`
+}
+
+type RolesResponse struct {
+	Items []Role `json:"items"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// SAMLLoginRequest carries the code the ACS redirected the browser to the
+// frontend with.
+type SAMLLoginRequest struct {
+	Code string `json:"code" validate:"required"`
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SCIMUser is a user as a SCIM client sees it. userName and the primary
+// email are both the user's email; password is only ever written.
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        SCIMName    `json:"name"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	Groups      []SCIMRef   `json:"groups,omitempty"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMRef points at another resource: a group of a user or a member of a
+// group.
+type SCIMRef struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// SCIMGroup is a role as a SCIM client sees it.
+type SCIMGroup struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id,omitempty"`
+	ExternalID  string    `json:"externalId,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Members     []SCIMRef `json:"members,omitempty"`
+	Meta        *SCIMMeta `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is one change of a PATCH request. Op is add, replace
+// or remove, in any case; Value depends on the path.
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type SCIMSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type SCIMFilterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type SCIMBulkSupported struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type SCIMAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+type SCIMServiceProviderConfig struct {
+	Schemas               []string                   `json:"schemas"`
+	Patch                 SCIMSupported              `json:"patch"`
+	Bulk                  SCIMBulkSupported          `json:"bulk"`
+	Filter                SCIMFilterSupported        `json:"filter"`
+	ChangePassword        SCIMSupported              `json:"changePassword"`
+	Sort                  SCIMSupported              `json:"sort"`
+	ETag                  SCIMSupported              `json:"etag"`
+	AuthenticationSchemes []SCIMAuthenticationScheme `json:"authenticationSchemes"`
+}
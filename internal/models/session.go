@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Device     string    `json:"device"`
+	Current    bool      `json:"current"`
+}
+
+type SessionsResponse struct {
+	Items []Session `json:"items"`
+}
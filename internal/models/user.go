@@ -1,54 +1,108 @@
 package models
 
 import (
-	"log"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"go-auth-boilerplate/internal/password"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	FirstName string    `json:"first_name" validate:"required,min=2,max=50"`
-	LastName  string    `json:"last_name" validate:"required,min=2,max=50"`
-	Age       int       `json:"age" validate:"required,min=1,max=150"`
-	Email     string    `json:"email" gorm:"unique" validate:"required,email"`
-	Password  string    `json:"password,omitempty" validate:"required,min=6"`
-	Posts     []Post    `json:"posts,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
-func (u *User) BeforeSave(tx *gorm.DB) error {
-	if u.Password != "" {
-		if !strings.HasPrefix(u.Password, "$2a$") {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-			if err != nil {
-				return err
-			}
-			u.Password = string(hashedPassword)
-		}
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	FirstName         string         `json:"first_name" validate:"required,min=2,max=50"`
+	LastName          string         `json:"last_name" validate:"required,min=2,max=50"`
+	Age               int            `json:"age" validate:"required,min=1,max=150"`
+	Email             string         `json:"email" gorm:"unique" validate:"required,email"`
+	Password          string         `json:"password,omitempty" validate:"required"`
+	PasswordChangedAt *time.Time     `json:"-"`
+	Posts             []Post         `json:"posts,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Roles             []Role         `json:"-" gorm:"many2many:user_roles;constraint:OnDelete:CASCADE"`
+	EmailVerifiedAt   *time.Time     `json:"-"`
+	TOTPSecret        string         `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabledAt     *time.Time     `json:"-" gorm:"column:totp_enabled_at"`
+	SuspendedAt       *time.Time     `json:"-"`
+	ExternalID        string         `json:"-"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// SetPassword hashes a new plaintext password for the user. Passwords are
+// hashed explicitly rather than in a save hook, so that a client can't have a
+// value that merely looks like a hash stored as-is.
+func (u *User) SetPassword(plaintext string) error {
+	hashedPassword, err := password.Hash(plaintext)
+	if err != nil {
+		return err
 	}
+	u.Password = hashedPassword
+	now := time.Now()
+	u.PasswordChangedAt = &now
 	return nil
 }
 
-func (u *User) ComparePassword(password string) error {
-	log.Printf("Comparing passwords - Stored hash: %s, Input password: %s", u.Password, password)
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	if err != nil {
-		log.Printf("Password comparison error: %v", err)
+func (u *User) ComparePassword(plaintext string) error {
+	return password.Verify(u.Password, plaintext)
+}
+
+// HasPassword reports whether the user can log in with a password. Users who
+// signed up through an identity provider have none until they reset it.
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// PasswordExpired reports whether the password is older than maxAge. A zero
+// maxAge never expires passwords.
+func (u *User) PasswordExpired(maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
 	}
-	return err
+	return time.Since(changedAt) > maxAge
+}
+
+// PasswordNeedsRehash reports whether the stored hash was made with another
+// algorithm or other parameters than the configured ones.
+func (u *User) PasswordNeedsRehash() bool {
+	return password.NeedsRehash(u.Password)
 }
 
 type UserResponse struct {
-	ID        uint      `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Age       int       `json:"age"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint       `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Age             int        `json:"age"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	MFAEnabled      bool       `json:"mfa_enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// OpenIDClaims returns the claims about the user that the scopes allow.
+func (u *User) OpenIDClaims(scopes []string) UserInfoResponse {
+	info := UserInfoResponse{Sub: strconv.FormatUint(uint64(u.ID), 10)}
+
+	if slices.Contains(scopes, ScopeProfile) {
+		info.Name = strings.TrimSpace(u.FirstName + " " + u.LastName)
+		info.GivenName = u.FirstName
+		info.FamilyName = u.LastName
+		info.UpdatedAt = u.UpdatedAt.Unix()
+	}
+
+	if slices.Contains(scopes, ScopeEmail) {
+		verified := u.EmailVerifiedAt != nil
+		info.Email = u.Email
+		info.EmailVerified = &verified
+	}
+
+	return info
 }
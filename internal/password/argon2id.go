@@ -0,0 +1,158 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in the PHC
+// string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id returns a hasher with the parameters recommended by
+// RFC 9106 for memory-constrained environments.
+func DefaultArgon2id() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Limits on the parameters a stored hash may use. Parameters outside of them
+// make argon2 panic or take unbounded memory or time to verify, so such
+// hashes are rejected before any work is done.
+const (
+	minArgon2SaltLength = 8
+	maxArgon2SaltLength = 64
+	minArgon2KeyLength  = 16
+	maxArgon2KeyLength  = 64
+	maxArgon2Iterations = 64
+	maxArgon2Memory     = 2 * 1024 * 1024
+)
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	_, err := decodeArgon2id(encoded)
+	return err == nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.Memory ||
+		params.iterations != h.Iterations ||
+		params.parallelism != h.Parallelism ||
+		uint32(len(params.salt)) != h.SaltLength ||
+		uint32(len(params.key)) != h.KeyLength
+}
+
+func decodeArgon2id(encoded string) (*argon2Params, error) {
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		return nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("malformed argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if err := checkArgon2Params(params.memory, params.iterations, params.parallelism); err != nil {
+		return nil, err
+	}
+	if len(params.salt) < minArgon2SaltLength || len(params.salt) > maxArgon2SaltLength {
+		return nil, fmt.Errorf("argon2id salt length %d out of range", len(params.salt))
+	}
+	if len(params.key) < minArgon2KeyLength || len(params.key) > maxArgon2KeyLength {
+		return nil, fmt.Errorf("argon2id hash length %d out of range", len(params.key))
+	}
+
+	return &params, nil
+}
+
+// checkArgon2Params rejects costs that argon2 can't run with or that would
+// make verifying a single password exhaust the server.
+func checkArgon2Params(memory, iterations uint32, parallelism uint8) error {
+	if iterations < 1 || iterations > maxArgon2Iterations {
+		return fmt.Errorf("argon2id iterations %d out of range", iterations)
+	}
+	if parallelism < 1 {
+		return fmt.Errorf("argon2id parallelism %d out of range", parallelism)
+	}
+	if memory < 8*uint32(parallelism) || memory > maxArgon2Memory {
+		return fmt.Errorf("argon2id memory %d KiB out of range", memory)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package password
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher hashes passwords with bcrypt. It verifies hashes with any of
+// the $2a$, $2b$ and $2y$ prefixes.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	if !hasAnyPrefix(encoded, "$2a$", "$2b$", "$2y$") {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(encoded))
+	return err == nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,52 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Breached reports whether the password appears in a local copy of the Have
+// I Been Pwned corpus. dir holds one range file per 5 character SHA-1 prefix,
+// named after the prefix (optionally with a .txt extension), where each line
+// is the remaining 35 characters of a hash and a count:
+//
+//	0018A45C4D1DEF81644B54AB7F969B88D65:21
+//
+// This is the layout produced by the official PwnedPasswordsDownloader, so no
+// network call is made when checking a password.
+func Breached(dir, plaintext string) (bool, error) {
+	sum := sha1.Sum([]byte(plaintext))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := openRangeFile(dir, prefix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		candidate, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(candidate, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func openRangeFile(dir, prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(dir, prefix))
+	}
+	return file, err
+}
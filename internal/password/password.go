@@ -0,0 +1,136 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"go-auth-boilerplate/config"
+)
+
+// ErrMismatch is returned by Verify when the password does not match the
+// hash.
+var ErrMismatch = errors.New("password does not match")
+
+// Hasher hashes passwords with one algorithm and set of parameters.
+// Implementations must be safe for concurrent use.
+type Hasher interface {
+	// Hash returns the encoded hash of the password, including the
+	// algorithm, parameters and salt needed to verify it later.
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches an encoded hash produced
+	// by this algorithm.
+	Verify(encoded, password string) (bool, error)
+	// Recognizes reports whether encoded was produced by this algorithm.
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded was produced with different
+	// parameters than the hasher is configured with.
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	hasher Hasher = DefaultArgon2id()
+	mu     sync.RWMutex
+)
+
+// Init selects the hasher configured by cfg.Algorithm: "argon2id" (the
+// default) or "bcrypt". Hashes made by the other algorithm can still be
+// verified and are upgraded on the next login. It also sets the policy new
+// passwords are checked against.
+func Init(cfg config.PasswordConfig) error {
+	if cfg.BreachedDir != "" {
+		if info, err := os.Stat(cfg.BreachedDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("breached password directory %q is not readable", cfg.BreachedDir)
+		}
+	}
+	SetPolicy(Policy{
+		MinLength:            cfg.MinLength,
+		MaxLength:            cfg.MaxLength,
+		RequireUppercase:     cfg.RequireUppercase,
+		RequireLowercase:     cfg.RequireLowercase,
+		RequireDigit:         cfg.RequireDigit,
+		RequireSymbol:        cfg.RequireSymbol,
+		DisallowPersonalInfo: cfg.DisallowPersonalInfo,
+		MinStrength:          cfg.MinStrength,
+		BreachedDir:          cfg.BreachedDir,
+	})
+
+	switch cfg.Algorithm {
+	case "argon2id", "":
+		if err := checkArgon2Params(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism); err != nil {
+			return err
+		}
+		SetHasher(&Argon2idHasher{
+			Memory:      cfg.Argon2Memory,
+			Iterations:  cfg.Argon2Iterations,
+			Parallelism: cfg.Argon2Parallelism,
+			SaltLength:  16,
+			KeyLength:   32,
+		})
+	case "bcrypt":
+		SetHasher(&BcryptHasher{Cost: cfg.BcryptCost})
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
+	return nil
+}
+
+func SetHasher(h Hasher) {
+	mu.Lock()
+	defer mu.Unlock()
+	hasher = h
+}
+
+func current() Hasher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return hasher
+}
+
+// all lists every supported algorithm, so hashes made before the configured
+// algorithm changed can still be verified.
+var all = []Hasher{&Argon2idHasher{}, &BcryptHasher{}}
+
+// Hash hashes the password with the configured hasher.
+func Hash(password string) (string, error) {
+	return current().Hash(password)
+}
+
+// Verify checks the password against an encoded hash made by any supported
+// algorithm. It returns ErrMismatch if the password is wrong.
+func Verify(encoded, password string) error {
+	for _, h := range all {
+		if !h.Recognizes(encoded) {
+			continue
+		}
+
+		ok, err := h.Verify(encoded, password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrMismatch
+		}
+		return nil
+	}
+	return fmt.Errorf("unrecognized password hash")
+}
+
+// NeedsRehash reports whether an encoded hash should be replaced because it
+// was made with another algorithm or other parameters than the configured
+// ones.
+func NeedsRehash(encoded string) bool {
+	h := current()
+	return !h.Recognizes(encoded) || h.NeedsRehash(encoded)
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package password
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy describes the passwords users may choose. Zero values disable the
+// corresponding rule.
+type Policy struct {
+	MinLength            int
+	MaxLength            int
+	RequireUppercase     bool
+	RequireLowercase     bool
+	RequireDigit         bool
+	RequireSymbol        bool
+	DisallowPersonalInfo bool
+	// MinStrength is the lowest acceptable Strength score, from 0 to 4.
+	MinStrength int
+	// BreachedDir is a directory of HIBP-format range files; see Breached.
+	BreachedDir string
+}
+
+// Violation is a policy rule a password breaks. Code is stable and meant for
+// clients to map to their own messages.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	ViolationTooShort          = "password_too_short"
+	ViolationTooLong           = "password_too_long"
+	ViolationMissingUppercase  = "password_missing_uppercase"
+	ViolationMissingLowercase  = "password_missing_lowercase"
+	ViolationMissingDigit      = "password_missing_digit"
+	ViolationMissingSymbol     = "password_missing_symbol"
+	ViolationPersonalInfo      = "password_contains_personal_info"
+	ViolationTooWeak           = "password_too_weak"
+	ViolationBreached          = "password_breached"
+	ViolationReused            = "password_reused"
+	minPersonalInfoTokenLength = 3
+)
+
+var policy = Policy{MinLength: 6, MaxLength: 128}
+
+func SetPolicy(p Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+}
+
+func currentPolicy() Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+	return policy
+}
+
+// Check returns every rule of the configured policy the password breaks.
+// personal lists the user's email address and names, which the password may
+// not contain.
+func Check(plaintext string, personal ...string) []Violation {
+	return currentPolicy().Check(plaintext, personal...)
+}
+
+func (p Policy) Check(plaintext string, personal ...string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(plaintext)
+	if length < p.MinLength {
+		violations = append(violations, Violation{ViolationTooShort, fmt.Sprintf("Password must be at least %d characters long", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{ViolationTooLong, fmt.Sprintf("Password must be at most %d characters long", p.MaxLength)})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range plaintext {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, Violation{ViolationMissingUppercase, "Password must contain an uppercase letter"})
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, Violation{ViolationMissingLowercase, "Password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, Violation{ViolationMissingDigit, "Password must contain a digit"})
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, Violation{ViolationMissingSymbol, "Password must contain a symbol"})
+	}
+
+	tokens := personalInfoTokens(personal)
+	if p.DisallowPersonalInfo && containsAny(strings.ToLower(plaintext), tokens) {
+		violations = append(violations, Violation{ViolationPersonalInfo, "Password must not contain your name or email address"})
+	}
+
+	if p.MinStrength > 0 && Strength(plaintext, tokens...) < p.MinStrength {
+		violations = append(violations, Violation{ViolationTooWeak, "Password is too easy to guess"})
+	}
+
+	if p.BreachedDir != "" {
+		breached, err := Breached(p.BreachedDir, plaintext)
+		if err != nil {
+			// A missing or unreadable corpus must not lock users out of
+			// choosing a password
+			log.Printf("Error checking breached passwords: %v", err)
+		} else if breached {
+			violations = append(violations, Violation{ViolationBreached, "Password has appeared in a data breach and cannot be used"})
+		}
+	}
+
+	return violations
+}
+
+// personalInfoTokens splits email addresses and names into the lowercase
+// words a password is checked against. Very short words are skipped since
+// they would reject too many passwords.
+func personalInfoTokens(personal []string) []string {
+	var tokens []string
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+		}
+
+		words := strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if utf8.RuneCountInString(word) >= minPersonalInfoTokenLength {
+				tokens = append(tokens, word)
+			}
+		}
+	}
+	return tokens
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
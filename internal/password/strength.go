@@ -0,0 +1,94 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonWords are fragments that make up a large share of leaked passwords.
+// Guessers try them long before random characters, so each is counted as
+// taking about a hundred guesses.
+var commonWords = []string{
+	"password", "passwort", "passw0rd", "qwerty", "azerty", "letmein",
+	"welcome", "admin", "login", "master", "dragon", "monkey", "football",
+	"baseball", "iloveyou", "sunshine", "princess", "shadow", "superman",
+	"trustno1", "secret", "abc", "pass", "love", "hello", "test",
+}
+
+// keyboardRows are used to spot runs of adjacent keys like "asdf".
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// Strength estimates how hard the password is to guess on the 0 to 4 scale
+// popularised by zxcvbn, where 0 is trivially guessable and 4 is very
+// unguessable. It is a heuristic: common words, the words in personal, and
+// repeated, sequential or keyboard runs of characters add little to the
+// estimate.
+func Strength(plaintext string, personal ...string) int {
+	lower := strings.ToLower(plaintext)
+	for _, word := range append(append([]string{}, personal...), commonWords...) {
+		if word != "" {
+			lower = strings.ReplaceAll(lower, word, "\x00")
+		}
+	}
+
+	// guesses is the log10 of the number of guesses needed
+	runes := []rune(lower)
+	guesses := 0.0
+	for i, r := range runes {
+		switch {
+		case r == 0:
+			guesses += 2
+		case i > 0 && predictable(runes[i-1], r):
+			guesses += math.Log10(2)
+		default:
+			guesses += math.Log10(float64(classSize(r)))
+		}
+	}
+
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// predictable reports whether r continues the pattern of the character
+// before it: a repeat, an alphabetic or numeric sequence, or a run of
+// adjacent keys.
+func predictable(last, r rune) bool {
+	if r == last {
+		return true
+	}
+	if d := r - last; d == 1 || d == -1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		if at := strings.IndexRune(row, last); at >= 0 && at+1 < len(row) && rune(row[at+1]) == r {
+			return true
+		}
+	}
+	return false
+}
+
+// classSize is the number of characters in r's class. Letters were
+// lowercased before, so case is not accounted for.
+func classSize(r rune) int {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return 26
+	case r >= '0' && r <= '9':
+		return 10
+	case r < unicode.MaxASCII:
+		return 33
+	default:
+		return 100
+	}
+}
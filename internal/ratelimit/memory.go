@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-auth-boilerplate/config"
+)
+
+// sweepInterval is how often MemoryStore drops budgets nobody has used for
+// a whole window.
+const sweepInterval = time.Minute
+
+type window struct {
+	hits   []time.Time
+	length time.Duration
+}
+
+// MemoryStore keeps budgets in process memory. Limits are not shared between
+// instances, which makes it suitable for development, tests and as a
+// fallback while Redis is unavailable.
+type MemoryStore struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[string]*window), lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rate config.Rate) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{}
+		s.windows[key] = w
+	}
+	w.length = rate.Window
+	w.prune(now)
+
+	allowed := len(w.hits) < rate.Limit
+	if allowed {
+		w.hits = append(w.hits, now)
+	}
+
+	reset := rate.Window
+	if len(w.hits) > 0 {
+		reset = w.hits[0].Add(rate.Window).Sub(now)
+	}
+
+	return Result{
+		Allowed:   allowed,
+		Limit:     rate.Limit,
+		Remaining: rate.Limit - len(w.hits),
+		Reset:     reset,
+	}, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, w := range s.windows {
+		w.prune(now)
+		if len(w.hits) == 0 {
+			delete(s.windows, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (w *window) prune(now time.Time) {
+	cutoff := now.Add(-w.length)
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(cutoff) {
+		i++
+	}
+	w.hits = w.hits[i:]
+}
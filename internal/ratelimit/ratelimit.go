@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-auth-boilerplate/config"
+)
+
+// Result describes the state of a budget after a request was counted against
+// it. Reset is how long until the oldest counted request leaves the window
+// and frees up a slot.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
+
+// Store counts requests against sliding-window budgets. Implementations must
+// be safe for concurrent use.
+type Store interface {
+	Take(ctx context.Context, key string, rate config.Rate) (Result, error)
+}
+
+var (
+	store Store = NewMemoryStore()
+	mu    sync.RWMutex
+)
+
+// Init selects the store configured by cfg.Store: "redis" (the default),
+// which shares budgets between instances and falls back to memory while
+// Redis is unavailable, or "memory", which keeps budgets per process.
+func Init(cfg config.RateLimitConfig) error {
+	switch cfg.Store {
+	case "redis", "":
+		SetStore(&FallbackStore{Primary: RedisStore{}, Fallback: NewMemoryStore()})
+	case "memory":
+		SetStore(NewMemoryStore())
+	default:
+		return fmt.Errorf("unknown rate limit store %q", cfg.Store)
+	}
+	return nil
+}
+
+func SetStore(s Store) {
+	mu.Lock()
+	defer mu.Unlock()
+	store = s
+}
+
+// Take counts a request against the budget identified by key.
+func Take(ctx context.Context, key string, rate config.Rate) (Result, error) {
+	mu.RLock()
+	s := store
+	mu.RUnlock()
+	return s.Take(ctx, key, rate)
+}
+
+// FallbackStore uses Primary and switches to Fallback for as long as Primary
+// returns errors, so an outage of the shared store degrades limits to
+// per-instance ones instead of failing requests.
+type FallbackStore struct {
+	Primary  Store
+	Fallback Store
+
+	mu       sync.Mutex
+	degraded bool
+}
+
+func (s *FallbackStore) Take(ctx context.Context, key string, rate config.Rate) (Result, error) {
+	result, err := s.Primary.Take(ctx, key, rate)
+	s.mu.Lock()
+	if err != nil && !s.degraded {
+		log.Printf("Rate limit store unavailable, falling back to memory: %v", err)
+	} else if err == nil && s.degraded {
+		log.Printf("Rate limit store recovered")
+	}
+	s.degraded = err != nil
+	s.mu.Unlock()
+
+	if err != nil {
+		return s.Fallback.Take(ctx, key, rate)
+	}
+	return result, nil
+}
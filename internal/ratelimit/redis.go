@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// slidingWindow keeps one sorted set member per counted request, scored by
+// its time in milliseconds. Members older than the window are dropped before
+// counting, so the budget slides instead of resetting at fixed boundaries.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, count, reset}
+`)
+
+// RedisStore keeps budgets in Redis so they are shared by every instance of
+// the API.
+type RedisStore struct{}
+
+func (RedisStore) Take(ctx context.Context, key string, rate config.Rate) (Result, error) {
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return Result{}, err
+	}
+
+	now := time.Now().UnixMilli()
+	values, err := slidingWindow.Run(ctx, database.RedisClient, []string{key},
+		now, rate.Window.Milliseconds(), rate.Limit, hex.EncodeToString(member)).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:   values[0] == 1,
+		Limit:     rate.Limit,
+		Remaining: rate.Limit - int(values[1]),
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
@@ -1,36 +1,206 @@
 package routes
 
 import (
+	"log"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/authn"
+	"go-auth-boilerplate/internal/federation"
 	"go-auth-boilerplate/internal/handlers"
+	"go-auth-boilerplate/internal/mailer"
 	"go-auth-boilerplate/internal/middleware"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/password"
+	"go-auth-boilerplate/internal/ratelimit"
+	"go-auth-boilerplate/internal/saml"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(app *fiber.App, db *gorm.DB, redisURL string) {
-	handlers.InitHandlers(db, redisURL)
+func SetupRoutes(app *fiber.App, cfg *config.Config, db *gorm.DB, redisURL string) {
+	if err := auth.Init(cfg); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	if err := authn.Init(cfg); err != nil {
+		log.Fatalf("Failed to configure login backends: %v", err)
+	}
+	if err := password.Init(cfg.Password); err != nil {
+		log.Fatalf("Failed to configure password hashing: %v", err)
+	}
+	if err := mailer.Init(cfg.Mail); err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+	if err := ratelimit.Init(cfg.RateLimit); err != nil {
+		log.Fatalf("Failed to configure rate limiting: %v", err)
+	}
+	federation.Init(cfg.Providers)
+	if err := saml.Init(cfg.SAML); err != nil {
+		log.Fatalf("Failed to configure SAML tenants: %v", err)
+	}
+	middleware.InitSessionCookies(cfg)
+	handlers.InitHandlers(cfg, db, redisURL)
+
+	// Every response carries an X-Request-ID, taken from the request if the
+	// client or a proxy sent one, so audit events can be matched with logs
+	app.Use(requestid.New())
+
+	app.Get("/.well-known/jwks.json", handlers.GetJWKS)
+	app.Get("/.well-known/openid-configuration", handlers.GetOpenIDConfiguration)
+
+	globalLimit := middleware.RateLimit("global", cfg.RateLimit.Global, middleware.ByIP)
+
+	// Resource servers introspect tokens on every request they serve, so the
+	// IP limit would throttle them; the endpoint needs client credentials
+	app.Post("/oauth/introspect", handlers.IntrospectOAuthToken)
+
+	oauth := app.Group("/oauth", globalLimit)
+	oauth.Get("/authorize", handlers.Authorize)
+	oauth.Post("/token", handlers.OAuthToken)
+	oauth.Post("/revoke", handlers.RevokeOAuthToken)
+	oauth.Get("/userinfo", middleware.Protected(), middleware.RequireScope(models.ScopeOpenID), handlers.GetUserInfo)
+	oauth.Post("/userinfo", middleware.Protected(), middleware.RequireScope(models.ScopeOpenID), handlers.GetUserInfo)
+	oauth.Get("/logout", handlers.EndSession)
+	oauth.Post("/logout", handlers.EndSession)
+
+	// Endpoints the tenants' identity providers and the browser talk to
+	samlSP := app.Group("/saml/:tenant", globalLimit)
+	samlSP.Get("/metadata", handlers.GetSAMLMetadata)
+	samlSP.Get("/login", handlers.StartSAMLLogin)
+	samlSP.Post("/acs", handlers.SAMLAssertionConsumer)
 
-	api := app.Group("/api/v1")
+	// SCIM provisioning. Directory syncs come in bursts from a few IdP
+	// addresses, so the token guards these routes instead of the IP limit.
+	scimAPI := app.Group("/scim/v2", middleware.SCIMAuth(cfg.SCIM.Token))
+	scimAPI.Get("/ServiceProviderConfig", handlers.SCIMServiceProviderConfig)
+	scimAPI.Get("/Users", handlers.SCIMListUsers)
+	scimAPI.Post("/Users", handlers.SCIMCreateUser)
+	scimAPI.Get("/Users/:id", handlers.SCIMGetUser)
+	scimAPI.Put("/Users/:id", handlers.SCIMReplaceUser)
+	scimAPI.Patch("/Users/:id", handlers.SCIMPatchUser)
+	scimAPI.Delete("/Users/:id", handlers.SCIMDeleteUser)
+	scimAPI.Get("/Groups", handlers.SCIMListGroups)
+	scimAPI.Post("/Groups", handlers.SCIMCreateGroup)
+	scimAPI.Get("/Groups/:id", handlers.SCIMGetGroup)
+	scimAPI.Put("/Groups/:id", handlers.SCIMReplaceGroup)
+	scimAPI.Patch("/Groups/:id", handlers.SCIMPatchGroup)
+	scimAPI.Delete("/Groups/:id", handlers.SCIMDeleteGroup)
+
+	api := app.Group("/api/v1", globalLimit)
+
+	// Login and the MFA step share a budget so the second factor cannot be
+	// used to get around it
+	loginLimit := middleware.RateLimit("login", cfg.RateLimit.Login, middleware.ByIP)
 
 	api.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
-	api.Post("/user/signup", handlers.SignUp)
-	api.Post("/user/login", handlers.Login)
+	signupLimit := middleware.RateLimit("signup", cfg.RateLimit.Signup, middleware.ByIP)
+
+	api.Post("/user/signup", signupLimit, handlers.SignUp)
+	api.Post("/user/signup/federated", signupLimit, handlers.FederatedSignUp)
+	api.Post("/user/login", loginLimit, handlers.Login)
+	api.Post("/user/login/mfa", loginLimit, handlers.LoginMFA)
+	api.Post("/user/login/mfa/passkey/options", loginLimit, handlers.BeginPasskeyMFA)
+	api.Post("/user/login/passkey/options", loginLimit, handlers.BeginPasskeyLogin)
+	api.Post("/user/login/passkey", loginLimit, handlers.LoginWithPasskey)
+	api.Post("/user/login/magic",
+		middleware.RateLimit("magic_link", cfg.RateLimit.MagicLink, middleware.ByIP),
+		middleware.RateLimit("magic_link_email", cfg.RateLimit.MagicLink, middleware.ByEmail),
+		handlers.RequestMagicLink)
+	api.Get("/user/login/magic/verify", loginLimit, handlers.VerifyMagicLink)
+	api.Post("/user/login/magic/verify", loginLimit, handlers.VerifyMagicLink)
+	api.Get("/user/login/providers", handlers.GetIdentityProviders)
+	api.Post("/user/login/providers/:provider", loginLimit, handlers.StartFederatedLogin)
+	api.Get("/user/login/providers/:provider/callback", loginLimit, handlers.FederatedLoginCallback)
+	api.Post("/user/login/providers/:provider/callback", loginLimit, handlers.FederatedLoginCallback)
+	api.Post("/user/login/saml", loginLimit, handlers.LoginWithSAML)
 	api.Post("/user/logout", handlers.Logout)
+	api.Post("/user/password/forgot",
+		middleware.RateLimit("password_reset", cfg.RateLimit.PasswordReset, middleware.ByIP),
+		middleware.RateLimit("password_reset_email", cfg.RateLimit.PasswordReset, middleware.ByEmail),
+		handlers.ForgotPassword)
+	api.Post("/user/password/reset", handlers.ResetPassword)
+	api.Post("/user/verify_email", handlers.VerifyEmail)
+	api.Post("/token/refresh", handlers.RefreshToken)
 
 	protected := api.Use(middleware.Protected())
 
-	protected.Get("/session", handlers.GetSession)
-	protected.Patch("/user", handlers.UpdateUser)
-	protected.Patch("/user/update_password", handlers.UpdatePassword)
-	protected.Delete("/user", handlers.DeleteUser)
+	// Personal access tokens can only reach routes that accept one of their
+	// scopes; everything that manages the account needs a real session
+	sessionOnly := middleware.SessionOnly()
+
+	protected.Get("/session", middleware.RequireScope(models.ScopeUserRead), handlers.GetSession)
+	protected.Patch("/user", sessionOnly, handlers.UpdateUser)
+	protected.Patch("/user/update_password", sessionOnly, handlers.UpdatePassword)
+	protected.Delete("/user", sessionOnly, handlers.DeleteUser)
+	protected.Post("/user/verify_email/resend", sessionOnly, handlers.ResendVerificationEmail)
+
+	protected.Post("/user/mfa/totp/enroll", sessionOnly, handlers.EnrollTOTP)
+	protected.Post("/user/mfa/totp/confirm", sessionOnly, handlers.ConfirmTOTP)
+	protected.Post("/user/mfa/totp/disable", sessionOnly, handlers.DisableTOTP)
+	protected.Post("/user/mfa/recovery_codes", sessionOnly, handlers.RegenerateRecoveryCodes)
+
+	protected.Get("/user/passkeys", sessionOnly, handlers.GetPasskeys)
+	protected.Post("/user/passkeys/register/options", sessionOnly, handlers.BeginPasskeyRegistration)
+	protected.Post("/user/passkeys/register", sessionOnly, handlers.RegisterPasskey)
+	protected.Post("/user/passkeys/reauthenticate/options", sessionOnly, handlers.BeginPasskeyReauthentication)
+	protected.Patch("/user/passkeys/:id", sessionOnly, handlers.UpdatePasskey)
+	protected.Delete("/user/passkeys/:id", sessionOnly, handlers.DeletePasskey)
+
+	protected.Get("/user/identities", sessionOnly, handlers.GetIdentities)
+	protected.Post("/user/identities/:provider", sessionOnly, handlers.LinkIdentity)
+	protected.Delete("/user/identities/:id", sessionOnly, handlers.UnlinkIdentity)
+
+	protected.Get("/sessions", sessionOnly, handlers.GetSessions)
+	protected.Delete("/sessions/:id", sessionOnly, handlers.DeleteSession)
+	protected.Post("/sessions/revoke_all", sessionOnly, handlers.RevokeAllSessions)
+
+	protected.Get("/user/activity", sessionOnly, handlers.GetActivity)
+
+	protected.Get("/tokens", sessionOnly, handlers.GetAccessTokens)
+	protected.Post("/tokens", sessionOnly, handlers.CreateAccessToken)
+	protected.Delete("/tokens/:id", sessionOnly, handlers.DeleteAccessToken)
+
+	// The consent screen answers authorization requests from /oauth/authorize
+	protected.Get("/oauth/requests/:id", sessionOnly, handlers.GetAuthorizationRequest)
+	protected.Post("/oauth/requests/:id/approve", sessionOnly, handlers.ApproveAuthorizationRequest)
+	protected.Post("/oauth/requests/:id/deny", sessionOnly, handlers.DenyAuthorizationRequest)
+
+	verified := middleware.RequireVerifiedEmail(cfg.Auth.RequireEmailVerification)
+	readPosts := middleware.RequireScope(models.ScopePostsRead)
+	writePosts := middleware.RequireScope(models.ScopePostsWrite)
+
+	protected.Post("/posts/create", writePosts, verified, middleware.RateLimit("post_create", cfg.RateLimit.PostCreate, middleware.ByIdentity), handlers.CreatePost)
+	protected.Get("/posts", readPosts, handlers.GetPosts)
+	protected.Get("/posts/:id", readPosts, handlers.GetPost)
+	protected.Patch("/posts/:id/update", writePosts, verified, handlers.UpdatePost)
+	protected.Delete("/posts/:id/delete", writePosts, verified, handlers.DeletePost)
+
+	admin := protected.Group("/admin", sessionOnly)
+
+	admin.Get("/roles", middleware.RequirePermission(models.PermissionRolesRead), handlers.GetRoles)
+	admin.Get("/users/:id/roles", middleware.RequirePermission(models.PermissionRolesRead), handlers.GetUserRoles)
+	admin.Post("/users/:id/roles", middleware.RequirePermission(models.PermissionRolesAssign), handlers.AssignRole)
+	admin.Delete("/users/:id/roles/:role", middleware.RequirePermission(models.PermissionRolesAssign), handlers.RemoveRole)
+
+	admin.Get("/users", middleware.RequirePermission(models.PermissionUsersRead), handlers.AdminGetUsers)
+	admin.Get("/users/:id", middleware.RequirePermission(models.PermissionUsersRead), handlers.AdminGetUser)
+	admin.Post("/users/:id/suspend", middleware.RequirePermission(models.PermissionUsersManage), handlers.SuspendUser)
+	admin.Post("/users/:id/unsuspend", middleware.RequirePermission(models.PermissionUsersManage), handlers.UnsuspendUser)
+	admin.Post("/users/:id/unlock", middleware.RequirePermission(models.PermissionUsersManage), handlers.UnlockUser)
+	admin.Post("/users/:id/password_reset", middleware.RequirePermission(models.PermissionUsersManage), handlers.ForcePasswordReset)
+	admin.Post("/users/:id/sessions/revoke_all", middleware.RequirePermission(models.PermissionUsersManage), handlers.AdminRevokeSessions)
+	admin.Delete("/users/:id", middleware.RequirePermission(models.PermissionUsersManage), handlers.AdminDeleteUser)
+
+	admin.Get("/oauth/clients", middleware.RequirePermission(models.PermissionOAuthClients), handlers.AdminGetOAuthClients)
+	admin.Post("/oauth/clients", middleware.RequirePermission(models.PermissionOAuthClients), handlers.AdminCreateOAuthClient)
+	admin.Delete("/oauth/clients/:id", middleware.RequirePermission(models.PermissionOAuthClients), handlers.AdminDeleteOAuthClient)
+
+	admin.Get("/audit_events", middleware.RequirePermission(models.PermissionAuditRead), handlers.AdminGetAuditEvents)
 
-	protected.Post("/posts/create", handlers.CreatePost)
-	protected.Get("/posts", handlers.GetPosts)
-	protected.Get("/posts/:id", handlers.GetPost)
-	protected.Patch("/posts/:id/update", handlers.UpdatePost)
-	protected.Delete("/posts/:id/delete", handlers.DeletePost)
+	admin.Delete("/posts/:id", middleware.RequirePermission(models.PermissionPostsDeleteAny), handlers.DeleteAnyPost)
 }
@@ -0,0 +1,327 @@
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// clockSkew is how far the IdP's clock may be off from ours when checking
+// the validity window of an assertion.
+const clockSkew = 3 * time.Minute
+
+// Assertion is what a validated response says about the user. InResponseTo
+// is the ID of the AuthnRequest it answers, empty for an IdP-initiated
+// login.
+type Assertion struct {
+	ID           string
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   map[string][]string
+	// NotOnOrAfter is when the assertion stops being valid; it has to be
+	// remembered until then to stop replays.
+	NotOnOrAfter time.Time
+}
+
+// Attribute returns the first value of the named attribute.
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// Profile is the user as described by the tenant's attribute mapping.
+type Profile struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Profile maps the assertion's attributes onto a user. Without an email
+// attribute an emailAddress NameID is used.
+func (t *Tenant) Profile(a *Assertion) Profile {
+	profile := Profile{
+		Email:     strings.ToLower(a.Attribute(t.cfg.EmailAttribute)),
+		FirstName: a.Attribute(t.cfg.FirstNameAttribute),
+		LastName:  a.Attribute(t.cfg.LastNameAttribute),
+	}
+	if profile.Email == "" && a.NameIDFormat == NameIDFormatEmail {
+		profile.Email = strings.ToLower(a.NameID)
+	}
+	return profile
+}
+
+// ParseResponse validates a base64 SAMLResponse posted to the tenant's ACS
+// and returns its assertion. Only data covered by a valid signature from the
+// tenant's IdP is read. The caller still has to match InResponseTo against
+// its outstanding requests and make sure the assertion isn't replayed.
+func (t *Tenant) ParseResponse(encoded string, now time.Time) (*Assertion, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	response := doc.Root()
+	if response == nil || !is(response, nsProtocol, "Response") {
+		return nil, fmt.Errorf("%w: not a Response", ErrInvalidResponse)
+	}
+
+	if destination := response.SelectAttrValue("Destination", ""); destination != "" && destination != t.cfg.ACSURL {
+		return nil, fmt.Errorf("%w: sent to %s", ErrInvalidResponse, destination)
+	}
+	if status := statusCode(response); status != statusSuccess {
+		return nil, fmt.Errorf("%w: IdP returned status %s", ErrInvalidResponse, status)
+	}
+	if len(children(response, nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+
+	// Exactly one assertion, so a signed one can't be smuggled in next to
+	// the one that is read
+	assertions := children(response, nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: expected one assertion, got %d", ErrInvalidResponse, len(assertions))
+	}
+
+	var signed *etree.Element
+	if len(children(response, nsSignature, "Signature")) > 0 {
+		validated, err := t.verifySignature(response, now)
+		if err != nil {
+			return nil, err
+		}
+		assertions = children(validated, nsAssertion, "Assertion")
+		if len(assertions) != 1 {
+			return nil, fmt.Errorf("%w: expected one signed assertion", ErrInvalidResponse)
+		}
+		if signed, err = detach(assertions[0]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+	} else if signed, err = t.verifySignature(assertions[0], now); err != nil {
+		return nil, err
+	}
+
+	assertion, err := t.checkAssertion(signed, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if inResponseTo := response.SelectAttrValue("InResponseTo", ""); inResponseTo != assertion.InResponseTo {
+		return nil, fmt.Errorf("%w: response and assertion answer different requests", ErrInvalidResponse)
+	}
+
+	return assertion, nil
+}
+
+// verifySignature checks the enveloped signature of el against the IdP
+// certificates and returns the signed content. Anything outside of it must
+// not be trusted.
+func (t *Tenant) verifySignature(el *etree.Element, now time.Time) (*etree.Element, error) {
+	detached, err := detach(el)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: t.certs})
+	ctx.Clock = dsig.NewFakeClockAt(now)
+	validated, err := ctx.Validate(detached)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidResponse, err)
+	}
+	return validated, nil
+}
+
+// checkAssertion checks that a signed assertion was issued by the tenant's
+// IdP for this service provider, is within its validity window and has a
+// bearer confirmation for the ACS.
+func (t *Tenant) checkAssertion(el *etree.Element, now time.Time) (*Assertion, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	var parsed assertionXML
+	if err := xml.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	if strings.TrimSpace(parsed.Issuer) != t.cfg.IDPEntityID {
+		return nil, fmt.Errorf("%w: issued by %s", ErrInvalidResponse, parsed.Issuer)
+	}
+
+	conditions := parsed.Conditions
+	if conditions.NotBefore != nil && now.Add(clockSkew).Before(*conditions.NotBefore) {
+		return nil, fmt.Errorf("%w: assertion not yet valid", ErrInvalidResponse)
+	}
+	if conditions.NotOnOrAfter != nil && !now.Add(-clockSkew).Before(*conditions.NotOnOrAfter) {
+		return nil, fmt.Errorf("%w: assertion expired", ErrInvalidResponse)
+	}
+	if !conditions.hasAudience(t.cfg.EntityID) {
+		return nil, fmt.Errorf("%w: assertion is not for %s", ErrInvalidResponse, t.cfg.EntityID)
+	}
+
+	var confirmation *subjectConfirmationDataXML
+	for _, candidate := range parsed.Subject.Confirmations {
+		data := candidate.Data
+		if candidate.Method != confirmationBearer || data.Recipient != t.cfg.ACSURL || data.NotOnOrAfter == nil {
+			continue
+		}
+		if data.NotBefore != nil && now.Add(clockSkew).Before(*data.NotBefore) {
+			continue
+		}
+		if !now.Add(-clockSkew).Before(*data.NotOnOrAfter) {
+			continue
+		}
+		confirmation = &data
+		break
+	}
+	if confirmation == nil {
+		return nil, fmt.Errorf("%w: no valid bearer confirmation for %s", ErrInvalidResponse, t.cfg.ACSURL)
+	}
+
+	if len(parsed.AuthnStatements) == 0 {
+		return nil, fmt.Errorf("%w: no authentication statement", ErrInvalidResponse)
+	}
+	nameID := strings.TrimSpace(parsed.Subject.NameID.Value)
+	if parsed.ID == "" || nameID == "" {
+		return nil, fmt.Errorf("%w: missing assertion ID or NameID", ErrInvalidResponse)
+	}
+
+	assertion := &Assertion{
+		ID:           parsed.ID,
+		InResponseTo: confirmation.InResponseTo,
+		NameID:       nameID,
+		NameIDFormat: parsed.Subject.NameID.Format,
+		SessionIndex: parsed.AuthnStatements[0].SessionIndex,
+		Attributes:   map[string][]string{},
+		NotOnOrAfter: *confirmation.NotOnOrAfter,
+	}
+	if conditions.NotOnOrAfter != nil && conditions.NotOnOrAfter.After(assertion.NotOnOrAfter) {
+		assertion.NotOnOrAfter = *conditions.NotOnOrAfter
+	}
+	for _, statement := range parsed.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			assertion.Attributes[attribute.Name] = append(assertion.Attributes[attribute.Name], attribute.Values...)
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				assertion.Attributes[attribute.FriendlyName] = append(assertion.Attributes[attribute.FriendlyName], attribute.Values...)
+			}
+		}
+	}
+
+	return assertion, nil
+}
+
+type assertionXML struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		Confirmations []struct {
+			Method string                     `xml:"Method,attr"`
+			Data   subjectConfirmationDataXML `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions      conditionsXML `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	AuthnStatements []struct {
+		SessionIndex string `xml:"SessionIndex,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
+	AttributeStatements []struct {
+		Attributes []struct {
+			Name         string   `xml:"Name,attr"`
+			FriendlyName string   `xml:"FriendlyName,attr"`
+			Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+type subjectConfirmationDataXML struct {
+	NotBefore    *time.Time `xml:"NotBefore,attr"`
+	NotOnOrAfter *time.Time `xml:"NotOnOrAfter,attr"`
+	Recipient    string     `xml:"Recipient,attr"`
+	InResponseTo string     `xml:"InResponseTo,attr"`
+}
+
+type conditionsXML struct {
+	NotBefore            *time.Time `xml:"NotBefore,attr"`
+	NotOnOrAfter         *time.Time `xml:"NotOnOrAfter,attr"`
+	AudienceRestrictions []struct {
+		Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+}
+
+// hasAudience reports whether every audience restriction includes the
+// entity. An assertion without any restriction is refused, since it could
+// have been issued to any service provider.
+func (c conditionsXML) hasAudience(entityID string) bool {
+	if len(c.AudienceRestrictions) == 0 {
+		return false
+	}
+	for _, restriction := range c.AudienceRestrictions {
+		found := false
+		for _, audience := range restriction.Audiences {
+			if strings.TrimSpace(audience) == entityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func is(el *etree.Element, namespace, tag string) bool {
+	return el.Tag == tag && el.NamespaceURI() == namespace
+}
+
+func children(el *etree.Element, namespace, tag string) []*etree.Element {
+	var found []*etree.Element
+	for _, child := range el.ChildElements() {
+		if is(child, namespace, tag) {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+func statusCode(response *etree.Element) string {
+	for _, status := range children(response, nsProtocol, "Status") {
+		for _, code := range children(status, nsProtocol, "StatusCode") {
+			return code.SelectAttrValue("Value", "")
+		}
+	}
+	return ""
+}
+
+// detach copies el out of its document, declaring the namespaces it
+// inherited so it can be verified and read on its own.
+func detach(el *etree.Element) (*etree.Element, error) {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err = ctx.SubContext(el)
+	if err != nil {
+		return nil, err
+	}
+	return etreeutils.NSDetatch(ctx, el)
+}
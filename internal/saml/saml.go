@@ -0,0 +1,135 @@
+// Package saml makes this service a SAML 2.0 service provider
+// (https://docs.oasis-open.org/security/saml/v2.0/) for enterprise single
+// sign-on. Each tenant is one customer's identity provider. Logins are
+// requested with the HTTP-Redirect binding and answered with the HTTP-POST
+// binding; the response or its assertion must be signed by the tenant's IdP
+// certificate. Encrypted assertions and single logout are not supported.
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go-auth-boilerplate/config"
+)
+
+// XML namespaces of the SAML documents handled here.
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsSignature = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+const (
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient   = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+var (
+	ErrUnknownTenant   = errors.New("unknown SAML tenant")
+	ErrInvalidResponse = errors.New("invalid SAML response")
+)
+
+var (
+	tenants = map[string]*Tenant{}
+	mu      sync.RWMutex
+)
+
+// Tenant is one configured identity provider and the service provider
+// endpoints it talks to.
+type Tenant struct {
+	cfg   config.SAMLTenantConfig
+	certs []*x509.Certificate
+}
+
+// Init registers the configured tenants and loads their IdP certificates.
+func Init(cfgs []config.SAMLTenantConfig) error {
+	registered := make(map[string]*Tenant, len(cfgs))
+	for _, cfg := range cfgs {
+		certs, err := loadCertificates(cfg.IDPCertificateFile)
+		if err != nil {
+			return fmt.Errorf("SAML tenant %s: %w", cfg.Name, err)
+		}
+		registered[cfg.Name] = &Tenant{cfg: cfg, certs: certs}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	tenants = registered
+	return nil
+}
+
+// Lookup returns the tenant registered under name.
+func Lookup(name string) (*Tenant, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	tenant, ok := tenants[name]
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+func (t *Tenant) Name() string {
+	return t.cfg.Name
+}
+
+func (t *Tenant) Config() config.SAMLTenantConfig {
+	return t.cfg
+}
+
+// NewRequestID returns a random ID for an AuthnRequest. SAML IDs must not
+// start with a digit.
+func NewRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// loadCertificates reads the PEM certificates in path. An IdP rolling over
+// its signing key can have the old and the new certificate in one file.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return certs, nil
+}
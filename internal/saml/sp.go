@@ -0,0 +1,89 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"net/url"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Metadata is the service provider's metadata document, which the IdP
+// administrator imports to set up the tenant.
+func (t *Tenant) Metadata() ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+
+	entity := doc.CreateElement("md:EntityDescriptor")
+	entity.CreateAttr("xmlns:md", nsMetadata)
+	entity.CreateAttr("entityID", t.cfg.EntityID)
+
+	sp := entity.CreateElement("md:SPSSODescriptor")
+	sp.CreateAttr("AuthnRequestsSigned", "false")
+	sp.CreateAttr("WantAssertionsSigned", "true")
+	sp.CreateAttr("protocolSupportEnumeration", nsProtocol)
+
+	for _, format := range []string{NameIDFormatPersistent, NameIDFormatEmail} {
+		sp.CreateElement("md:NameIDFormat").SetText(format)
+	}
+
+	acs := sp.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", BindingHTTPPost)
+	acs.CreateAttr("Location", t.cfg.ACSURL)
+	acs.CreateAttr("index", "0")
+	acs.CreateAttr("isDefault", "true")
+
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+// AuthnRequestURL returns the IdP URL that starts an SP-initiated login,
+// carrying an AuthnRequest with the given ID in the HTTP-Redirect binding.
+// The IdP posts its response back to the tenant's ACS URL.
+func (t *Tenant) AuthnRequestURL(id string, now time.Time) (string, error) {
+	doc := etree.NewDocument()
+	request := doc.CreateElement("samlp:AuthnRequest")
+	request.CreateAttr("xmlns:samlp", nsProtocol)
+	request.CreateAttr("xmlns:saml", nsAssertion)
+	request.CreateAttr("ID", id)
+	request.CreateAttr("Version", "2.0")
+	request.CreateAttr("IssueInstant", now.UTC().Format(time.RFC3339))
+	request.CreateAttr("Destination", t.cfg.IDPSSOURL)
+	request.CreateAttr("ProtocolBinding", BindingHTTPPost)
+	request.CreateAttr("AssertionConsumerServiceURL", t.cfg.ACSURL)
+	request.CreateElement("saml:Issuer").SetText(t.cfg.EntityID)
+
+	policy := request.CreateElement("samlp:NameIDPolicy")
+	policy.CreateAttr("Format", NameIDFormatUnspecified)
+	policy.CreateAttr("AllowCreate", "true")
+
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	// The redirect binding deflates the message before encoding it
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	ssoURL, err := url.Parse(t.cfg.IDPSSOURL)
+	if err != nil {
+		return "", err
+	}
+	query := ssoURL.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	ssoURL.RawQuery = query.Encode()
+
+	return ssoURL.String(), nil
+}
@@ -0,0 +1,338 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// Expression is a parsed SCIM filter (RFC 7644 section 3.4.2.2).
+type Expression interface {
+	expression()
+}
+
+// Comparison compares an attribute with a value. Operator is one of eq, ne,
+// co, sw, ew, gt, ge, lt, le and pr; Value is nil for pr.
+type Comparison struct {
+	Attribute string
+	Operator  string
+	Value     any
+}
+
+// Logical combines two filters with "and" or "or".
+type Logical struct {
+	Operator    string
+	Left, Right Expression
+}
+
+type Not struct {
+	Expression Expression
+}
+
+// ValuePath filters the values of a multi-valued attribute, as in
+// emails[type eq "work"]. Attributes in Filter are relative to Attribute.
+type ValuePath struct {
+	Attribute string
+	Filter    Expression
+}
+
+func (Comparison) expression() {}
+func (Logical) expression()    {}
+func (Not) expression()        {}
+func (ValuePath) expression()  {}
+
+var comparisonOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter. Attribute names are lowercased, since SCIM
+// compares them case-insensitively, and the core schema URN prefix is
+// dropped.
+func ParseFilter(filter string) (Expression, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "unexpected %q", p.peek().text)
+	}
+	return expr, nil
+}
+
+// Path is the target of a PATCH operation: an attribute, optionally
+// narrowed to the values matching Filter, as in members[value eq "2"] or
+// emails[type eq "work"].value. Attribute is the full dotted name.
+type Path struct {
+	Attribute string
+	Filter    Expression
+}
+
+// ParsePath parses the path of a PATCH operation.
+func ParsePath(path string) (*Path, error) {
+	tokens, err := tokenize(path)
+	if err != nil {
+		return nil, Errorf(400, ScimTypeInvalidPath, "invalid path %q", path)
+	}
+
+	p := &parser{tokens: tokens}
+	if p.done() || p.peek().kind != tokenWord {
+		return nil, Errorf(400, ScimTypeInvalidPath, "invalid path %q", path)
+	}
+	parsed := &Path{Attribute: attributeName(p.next().text)}
+
+	if !p.done() && p.peek().kind == tokenOpenBracket {
+		p.next()
+		if parsed.Filter, err = p.parseOr(); err != nil {
+			return nil, Errorf(400, ScimTypeInvalidPath, "invalid path %q", path)
+		}
+		if p.done() || p.next().kind != tokenCloseBracket {
+			return nil, Errorf(400, ScimTypeInvalidPath, "invalid path %q", path)
+		}
+		// The sub-attribute after the filter is lexed as its own word
+		if !p.done() {
+			sub := p.next()
+			if sub.kind != tokenWord || !strings.HasPrefix(sub.text, ".") {
+				return nil, Errorf(400, ScimTypeInvalidPath, "invalid path %q", path)
+			}
+			parsed.Attribute += strings.ToLower(sub.text)
+		}
+	}
+	if !p.done() {
+		return nil, Errorf(400, ScimTypeInvalidPath, "invalid path %q", path)
+	}
+
+	return parsed, nil
+}
+
+// attributeName normalises an attribute path for lookups.
+func attributeName(name string) string {
+	name = strings.ToLower(name)
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if prefix := strings.ToLower(schema) + ":"; strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenOpenParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenCloseParen, ")"})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{tokenOpenBracket, "["})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{tokenCloseBracket, "]"})
+			i++
+		case r == '"':
+			// Strings are JSON strings, escapes included
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, Errorf(400, ScimTypeInvalidFilter, "unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(string(runes[i:j+1])), &value); err != nil {
+				return nil, Errorf(400, ScimTypeInvalidFilter, "invalid string %s", string(runes[i:j+1]))
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+// keyword reports whether the next token is the given keyword and consumes
+// it if so.
+func (p *parser) keyword(word string) bool {
+	if !p.done() && p.peek().kind == tokenWord && strings.EqualFold(p.peek().text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Logical{Operator: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = Logical{Operator: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.done() {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "unexpected end of filter")
+	}
+
+	if p.keyword("not") {
+		if p.done() || p.next().kind != tokenOpenParen {
+			return nil, Errorf(400, ScimTypeInvalidFilter, "expected ( after not")
+		}
+		expr, err := p.parseGroup(tokenCloseParen)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expression: expr}, nil
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokenOpenParen:
+		return p.parseGroup(tokenCloseParen)
+	case tokenWord:
+	default:
+		return nil, Errorf(400, ScimTypeInvalidFilter, "unexpected %q", t.text)
+	}
+
+	attribute := attributeName(t.text)
+	if !p.done() && p.peek().kind == tokenOpenBracket {
+		p.next()
+		filter, err := p.parseGroup(tokenCloseBracket)
+		if err != nil {
+			return nil, err
+		}
+		return ValuePath{Attribute: attribute, Filter: filter}, nil
+	}
+
+	if p.done() || p.peek().kind != tokenWord {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "expected an operator after %s", t.text)
+	}
+	operator := strings.ToLower(p.next().text)
+	if operator == "pr" {
+		return Comparison{Attribute: attribute, Operator: operator}, nil
+	}
+	if !comparisonOperators[operator] {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "unknown operator %q", operator)
+	}
+
+	if p.done() {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "expected a value after %s", operator)
+	}
+	value, err := parseValue(p.next())
+	if err != nil {
+		return nil, err
+	}
+	return Comparison{Attribute: attribute, Operator: operator, Value: value}, nil
+}
+
+func (p *parser) parseGroup(closing tokenKind) (Expression, error) {
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.done() || p.next().kind != closing {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "unbalanced brackets")
+	}
+	return expr, nil
+}
+
+func parseValue(t token) (any, error) {
+	if t.kind == tokenString {
+		return t.text, nil
+	}
+	if t.kind != tokenWord {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "unexpected %q", t.text)
+	}
+
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal([]byte(t.text), &number); err != nil {
+		return nil, Errorf(400, ScimTypeInvalidFilter, "invalid value %q", t.text)
+	}
+	return number, nil
+}
@@ -0,0 +1,43 @@
+package scim
+
+import "strings"
+
+// Matches evaluates a filter against one value of a multi-valued attribute,
+// such as a group member, given as its lowercase sub-attributes. It is used
+// for PATCH paths like members[value eq "2"], so strings compare
+// case-insensitively and ordering operators aren't supported.
+func Matches(expr Expression, value map[string]string) bool {
+	switch e := expr.(type) {
+	case Logical:
+		if e.Operator == "and" {
+			return Matches(e.Left, value) && Matches(e.Right, value)
+		}
+		return Matches(e.Left, value) || Matches(e.Right, value)
+	case Not:
+		return !Matches(e.Expression, value)
+	case Comparison:
+		actual, present := value[e.Attribute]
+		present = present && actual != ""
+		if e.Operator == "pr" {
+			return present
+		}
+		if e.Value == nil {
+			return (e.Operator == "eq") != present
+		}
+
+		actual, expected := strings.ToLower(actual), strings.ToLower(stringValue(e.Value))
+		switch e.Operator {
+		case "eq":
+			return actual == expected
+		case "ne":
+			return actual != expected
+		case "co":
+			return strings.Contains(actual, expected)
+		case "sw":
+			return strings.HasPrefix(actual, expected)
+		case "ew":
+			return strings.HasSuffix(actual, expected)
+		}
+	}
+	return false
+}
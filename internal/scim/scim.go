@@ -0,0 +1,66 @@
+// Package scim implements the protocol parts of SCIM 2.0 (RFC 7643 and RFC
+// 7644) that the provisioning API needs: filters, PATCH paths and errors.
+// Mapping resources onto users and roles is left to the handlers.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Schema URNs.
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// ContentType is the media type of SCIM requests and responses.
+const ContentType = "application/scim+json"
+
+// Detail error types for 400 responses.
+const (
+	ScimTypeInvalidFilter = "invalidFilter"
+	ScimTypeInvalidSyntax = "invalidSyntax"
+	ScimTypeInvalidPath   = "invalidPath"
+	ScimTypeNoTarget      = "noTarget"
+	ScimTypeInvalidValue  = "invalidValue"
+	ScimTypeMutability    = "mutability"
+	ScimTypeUniqueness    = "uniqueness"
+	ScimTypeTooMany       = "tooMany"
+)
+
+// Error is a SCIM error response. ScimType is only used with status 400
+// and 409.
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func Errorf(status int, scimType, format string, args ...any) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// MarshalJSON writes the error in the SCIM error envelope.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail"`
+	}{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(e.Status),
+		ScimType: e.ScimType,
+		Detail:   e.Detail,
+	})
+}
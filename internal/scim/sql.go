@@ -0,0 +1,173 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttributeType decides how filter values are compared with a column.
+type AttributeType int
+
+const (
+	// String attributes compare case-insensitively unless CaseExact is set.
+	String AttributeType = iota
+	Boolean
+	DateTime
+	// ID is a resource ID, a string in SCIM and an integer column here.
+	ID
+)
+
+// Attribute maps a filterable attribute onto a column or SQL expression.
+type Attribute struct {
+	Column    string
+	Type      AttributeType
+	CaseExact bool
+}
+
+// SQL translates a filter into a WHERE clause over the given attributes,
+// keyed by lowercase attribute path. Filters on any other attribute are
+// rejected.
+func SQL(expr Expression, attributes map[string]Attribute) (string, []any, error) {
+	return compile(expr, "", attributes)
+}
+
+func compile(expr Expression, prefix string, attributes map[string]Attribute) (string, []any, error) {
+	switch e := expr.(type) {
+	case Logical:
+		left, leftArgs, err := compile(e.Left, prefix, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := compile(e.Right, prefix, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(e.Operator) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case Not:
+		inner, args, err := compile(e.Expression, prefix, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + inner, args, nil
+	case ValuePath:
+		return compile(e.Filter, prefix+e.Attribute+".", attributes)
+	case Comparison:
+		attribute, ok := attributes[prefix+e.Attribute]
+		if !ok {
+			return "", nil, Errorf(400, ScimTypeInvalidFilter, "filtering on %s is not supported", prefix+e.Attribute)
+		}
+		return compileComparison(attribute, e)
+	}
+	return "", nil, Errorf(400, ScimTypeInvalidFilter, "invalid filter")
+}
+
+func compileComparison(attribute Attribute, c Comparison) (string, []any, error) {
+	column := attribute.Column
+
+	present := column + " IS NOT NULL"
+	if attribute.Type == String {
+		present = "(" + column + " IS NOT NULL AND " + column + " <> '')"
+	}
+	switch {
+	case c.Operator == "pr":
+		return present, nil, nil
+	case c.Value == nil && c.Operator == "eq":
+		return "NOT " + present, nil, nil
+	case c.Value == nil && c.Operator == "ne":
+		return present, nil, nil
+	case c.Value == nil:
+		return "", nil, Errorf(400, ScimTypeInvalidFilter, "%s cannot compare with null", c.Operator)
+	}
+
+	switch attribute.Type {
+	case Boolean:
+		value, ok := c.Value.(bool)
+		if !ok || (c.Operator != "eq" && c.Operator != "ne") {
+			return "", nil, Errorf(400, ScimTypeInvalidFilter, "%s is a boolean", c.Attribute)
+		}
+		return column + " " + sqlOperator(c.Operator) + " ?", []any{value}, nil
+
+	case DateTime:
+		raw, ok := c.Value.(string)
+		value, err := time.Parse(time.RFC3339, raw)
+		if !ok || err != nil {
+			return "", nil, Errorf(400, ScimTypeInvalidFilter, "%s is a dateTime", c.Attribute)
+		}
+		if !ordered(c.Operator) && c.Operator != "eq" && c.Operator != "ne" {
+			return "", nil, Errorf(400, ScimTypeInvalidFilter, "%s cannot be used with a dateTime", c.Operator)
+		}
+		return column + " " + sqlOperator(c.Operator) + " ?", []any{value}, nil
+
+	case ID:
+		raw := stringValue(c.Value)
+		if c.Operator != "eq" && c.Operator != "ne" {
+			return "", nil, Errorf(400, ScimTypeInvalidFilter, "%s cannot be used with an id", c.Operator)
+		}
+		value, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			// No resource has an ID like that
+			if c.Operator == "eq" {
+				return "1 = 0", nil, nil
+			}
+			return "1 = 1", nil, nil
+		}
+		return column + " " + sqlOperator(c.Operator) + " ?", []any{value}, nil
+	}
+
+	value := stringValue(c.Value)
+	if !attribute.CaseExact {
+		column = "LOWER(" + column + ")"
+		value = strings.ToLower(value)
+	}
+	switch c.Operator {
+	case "co":
+		return column + ` LIKE ? ESCAPE '\'`, []any{"%" + escapeLike(value) + "%"}, nil
+	case "sw":
+		return column + ` LIKE ? ESCAPE '\'`, []any{escapeLike(value) + "%"}, nil
+	case "ew":
+		return column + ` LIKE ? ESCAPE '\'`, []any{"%" + escapeLike(value)}, nil
+	}
+	return column + " " + sqlOperator(c.Operator) + " ?", []any{value}, nil
+}
+
+func ordered(operator string) bool {
+	switch operator {
+	case "gt", "ge", "lt", "le":
+		return true
+	}
+	return false
+}
+
+func sqlOperator(operator string) string {
+	switch operator {
+	case "ne":
+		return "<>"
+	case "gt":
+		return ">"
+	case "ge":
+		return ">="
+	case "lt":
+		return "<"
+	case "le":
+		return "<="
+	}
+	return "="
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -7,12 +7,16 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"go-auth-boilerplate/config"
 	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/mailer"
 	"go-auth-boilerplate/internal/models"
 	"go-auth-boilerplate/internal/routes"
 
@@ -239,7 +243,7 @@ func setupTestInfrastructure(t *testing.T) (*TestInstance, error) {
 		return nil, fmt.Errorf("could not connect to postgres: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.Post{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Post{}, &models.RecoveryCode{}, &models.Role{}, &models.Permission{}, &models.PersonalAccessToken{}, &models.PasswordHistory{}, &models.OAuthClient{}, &models.Identity{}, &models.Passkey{}, &models.AuditEvent{}); err != nil {
 		return nil, fmt.Errorf("could not migrate database: %v", err)
 	}
 
@@ -259,32 +263,58 @@ func setupTestInfrastructure(t *testing.T) (*TestInstance, error) {
 }
 
 type TestServer struct {
-	App   *fiber.App
-	DB    *gorm.DB
-	Redis string
+	App    *fiber.App
+	DB     *gorm.DB
+	Redis  string
+	Config *config.Config
+	Outbox *mailer.MemorySender
 }
 
-func SetupRouter(db *gorm.DB, redisURL string) *fiber.App {
+func SetupRouter(cfg *config.Config, db *gorm.DB, redisURL string) *fiber.App {
 	app := fiber.New()
-	routes.SetupRoutes(app, db, redisURL)
+	routes.SetupRoutes(app, cfg, db, redisURL)
 	return app
 }
 
 func NewTestServer(t *testing.T) *TestServer {
+	return NewTestServerWithConfig(t, nil)
+}
+
+// NewTestServerWithConfig behaves like NewTestServer but lets the caller
+// adjust the loaded configuration before the routes are set up.
+func NewTestServerWithConfig(t *testing.T, configure func(cfg *config.Config)) *TestServer {
 	os.Setenv("JWT_SECRET", "test_secret")
+	// Every test server starts with fresh rate limit budgets
+	os.Setenv("RATE_LIMIT_STORE", "memory")
+	// Hash passwords cheaply; production parameters make every signup and
+	// login take a noticeable fraction of a second
+	os.Setenv("ARGON2_MEMORY", "1024")
+	os.Setenv("ARGON2_ITERATIONS", "1")
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	if configure != nil {
+		configure(cfg)
+	}
 
 	instance := NewTestInstance(t)
 
 	opt, err := redis.ParseURL(instance.RedisURL)
 	require.NoError(t, err)
 	database.RedisClient = redis.NewClient(opt)
+	database.DB = instance.DB
+
+	app := SetupRouter(cfg, instance.DB, instance.RedisURL)
 
-	app := SetupRouter(instance.DB, instance.RedisURL)
+	outbox := &mailer.MemorySender{}
+	mailer.SetSender(outbox)
 
 	return &TestServer{
-		App:   app,
-		DB:    instance.DB,
-		Redis: instance.RedisURL,
+		App:    app,
+		DB:     instance.DB,
+		Redis:  instance.RedisURL,
+		Config: cfg,
+		Outbox: outbox,
 	}
 }
 
@@ -311,6 +341,18 @@ func (ts *TestServer) SendRequest(t *testing.T, method, path string, body interf
 		req.Header.Set(key, value)
 	}
 
+	return ts.do(t, req)
+}
+
+// SendForm posts a URL-encoded form, as a browser does when an identity
+// provider hands it a SAML response.
+func (ts *TestServer) SendForm(t *testing.T, path string, form url.Values) *TestResponse {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ts.do(t, req)
+}
+
+func (ts *TestServer) do(t *testing.T, req *http.Request) *TestResponse {
 	resp, err := ts.App.Test(req)
 	require.NoError(t, err)
 
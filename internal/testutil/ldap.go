@@ -0,0 +1,267 @@
+package testutil
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	MockLDAPBaseDN          = "dc=example,dc=com"
+	MockLDAPServiceDN       = "cn=service,dc=example,dc=com"
+	MockLDAPServicePassword = "service-password"
+)
+
+// LDAPEntry is a directory entry. Password, if set, is what binding as the
+// entry's DN takes.
+type LDAPEntry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// MockLDAPServer is an in-process LDAP directory for testing the LDAP
+// authenticator. It understands simple binds and subtree searches with
+// equality, presence and boolean filters, which is all the authenticator
+// needs.
+type MockLDAPServer struct {
+	URL string
+
+	listener net.Listener
+	mu       sync.Mutex
+	entries  map[string]LDAPEntry
+}
+
+func NewMockLDAPServer(t *testing.T) *MockLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &MockLDAPServer{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		entries:  map[string]LDAPEntry{},
+	}
+	server.AddEntry(LDAPEntry{DN: MockLDAPServiceDN, Password: MockLDAPServicePassword})
+
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+// Config returns settings for the LDAP authenticator pointing at the server.
+func (s *MockLDAPServer) Config() config.LDAPConfig {
+	return config.LDAPConfig{
+		URL:                s.URL,
+		BindDN:             MockLDAPServiceDN,
+		BindPassword:       MockLDAPServicePassword,
+		BaseDN:             MockLDAPBaseDN,
+		UserFilter:         "(&(objectClass=person)(mail=%s))",
+		IDAttribute:        "entryUUID",
+		EmailAttribute:     "mail",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		GroupAttribute:     "memberOf",
+		GroupRoles:         map[string]string{},
+		Timeout:            5 * time.Second,
+	}
+}
+
+// AddEntry adds an entry, replacing any with the same DN.
+func (s *MockLDAPServer) AddEntry(entry LDAPEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[strings.ToLower(entry.DN)] = entry
+}
+
+func (s *MockLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *MockLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op)
+			s.write(conn, messageID, ldapResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			entries, code := s.search(op)
+			for _, entry := range entries {
+				s.write(conn, messageID, entry)
+			}
+			s.write(conn, messageID, ldapResult(ldap.ApplicationSearchResultDone, code))
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *MockLDAPServer) write(conn io.Writer, messageID int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	conn.Write(packet.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return op
+}
+
+func (s *MockLDAPServer) bind(op *ber.Packet) uint16 {
+	if len(op.Children) < 3 {
+		return ldap.LDAPResultProtocolError
+	}
+	dn, _ := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+	if dn == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[strings.ToLower(dn)]
+	if !ok || entry.Password == "" || entry.Password != password {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	return ldap.LDAPResultSuccess
+}
+
+func (s *MockLDAPServer) search(op *ber.Packet) ([]*ber.Packet, uint16) {
+	if len(op.Children) < 8 {
+		return nil, ldap.LDAPResultProtocolError
+	}
+	baseDN, err := ldap.ParseDN(op.Children[0].Value.(string))
+	if err != nil {
+		return nil, ldap.LDAPResultInvalidDNSyntax
+	}
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var requested []string
+	for _, attribute := range op.Children[7].Children {
+		requested = append(requested, attribute.Value.(string))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []*ber.Packet
+	for _, entry := range s.entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil || !(baseDN.EqualFold(dn) || baseDN.AncestorOfFold(dn)) || !matchesFilter(entry, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(results)) == sizeLimit {
+			return results, ldap.LDAPResultSizeLimitExceeded
+		}
+		results = append(results, searchResultEntry(entry, requested))
+	}
+	return results, ldap.LDAPResultSuccess
+}
+
+func searchResultEntry(entry LDAPEntry, requested []string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.Attributes {
+		if len(requested) > 0 && !containsFold(requested, name) {
+			continue
+		}
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	packet.AppendChild(attributes)
+
+	return packet
+}
+
+// matchesFilter evaluates and, or, not, equality and presence filters.
+// Attribute names and values are compared without regard to case.
+func matchesFilter(entry LDAPEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchesFilter(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchesFilter(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matchesFilter(entry, filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		return containsFold(attributeValues(entry, name), value)
+	case ldap.FilterPresent:
+		return len(attributeValues(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func attributeValues(entry LDAPEntry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package testutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const mockOIDCKeyID = "mock-key"
+
+// MockOIDCProvider is a minimal OpenID Connect provider for testing logins
+// through external identity providers. Tests play the user's part with
+// Login, which returns what the provider would redirect back with.
+type MockOIDCProvider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	redirectURI   string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func NewMockOIDCProvider(t *testing.T) *MockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	provider := &MockOIDCProvider{
+		ClientID:     "mock-client",
+		ClientSecret: "mock-secret",
+		key:          key,
+		codes:        map[string]mockAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/jwks", provider.jwks)
+	mux.HandleFunc("/token", provider.token)
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Server.Close)
+
+	return provider
+}
+
+func (p *MockOIDCProvider) Issuer() string {
+	return p.Server.URL
+}
+
+// Config returns the settings to register the provider under name.
+func (p *MockOIDCProvider) Config(name string) config.IdentityProviderConfig {
+	return config.IdentityProviderConfig{
+		Name:         name,
+		DisplayName:  "Mock " + name,
+		Issuer:       p.Issuer(),
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  "http://localhost:3000/login/" + name + "/callback",
+	}
+}
+
+// Login has the user log in at the provider through authorizationURL and
+// returns the code and state it redirects back with. The ID token will carry
+// claims on top of the standard ones, which they can override.
+func (p *MockOIDCProvider) Login(t *testing.T, authorizationURL string, claims map[string]any) (code, state string) {
+	target, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	query := target.Query()
+
+	require.Equal(t, p.Issuer()+"/authorize", target.Scheme+"://"+target.Host+target.Path)
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, p.ClientID, query.Get("client_id"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.NotEmpty(t, query.Get("state"))
+
+	idClaims := jwt.MapClaims{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code, err = auth.RandomToken(16)
+	require.NoError(t, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = mockAuthorization{
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        idClaims,
+	}
+
+	return code, query.Get("state")
+}
+
+func (p *MockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *MockOIDCProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.JWKSet{Keys: []auth.JWK{{
+		Kty: "RSA",
+		Kid: mockOIDCKeyID,
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func (p *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostForm.Get("code")
+	authorization, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok ||
+		authorization.redirectURI != r.PostForm.Get("redirect_uri") ||
+		authorization.codeChallenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, authorization.claims)
+	token.Header["kid"] = mockOIDCKeyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,221 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/saml"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	MockSAMLIdPEntityID = "https://idp.example.com/metadata"
+	MockSAMLIdPSSOURL   = "https://idp.example.com/sso"
+)
+
+// MockSAMLIdP is a SAML identity provider with a locally generated key pair
+// that issues canned responses.
+type MockSAMLIdP struct {
+	key             *rsa.PrivateKey
+	cert            *x509.Certificate
+	certificateFile string
+}
+
+// SAMLAssertion describes the response the mock IdP issues. Zero values get
+// sensible defaults; Audience and Recipient come from the tenant.
+type SAMLAssertion struct {
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	Attributes   map[string]string
+	Issuer       string
+	Audience     string
+	Recipient    string
+	IssuedAt     time.Time
+	// SignResponse signs the whole response instead of the assertion, as
+	// some IdPs do. Unsigned leaves both unsigned.
+	SignResponse bool
+	Unsigned     bool
+}
+
+func NewMockSAMLIdP(t *testing.T) *MockSAMLIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	certificateFile := filepath.Join(t.TempDir(), "idp.pem")
+	require.NoError(t, os.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+	return &MockSAMLIdP{key: key, cert: cert, certificateFile: certificateFile}
+}
+
+// Config returns the configuration of a tenant using this IdP, with its
+// service provider endpoints under baseURL.
+func (idp *MockSAMLIdP) Config(name, baseURL, appURL string) config.SAMLTenantConfig {
+	return config.SAMLTenantConfig{
+		Name:               name,
+		EntityID:           baseURL + "/saml/" + name + "/metadata",
+		ACSURL:             baseURL + "/saml/" + name + "/acs",
+		IDPEntityID:        MockSAMLIdPEntityID,
+		IDPSSOURL:          MockSAMLIdPSSOURL,
+		IDPCertificateFile: idp.certificateFile,
+		EmailAttribute:     "email",
+		FirstNameAttribute: "first_name",
+		LastNameAttribute:  "last_name",
+		RedirectURL:        appURL + "/login/saml/callback",
+	}
+}
+
+// AuthnRequestID decodes the AuthnRequest in a redirect to the IdP and
+// returns its ID.
+func (idp *MockSAMLIdP) AuthnRequestID(t *testing.T, redirectURL string) string {
+	parsed, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+	compressed, err := base64.StdEncoding.DecodeString(parsed.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	require.NoError(t, err)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(raw))
+	require.Equal(t, "AuthnRequest", doc.Root().Tag)
+	return doc.Root().SelectAttrValue("ID", "")
+}
+
+// Response builds a base64 SAMLResponse for the tenant, ready to be posted
+// to its ACS.
+func (idp *MockSAMLIdP) Response(t *testing.T, tenant config.SAMLTenantConfig, a SAMLAssertion) string {
+	raw, err := idp.response(t, tenant, a).WriteToBytes()
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func (idp *MockSAMLIdP) response(t *testing.T, tenant config.SAMLTenantConfig, a SAMLAssertion) *etree.Document {
+	if a.IssuedAt.IsZero() {
+		a.IssuedAt = time.Now()
+	}
+	if a.NameIDFormat == "" {
+		a.NameIDFormat = saml.NameIDFormatPersistent
+	}
+	if a.Issuer == "" {
+		a.Issuer = MockSAMLIdPEntityID
+	}
+	if a.Audience == "" {
+		a.Audience = tenant.EntityID
+	}
+	if a.Recipient == "" {
+		a.Recipient = tenant.ACSURL
+	}
+	issued := a.IssuedAt.UTC().Format(time.RFC3339)
+	expires := a.IssuedAt.Add(5 * time.Minute).UTC().Format(time.RFC3339)
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", "urn:oasis:names:tc:SAML:2.0:assertion")
+	assertion.CreateAttr("ID", randomSAMLID(t))
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", issued)
+	assertion.CreateElement("saml:Issuer").SetText(a.Issuer)
+
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", a.NameIDFormat)
+	nameID.SetText(a.NameID)
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer")
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	data.CreateAttr("NotOnOrAfter", expires)
+	data.CreateAttr("Recipient", a.Recipient)
+	if a.InResponseTo != "" {
+		data.CreateAttr("InResponseTo", a.InResponseTo)
+	}
+
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", a.IssuedAt.Add(-time.Minute).UTC().Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", expires)
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(a.Audience)
+
+	statement := assertion.CreateElement("saml:AuthnStatement")
+	statement.CreateAttr("AuthnInstant", issued)
+	statement.CreateAttr("SessionIndex", randomSAMLID(t))
+	statement.CreateElement("saml:AuthnContext").CreateElement("saml:AuthnContextClassRef").
+		SetText("urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport")
+
+	if len(a.Attributes) > 0 {
+		attributes := assertion.CreateElement("saml:AttributeStatement")
+		for name, value := range a.Attributes {
+			attribute := attributes.CreateElement("saml:Attribute")
+			attribute.CreateAttr("Name", name)
+			attribute.CreateElement("saml:AttributeValue").SetText(value)
+		}
+	}
+
+	if !a.Unsigned && !a.SignResponse {
+		assertion = idp.sign(t, assertion)
+	}
+
+	response := etree.NewElement("samlp:Response")
+	response.CreateAttr("xmlns:samlp", "urn:oasis:names:tc:SAML:2.0:protocol")
+	response.CreateAttr("xmlns:saml", "urn:oasis:names:tc:SAML:2.0:assertion")
+	response.CreateAttr("ID", randomSAMLID(t))
+	response.CreateAttr("Version", "2.0")
+	response.CreateAttr("IssueInstant", issued)
+	response.CreateAttr("Destination", tenant.ACSURL)
+	if a.InResponseTo != "" {
+		response.CreateAttr("InResponseTo", a.InResponseTo)
+	}
+	response.CreateElement("saml:Issuer").SetText(a.Issuer)
+	response.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").
+		CreateAttr("Value", "urn:oasis:names:tc:SAML:2.0:status:Success")
+	response.AddChild(assertion)
+
+	if !a.Unsigned && a.SignResponse {
+		response = idp.sign(t, response)
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(response)
+	return doc
+}
+
+func (idp *MockSAMLIdP) sign(t *testing.T, el *etree.Element) *etree.Element {
+	ctx, err := dsig.NewSigningContext(idp.key, [][]byte{idp.cert.Raw})
+	require.NoError(t, err)
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := ctx.SignEnveloped(el)
+	require.NoError(t, err)
+	return signed
+}
+
+func randomSAMLID(t *testing.T) string {
+	id, err := saml.NewRequestID()
+	require.NoError(t, err)
+	return id
+}
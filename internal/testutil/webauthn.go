@@ -0,0 +1,185 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/webauthn"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// SoftAuthenticator is a software WebAuthn authenticator holding ES256
+// passkeys. It answers the options the server hands out the way a browser
+// would, returning the JSON of PublicKeyCredential.toJSON().
+type SoftAuthenticator struct {
+	Origin string
+	// Attestation is the format used at registration: "none" or "packed"
+	// self attestation.
+	Attestation string
+	// UserVerified is whether the user is reported as verified, as after a
+	// PIN or fingerprint.
+	UserVerified bool
+
+	credentials []*softCredential
+}
+
+type softCredential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	rpID       string
+	userHandle []byte
+	signCount  uint32
+}
+
+func NewSoftAuthenticator(origin string) *SoftAuthenticator {
+	return &SoftAuthenticator{
+		Origin:       origin,
+		Attestation:  webauthn.AttestationNone,
+		UserVerified: true,
+	}
+}
+
+// Clone returns an authenticator holding copies of the same passkeys,
+// counters included, as an attacker who extracted them would.
+func (a *SoftAuthenticator) Clone() *SoftAuthenticator {
+	clone := *a
+	clone.credentials = nil
+	for _, credential := range a.credentials {
+		copied := *credential
+		clone.credentials = append(clone.credentials, &copied)
+	}
+	return &clone
+}
+
+// Register creates a passkey for the creation options and returns the
+// credential to send to the server.
+func (a *SoftAuthenticator) Register(t *testing.T, options models.PasskeyCreationOptions) map[string]any {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	userHandle, err := webauthn.DecodeBase64(options.User.ID)
+	require.NoError(t, err)
+
+	credential := &softCredential{id: id, key: key, rpID: options.RP.ID, userHandle: userHandle}
+	a.credentials = append(a.credentials, credential)
+
+	publicKey, err := cbor.Marshal(map[int]any{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	authData := a.authenticatorData(credential, 0x40)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	clientDataJSON := a.clientData(t, "webauthn.create", options.Challenge)
+
+	statement := map[string]any{}
+	if a.Attestation == webauthn.AttestationPacked {
+		statement["alg"] = -7
+		statement["sig"] = signAssertion(t, key, authData, clientDataJSON)
+	}
+	attestationObject, err := cbor.Marshal(map[string]any{
+		"fmt":      a.Attestation,
+		"attStmt":  statement,
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	return map[string]any{
+		"id":    webauthn.EncodeBase64(id),
+		"rawId": webauthn.EncodeBase64(id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    webauthn.EncodeBase64(clientDataJSON),
+			"attestationObject": webauthn.EncodeBase64(attestationObject),
+			"transports":        []string{"internal"},
+		},
+	}
+}
+
+// Assert signs the request options' challenge with the first passkey they
+// allow, or any passkey for the relying party if they allow all, and
+// returns the credential to send to the server.
+func (a *SoftAuthenticator) Assert(t *testing.T, options models.PasskeyRequestOptions) map[string]any {
+	credential := a.find(options)
+	require.NotNil(t, credential, "no matching passkey")
+
+	credential.signCount++
+	authData := a.authenticatorData(credential, 0)
+	clientDataJSON := a.clientData(t, "webauthn.get", options.Challenge)
+
+	return map[string]any{
+		"id":    webauthn.EncodeBase64(credential.id),
+		"rawId": webauthn.EncodeBase64(credential.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    webauthn.EncodeBase64(clientDataJSON),
+			"authenticatorData": webauthn.EncodeBase64(authData),
+			"signature":         webauthn.EncodeBase64(signAssertion(t, credential.key, authData, clientDataJSON)),
+			"userHandle":        webauthn.EncodeBase64(credential.userHandle),
+		},
+	}
+}
+
+func (a *SoftAuthenticator) find(options models.PasskeyRequestOptions) *softCredential {
+	for _, credential := range a.credentials {
+		if credential.rpID != options.RPID {
+			continue
+		}
+		if len(options.AllowCredentials) == 0 {
+			return credential
+		}
+		for _, allowed := range options.AllowCredentials {
+			if allowed.ID == webauthn.EncodeBase64(credential.id) {
+				return credential
+			}
+		}
+	}
+	return nil
+}
+
+func (a *SoftAuthenticator) authenticatorData(credential *softCredential, flags byte) []byte {
+	flags |= 0x01 // user present
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(credential.rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, credential.signCount)
+}
+
+func (a *SoftAuthenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	clientDataJSON, err := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	require.NoError(t, err)
+	return clientDataJSON
+}
+
+func signAssertion(t *testing.T, key *ecdsa.PrivateKey, authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	return signature
+}
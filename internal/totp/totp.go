@@ -0,0 +1,103 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters every common authenticator app supports: HMAC-SHA1, 6 digits
+// and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// skew is how many periods before and after the current one are
+	// accepted, to tolerate clock drift between server and device.
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random 160-bit secret in base32, the format
+// authenticator apps expect.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningURI returns the otpauth:// URI that authenticator apps import,
+// usually by scanning it as a QR code.
+func ProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period.Seconds())))
+	// Some authenticators show a literal "+" for spaces in the issuer
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// Code returns the code for the given secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return code(key, counter(t)), nil
+}
+
+// Validate checks a code against the secret at time t. On success it returns
+// the time step the code belongs to, which callers should remember to refuse
+// replays of the same code.
+func Validate(secret, passcode string, t time.Time) (uint64, bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	passcode = strings.ReplaceAll(passcode, " ", "")
+	if len(passcode) != Digits {
+		return 0, false
+	}
+
+	current := counter(t)
+	for i := -skew; i <= skew; i++ {
+		step := current + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(code(key, step)), []byte(passcode)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(Period.Seconds())
+}
+
+func code(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
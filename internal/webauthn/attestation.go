@@ -0,0 +1,93 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Attestation formats.
+const (
+	AttestationNone   = "none"
+	AttestationPacked = "packed"
+)
+
+// oidAAGUID is the certificate extension packed attestation certificates
+// use to name the authenticator model.
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+func verifyAttestation(format string, statement cbor.RawMessage, rawAuthData, clientDataHash []byte, authData *AuthenticatorData, key *publicKey) error {
+	switch format {
+	case AttestationNone:
+		var fields map[string]cbor.RawMessage
+		if err := cbor.Unmarshal(statement, &fields); err != nil || len(fields) != 0 {
+			return fmt.Errorf("%w: \"none\" attestation with a statement", ErrInvalidResponse)
+		}
+		return nil
+	case AttestationPacked:
+		return verifyPacked(statement, append(append([]byte{}, rawAuthData...), clientDataHash...), authData, key)
+	}
+	return fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidResponse, format)
+}
+
+// verifyPacked checks a "packed" attestation statement. Without a
+// certificate it is self attestation, signed by the credential itself.
+func verifyPacked(raw cbor.RawMessage, signed []byte, authData *AuthenticatorData, key *publicKey) error {
+	var statement struct {
+		Alg int64    `cbor:"alg"`
+		Sig []byte   `cbor:"sig"`
+		X5C [][]byte `cbor:"x5c"`
+	}
+	if err := cbor.Unmarshal(raw, &statement); err != nil {
+		return fmt.Errorf("%w: packed attestation: %v", ErrInvalidResponse, err)
+	}
+
+	if len(statement.X5C) == 0 {
+		if statement.Alg != key.alg {
+			return fmt.Errorf("%w: self attestation algorithm does not match the credential", ErrInvalidResponse)
+		}
+		return key.verify(signed, statement.Sig)
+	}
+
+	cert, err := x509.ParseCertificate(statement.X5C[0])
+	if err != nil {
+		return fmt.Errorf("%w: attestation certificate: %v", ErrInvalidResponse, err)
+	}
+	if err := verifySignature(statement.Alg, cert.PublicKey, signed, statement.Sig); err != nil {
+		return err
+	}
+
+	// Certificate requirements from section 8.2.1 of the specification
+	if cert.Version != 3 || !cert.BasicConstraintsValid || cert.IsCA {
+		return fmt.Errorf("%w: attestation certificate is not a version 3 end-entity certificate", ErrInvalidResponse)
+	}
+	if !contains(cert.Subject.OrganizationalUnit, "Authenticator Attestation") {
+		return fmt.Errorf("%w: attestation certificate has the wrong subject", ErrInvalidResponse)
+	}
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(oidAAGUID) {
+			continue
+		}
+		if extension.Critical {
+			return fmt.Errorf("%w: AAGUID extension is marked critical", ErrInvalidResponse)
+		}
+		var aaguid []byte
+		if _, err := asn1.Unmarshal(extension.Value, &aaguid); err != nil || !bytes.Equal(aaguid, authData.AAGUID) {
+			return fmt.Errorf("%w: attestation certificate is for another authenticator", ErrInvalidResponse)
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers of the supported credential types, in the
+// order servers should offer them.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key types and curves.
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key (RFC 9053). The parameters with negative
+// labels mean different things for each key type, so they are decoded
+// individually.
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	var fields map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("%w: credential public key: %v", ErrInvalidResponse, err)
+	}
+
+	var kty, alg int64
+	if err := coseField(fields, 1, &kty); err != nil {
+		return nil, err
+	}
+	if err := coseField(fields, 3, &alg); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		var crv int64
+		var x, y []byte
+		if err := coseFields(fields, map[int64]interface{}{-1: &crv, -2: &x, -3: &y}); err != nil {
+			return nil, err
+		}
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: unsupported EC2 key", ErrInvalidResponse)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: EC2 key is not on the curve", ErrInvalidResponse)
+		}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		var crv int64
+		var x []byte
+		if err := coseFields(fields, map[int64]interface{}{-1: &crv, -2: &x}); err != nil {
+			return nil, err
+		}
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: unsupported OKP key", ErrInvalidResponse)
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		var n, e []byte
+		if err := coseFields(fields, map[int64]interface{}{-1: &n, -2: &e}); err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: unsupported RSA key", ErrInvalidResponse)
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrInvalidResponse, kty, alg)
+}
+
+func coseField(fields map[int64]cbor.RawMessage, label int64, v interface{}) error {
+	raw, ok := fields[label]
+	if !ok {
+		return fmt.Errorf("%w: credential public key has no parameter %d", ErrInvalidResponse, label)
+	}
+	if err := cbor.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: credential public key parameter %d: %v", ErrInvalidResponse, label, err)
+	}
+	return nil
+}
+
+func coseFields(fields map[int64]cbor.RawMessage, values map[int64]interface{}) error {
+	for label, v := range values {
+		if err := coseField(fields, label, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *publicKey) verify(data, signature []byte) error {
+	return verifySignature(k.alg, k.key, data, signature)
+}
+
+// verifySignature checks a WebAuthn signature: ASN.1 DER for ECDSA, raw for
+// EdDSA and PKCS #1 v1.5 for RSA.
+func verifySignature(alg int64, key crypto.PublicKey, data, signature []byte) error {
+	ok := false
+	switch alg {
+	case AlgES256:
+		if key, isECDSA := key.(*ecdsa.PublicKey); isECDSA {
+			digest := sha256.Sum256(data)
+			ok = ecdsa.VerifyASN1(key, digest[:], signature)
+		}
+	case AlgEdDSA:
+		if key, isEd25519 := key.(ed25519.PublicKey); isEd25519 {
+			ok = ed25519.Verify(key, data, signature)
+		}
+	case AlgRS256:
+		if key, isRSA := key.(*rsa.PublicKey); isRSA {
+			digest := sha256.Sum256(data)
+			ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%w: bad signature", ErrInvalidResponse)
+	}
+	return nil
+}
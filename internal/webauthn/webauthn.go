@@ -0,0 +1,263 @@
+// Package webauthn verifies the browser's responses to the WebAuthn
+// registration and authentication ceremonies
+// (https://www.w3.org/TR/webauthn-2/). It supports "none" and "packed"
+// attestation and ES256, EdDSA and RS256 credentials. Attestation
+// certificates are checked for consistency but not chained to a trust root,
+// so attestation proves the response is well formed, not which vendor made
+// the authenticator.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagBackupEligible         = 0x08
+	flagAttestedCredentialData = 0x40
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid WebAuthn response")
+	// ErrSignCount means the authenticator's signature counter went
+	// backwards, which happens when a credential has been cloned.
+	ErrSignCount = errors.New("WebAuthn signature counter did not increase")
+)
+
+// RelyingParty is this service as WebAuthn sees it. ID is the domain
+// credentials are scoped to and Origins the pages allowed to use them.
+type RelyingParty struct {
+	ID      string
+	Origins []string
+}
+
+// ClientData is the part of clientDataJSON the server checks.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParseClientData decodes clientDataJSON. Servers look up the ceremony by
+// its Challenge before verifying the rest of the response.
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+	return &clientData, nil
+}
+
+// AuthenticatorData is the authenticator's signed statement about the
+// ceremony. The credential fields are only set during registration.
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func (d *AuthenticatorData) UserVerified() bool {
+	return d.Flags&flagUserVerified != 0
+}
+
+func (d *AuthenticatorData) BackupEligible() bool {
+	return d.Flags&flagBackupEligible != 0
+}
+
+// Credential is a newly registered public key credential. PublicKey is the
+// COSE_Key as sent by the authenticator; store it as is.
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte
+	SignCount         uint32
+	AAGUID            []byte
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create()
+// for the given challenge and returns the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte, requireUserVerification bool) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	var attestation struct {
+		Format   string          `cbor:"fmt"`
+		AttStmt  cbor.RawMessage `cbor:"attStmt"`
+		AuthData []byte          `cbor:"authData"`
+	}
+	if err := cbor.Unmarshal(attestationObject, &attestation); err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrInvalidResponse, err)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(attestation.AuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+
+	key, err := parsePublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := verifyAttestation(attestation.Format, attestation.AttStmt, attestation.AuthData, clientDataHash[:], authData, key); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.CredentialID,
+		PublicKey:         authData.PublicKey,
+		SignCount:         authData.SignCount,
+		AAGUID:            authData.AAGUID,
+		AttestationFormat: attestation.Format,
+		UserVerified:      authData.UserVerified(),
+		BackupEligible:    authData.BackupEligible(),
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get() for the
+// given challenge against a stored credential. signCount is the counter
+// stored with the credential; the caller should store the returned one.
+func (rp RelyingParty) VerifyAssertion(challenge string, publicKey []byte, signCount uint32, clientDataJSON, authenticatorData, signature []byte, requireUserVerification bool) (*AuthenticatorData, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(authenticatorData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := key.verify(append(append([]byte{}, authenticatorData...), clientDataHash[:]...), signature); err != nil {
+		return nil, err
+	}
+
+	// Authenticators that don't keep a counter always report zero
+	if (authData.SignCount != 0 || signCount != 0) && authData.SignCount <= signCount {
+		return nil, ErrSignCount
+	}
+
+	return authData, nil
+}
+
+func (rp RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	clientData, err := ParseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: client data type is %q", ErrInvalidResponse, clientData.Type)
+	}
+	if challenge == "" || clientData.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if clientData.CrossOrigin || !rp.allowedOrigin(clientData.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidResponse, clientData.Origin)
+	}
+	return nil
+}
+
+func (rp RelyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.Origins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp RelyingParty) verifyAuthenticatorData(raw []byte, requireUserVerification bool) (*AuthenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: credential is for another relying party", ErrInvalidResponse)
+	}
+	if authData.Flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+	if requireUserVerification && !authData.UserVerified() {
+		return nil, fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+
+	return authData, nil
+}
+
+func parseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	authData := &AuthenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if authData.Flags&flagAttestedCredentialData == 0 {
+		return authData, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+	}
+	authData.AAGUID = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || len(rest) < idLength {
+		return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+	}
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	// The key is followed by extensions, if any, so only the first CBOR item
+	// belongs to it
+	var publicKey cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest, &publicKey); err != nil {
+		return nil, fmt.Errorf("%w: credential public key: %v", ErrInvalidResponse, err)
+	}
+	authData.PublicKey = publicKey
+
+	return authData, nil
+}
+
+// DecodeBase64 decodes the base64url values WebAuthn JSON uses for binary
+// fields, with or without padding.
+func DecodeBase64(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// EncodeBase64 encodes binary fields for WebAuthn JSON.
+func EncodeBase64(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
@@ -52,14 +52,14 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.Server.AllowOrigins,
 		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Device-Name, X-CSRF-Token",
 		AllowMethods:     "GET, POST, PATCH, DELETE",
 	}))
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
 	redisURL := fmt.Sprintf("redis://%s:%s", cfg.Redis.Host, cfg.Redis.Port)
-	routes.SetupRoutes(app, database.DB, redisURL)
+	routes.SetupRoutes(app, cfg, database.DB, redisURL)
 
 	log.Printf("Server starting on port %s", cfg.Server.Port)
 	log.Fatal(app.Listen(":" + cfg.Server.Port))
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at);
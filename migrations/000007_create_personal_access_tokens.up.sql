@@ -0,0 +1,13 @@
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
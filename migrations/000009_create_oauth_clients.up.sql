@@ -0,0 +1,12 @@
+CREATE TABLE oauth_clients (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL UNIQUE,
+    secret_hash VARCHAR(64) NOT NULL DEFAULT '',
+    name VARCHAR(100) NOT NULL,
+    redirect_uris TEXT NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT '',
+    grant_types TEXT NOT NULL DEFAULT '',
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+CREATE TABLE identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_identities_provider_subject ON identities(provider, subject);
+CREATE UNIQUE INDEX idx_identities_user_id_provider ON identities(user_id, provider);
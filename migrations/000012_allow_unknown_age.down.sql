@@ -0,0 +1,2 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_age_check;
+ALTER TABLE users ADD CONSTRAINT users_age_check CHECK (age > 0 AND age < 150);
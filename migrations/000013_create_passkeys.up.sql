@@ -0,0 +1,17 @@
+CREATE TABLE passkeys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL DEFAULT '',
+    credential_id BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid BYTEA,
+    attestation_format VARCHAR(32) NOT NULL DEFAULT '',
+    transports VARCHAR(255) NOT NULL DEFAULT '',
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_passkeys_credential_id ON passkeys(credential_id);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
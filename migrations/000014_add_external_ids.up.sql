@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN external_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE roles ADD COLUMN external_id VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_users_external_id ON users(external_id);
+CREATE INDEX idx_roles_external_id ON roles(external_id);
@@ -0,0 +1,31 @@
+-- Events keep the IDs of their actor and target after those are deleted, so
+-- there are no foreign keys
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    action VARCHAR(64) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    reason VARCHAR(64) NOT NULL DEFAULT '',
+    actor_id INTEGER,
+    target_type VARCHAR(32) NOT NULL DEFAULT '',
+    target_id INTEGER,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_target ON audit_events(target_type, target_id);
+CREATE INDEX idx_audit_events_action ON audit_events(action);
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
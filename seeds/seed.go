@@ -38,7 +38,7 @@ func createUserIfNotExists(user *models.User) error {
 	var existingUser models.User
 	err := database.DB.Where("email = ?", user.Email).First(&existingUser).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		if err := user.BeforeSave(nil); err != nil {
+		if err := user.SetPassword(user.Password); err != nil {
 			return err
 		}
 		if err := database.DB.Create(user).Error; err != nil {
@@ -55,15 +55,86 @@ func createUserIfNotExists(user *models.User) error {
 	return nil
 }
 
+var permissions = []models.Permission{
+	{Name: models.PermissionPostsDeleteAny, Description: "Delete posts written by any user"},
+	{Name: models.PermissionRolesRead, Description: "View roles and role assignments"},
+	{Name: models.PermissionRolesAssign, Description: "Assign and remove user roles"},
+	{Name: models.PermissionUsersRead, Description: "List and view user accounts"},
+	{Name: models.PermissionUsersManage, Description: "Suspend, sign out, reset and delete user accounts"},
+	{Name: models.PermissionOAuthClients, Description: "Register and remove OAuth client applications"},
+	{Name: models.PermissionAuditRead, Description: "View the security audit log"},
+}
+
+var roles = map[string][]string{
+	models.RoleAdmin: {
+		models.PermissionPostsDeleteAny,
+		models.PermissionRolesRead,
+		models.PermissionRolesAssign,
+		models.PermissionUsersRead,
+		models.PermissionUsersManage,
+		models.PermissionOAuthClients,
+		models.PermissionAuditRead,
+	},
+	models.RoleUser: {},
+}
+
+// SeedRoles creates the default roles and permissions. It is safe to run
+// repeatedly; existing roles get their default permissions added back.
+func SeedRoles() error {
+	byName := make(map[string]models.Permission)
+	for _, permission := range permissions {
+		if err := database.DB.Where("name = ?", permission.Name).FirstOrCreate(&permission).Error; err != nil {
+			return err
+		}
+		byName[permission.Name] = permission
+	}
+
+	for name, granted := range roles {
+		role := models.Role{Name: name}
+		if err := database.DB.Where("name = ?", name).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+
+		var rolePermissions []models.Permission
+		for _, permission := range granted {
+			rolePermissions = append(rolePermissions, byName[permission])
+		}
+		if len(rolePermissions) > 0 {
+			if err := database.DB.Model(&role).Association("Permissions").Append(rolePermissions); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func assignRole(user *models.User, name string) error {
+	var role models.Role
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		return err
+	}
+	return database.DB.Model(user).Association("Roles").Append(&role)
+}
+
 func Seed() error {
 	rand.Seed(time.Now().UnixNano())
 
+	if err := SeedRoles(); err != nil {
+		log.Printf("Error seeding roles: %v", err)
+		return err
+	}
+
+	// Seeded accounts skip email verification
+	verifiedAt := time.Now()
+
 	testUser := models.User{
-		FirstName: "Anton",
-		LastName:  "Kalik",
-		Age:       40,
-		Email:     "antonkalik@gmail.com",
-		Password:  "Pass123",
+		FirstName:       "Anton",
+		LastName:        "Kalik",
+		Age:             40,
+		Email:           "antonkalik@gmail.com",
+		Password:        "Pass123",
+		EmailVerifiedAt: &verifiedAt,
 	}
 
 	if err := createUserIfNotExists(&testUser); err != nil {
@@ -71,6 +142,11 @@ func Seed() error {
 		return err
 	}
 
+	if err := assignRole(&testUser, models.RoleAdmin); err != nil {
+		log.Printf("Error assigning admin role: %v", err)
+		return err
+	}
+
 	var postCount int64
 	database.DB.Model(&models.Post{}).Where("user_id = ?", testUser.ID).Count(&postCount)
 
@@ -87,24 +163,30 @@ func Seed() error {
 
 	additionalUsers := []models.User{
 		{
-			FirstName: "John",
-			LastName:  "Doe",
-			Age:       30,
-			Email:     "john@example.com",
-			Password:  "Pass123",
+			FirstName:       "John",
+			LastName:        "Doe",
+			Age:             30,
+			Email:           "john@example.com",
+			Password:        "Pass123",
+			EmailVerifiedAt: &verifiedAt,
 		},
 		{
-			FirstName: "Jane",
-			LastName:  "Smith",
-			Age:       25,
-			Email:     "jane@example.com",
-			Password:  "Pass123",
+			FirstName:       "Jane",
+			LastName:        "Smith",
+			Age:             25,
+			Email:           "jane@example.com",
+			Password:        "Pass123",
+			EmailVerifiedAt: &verifiedAt,
 		},
 	}
 
 	for _, user := range additionalUsers {
 		if err := createUserIfNotExists(&user); err != nil {
 			log.Printf("Error handling additional user: %v", err)
+			continue
+		}
+		if err := assignRole(&user, models.RoleUser); err != nil {
+			log.Printf("Error assigning user role: %v", err)
 		}
 	}
 
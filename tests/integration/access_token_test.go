@@ -0,0 +1,129 @@
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createAccessToken(t *testing.T, ts *testutil.TestServer, sessionToken string, body map[string]any) models.CreatedAccessTokenResponse {
+	resp := ts.SendRequest(t, "POST", "/api/v1/tokens", body, getAuthHeaders(sessionToken))
+	require.Equal(t, 201, resp.StatusCode)
+
+	var result models.CreatedAccessTokenResponse
+	require.NoError(t, resp.DecodeBody(&result))
+	require.True(t, strings.HasPrefix(result.Token, "pat_"))
+	return result
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.PersonalAccessToken{})
+	require.NoError(t, err)
+
+	session := createTestUser(t, ts)
+
+	t.Run("validation", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/tokens", map[string]any{
+			"name":   "CI",
+			"scopes": []string{"everything"},
+		}, getAuthHeaders(session))
+		assert.Equal(t, 400, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/tokens", map[string]any{
+			"name":       "CI",
+			"scopes":     []string{models.ScopePostsRead},
+			"expires_at": time.Now().Add(-time.Hour),
+		}, getAuthHeaders(session))
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	readOnly := createAccessToken(t, ts, session, map[string]any{
+		"name":   "Read only",
+		"scopes": []string{models.ScopePostsRead},
+	})
+	readWrite := createAccessToken(t, ts, session, map[string]any{
+		"name":       "CI",
+		"scopes":     []string{models.ScopePostsRead, models.ScopePostsWrite},
+		"expires_at": time.Now().Add(time.Hour),
+	})
+
+	t.Run("list hides the token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/tokens", nil, getAuthHeaders(session))
+		require.Equal(t, 200, resp.StatusCode)
+		assert.NotContains(t, string(resp.Body), readOnly.Token)
+
+		var result models.AccessTokensResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		require.Len(t, result.Items, 2)
+		for _, item := range result.Items {
+			assert.True(t, strings.HasPrefix(readOnly.Token, item.Prefix) || strings.HasPrefix(readWrite.Token, item.Prefix))
+			assert.Nil(t, item.LastUsedAt)
+		}
+	})
+
+	t.Run("scopes are enforced", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(readOnly.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, getAuthHeaders(readOnly.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, getAuthHeaders(readWrite.Token))
+		assert.Equal(t, 201, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(readWrite.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("tokens cannot manage the account", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/tokens", map[string]any{
+			"name":   "Escalate",
+			"scopes": []string{models.ScopeUserRead},
+		}, getAuthHeaders(readWrite.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "PATCH", "/api/v1/user/update_password", map[string]any{
+			"current_password": "Pass123",
+			"new_password":     "NewPass123",
+		}, getAuthHeaders(readWrite.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("last used is tracked", func(t *testing.T) {
+		var pat models.PersonalAccessToken
+		require.NoError(t, ts.DB.First(&pat, readOnly.ID).Error)
+		require.NotNil(t, pat.LastUsedAt)
+		assert.WithinDuration(t, time.Now(), *pat.LastUsedAt, time.Minute)
+	})
+
+	t.Run("expired tokens are rejected", func(t *testing.T) {
+		require.NoError(t, ts.DB.Model(&models.PersonalAccessToken{}).
+			Where("id = ?", readWrite.ID).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		resp := ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(readWrite.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/tokens/%d", readOnly.ID)
+		resp := ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(session))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(readOnly.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(session))
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+}
@@ -0,0 +1,232 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+	"go-auth-boilerplate/seeds"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createAdminUser signs up the standard test user, grants them the admin role
+// and returns tokens that carry it.
+func createAdminUser(t *testing.T, ts *testutil.TestServer) models.TokenResponse {
+	require.NoError(t, seeds.SeedRoles())
+	createTestUser(t, ts)
+
+	var user models.User
+	require.NoError(t, ts.DB.First(&user, "email = ?", "john@example.com").Error)
+	var admin models.Role
+	require.NoError(t, ts.DB.First(&admin, "name = ?", models.RoleAdmin).Error)
+	require.NoError(t, ts.DB.Model(&user).Association("Roles").Append(&admin))
+
+	return loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{})
+	require.NoError(t, err)
+
+	admin := getAuthHeaders(createAdminUser(t, ts).Token)
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+		"first_name": "Jane",
+		"last_name":  "Smith",
+		"age":        25,
+		"email":      "jane@example.com",
+		"password":   "Pass123",
+	}, nil)
+	require.Equal(t, 201, resp.StatusCode)
+	var jane models.TokenResponse
+	require.NoError(t, resp.DecodeBody(&jane))
+	createTestPost(t, ts, jane.Token)
+
+	var janeUser models.User
+	require.NoError(t, ts.DB.First(&janeUser, "email = ?", "jane@example.com").Error)
+	janePath := fmt.Sprintf("/api/v1/admin/users/%d", janeUser.ID)
+
+	t.Run("requires admin role", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/admin/users", nil, getAuthHeaders(jane.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("list and search users", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/admin/users?limit=1", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.AdminUsersResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Equal(t, 2, result.TotalItems)
+		assert.Len(t, result.Items, 1)
+		assert.True(t, result.HasNext)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/users?q=SMITH", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+		require.NoError(t, resp.DecodeBody(&result))
+		require.Len(t, result.Items, 1)
+		assert.Equal(t, "jane@example.com", result.Items[0].Email)
+		assert.Equal(t, []string{models.RoleUser}, result.Items[0].Roles)
+
+		// Wildcards in the search match literally
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/users?q=%25", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Zero(t, result.TotalItems)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/users?status=unknown", nil, admin)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("view user", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", janePath, nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.AdminUserDetailResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Equal(t, janeUser.ID, result.ID)
+		assert.Equal(t, int64(1), result.PostCount)
+		assert.Nil(t, result.SuspendedAt)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/users/999999", nil, admin)
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("suspend user", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", janePath+"/suspend", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(jane.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+			"email":    "jane@example.com",
+			"password": "Pass123",
+		}, nil)
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/users?status=suspended", nil, admin)
+		var result models.AdminUsersResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Equal(t, 1, result.TotalItems)
+	})
+
+	t.Run("suspension applies to existing sessions", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", janePath+"/unsuspend", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		tokens := loginTestUser(t, ts, "jane@example.com", "Pass123", nil)
+		require.NoError(t, ts.DB.Model(&janeUser).Update("suspended_at", janeUser.CreatedAt).Error)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		require.NoError(t, ts.DB.Model(&janeUser).Update("suspended_at", nil).Error)
+	})
+
+	t.Run("admins cannot suspend themselves", func(t *testing.T) {
+		var john models.User
+		require.NoError(t, ts.DB.First(&john, "email = ?", "john@example.com").Error)
+
+		resp := ts.SendRequest(t, "POST", fmt.Sprintf("/api/v1/admin/users/%d/suspend", john.ID), nil, admin)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("revoke sessions", func(t *testing.T) {
+		first := loginTestUser(t, ts, "jane@example.com", "Pass123", nil)
+		second := loginTestUser(t, ts, "jane@example.com", "Pass123", nil)
+
+		resp := ts.SendRequest(t, "POST", janePath+"/sessions/revoke_all", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		for _, tokens := range []models.TokenResponse{first, second} {
+			resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+			assert.Equal(t, 401, resp.StatusCode)
+		}
+	})
+
+	t.Run("force password reset", func(t *testing.T) {
+		tokens := loginTestUser(t, ts, "jane@example.com", "Pass123", nil)
+
+		resp := ts.SendRequest(t, "POST", janePath+"/password_reset", nil, admin)
+		require.Equal(t, 202, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+			"email":    "jane@example.com",
+			"password": "Pass123",
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resetToken := waitForEmail(t, ts, "jane@example.com", resetSubject, 1, "token")
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        resetToken,
+			"new_password": "NewPass123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		loginTestUser(t, ts, "jane@example.com", "NewPass123", nil)
+	})
+
+	t.Run("last admin cannot be deleted", func(t *testing.T) {
+		var manage models.Permission
+		require.NoError(t, ts.DB.First(&manage, "name = ?", models.PermissionUsersManage).Error)
+		support := models.Role{Name: "support", Permissions: []models.Permission{manage}}
+		require.NoError(t, ts.DB.Create(&support).Error)
+		require.NoError(t, ts.DB.Model(&janeUser).Association("Roles").Append(&support))
+		tokens := loginTestUser(t, ts, "jane@example.com", "NewPass123", nil)
+
+		var john models.User
+		require.NoError(t, ts.DB.First(&john, "email = ?", "john@example.com").Error)
+		resp := ts.SendRequest(t, "DELETE", fmt.Sprintf("/api/v1/admin/users/%d", john.ID), nil, getAuthHeaders(tokens.Token))
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+
+	t.Run("last admin cannot close their account", func(t *testing.T) {
+		resp := ts.SendRequest(t, "DELETE", "/api/v1/user", nil, admin)
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		resp := ts.SendRequest(t, "DELETE", janePath, nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+			"email":    "jane@example.com",
+			"password": "NewPass123",
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", janePath, nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+		var result models.AdminUserDetailResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.NotNil(t, result.DeletedAt)
+		assert.Equal(t, int64(1), result.PostCount)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/users?status=deleted", nil, admin)
+		var list models.AdminUsersResponse
+		require.NoError(t, resp.DecodeBody(&list))
+		assert.Equal(t, 1, list.TotalItems)
+	})
+
+	t.Run("hard delete", func(t *testing.T) {
+		resp := ts.SendRequest(t, "DELETE", janePath+"?hard=true", nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", janePath, nil, admin)
+		assert.Equal(t, 404, resp.StatusCode)
+
+		var posts int64
+		ts.DB.Model(&models.Post{}).Where("user_id = ?", janeUser.ID).Count(&posts)
+		assert.Zero(t, posts)
+	})
+}
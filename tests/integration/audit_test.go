@@ -0,0 +1,248 @@
+package integration
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getAuditEvents(t *testing.T, ts *testutil.TestServer, path, token string) models.AuditEventsResponse {
+	resp := ts.SendRequest(t, "GET", path, nil, getAuthHeaders(token))
+	require.Equal(t, 200, resp.StatusCode)
+
+	var events models.AuditEventsResponse
+	require.NoError(t, resp.DecodeBody(&events))
+	return events
+}
+
+func findAuditEvent(events []models.AuditEvent, action, outcome string) *models.AuditEvent {
+	for i := range events {
+		if events[i].Action == action && events[i].Outcome == outcome {
+			return &events[i]
+		}
+	}
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{}, &models.AuditEvent{})
+	require.NoError(t, err)
+	require.NoError(t, ts.DB.Exec("DELETE FROM audit_events").Error)
+
+	admin := createAdminUser(t, ts).Token
+	var john models.User
+	require.NoError(t, ts.DB.First(&john, "email = ?", "john@example.com").Error)
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+		"email":    "john@example.com",
+		"password": "wrong",
+	}, map[string]string{"X-Request-ID": "req-failed-login", "User-Agent": "curl/8.0"})
+	require.Equal(t, 401, resp.StatusCode)
+	assert.Equal(t, "req-failed-login", resp.Header.Get("X-Request-ID"))
+
+	resp = ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+		"email":    "nobody@example.com",
+		"password": "Pass123",
+	}, nil)
+	require.Equal(t, 401, resp.StatusCode)
+
+	session := loginTestUser(t, ts, "john@example.com", "Pass123", nil).Token
+	postId := createTestPost(t, ts, session)
+	resp = ts.SendRequest(t, "DELETE", "/api/v1/posts/"+strconv.Itoa(int(postId))+"/delete", nil, getAuthHeaders(session))
+	require.Equal(t, 200, resp.StatusCode)
+
+	resp = ts.SendRequest(t, "PATCH", "/api/v1/user/update_password", map[string]any{
+		"current_password": "wrong",
+		"new_password":     "NewPass123",
+	}, getAuthHeaders(session))
+	require.Equal(t, 401, resp.StatusCode)
+
+	t.Run("user activity", func(t *testing.T) {
+		events := getAuditEvents(t, ts, "/api/v1/user/activity", session).Items
+
+		for i := 1; i < len(events); i++ {
+			assert.Greater(t, events[i-1].ID, events[i].ID, "newest first")
+		}
+		for _, event := range events {
+			assert.NotEqual(t, "nobody@example.com", event.Email)
+		}
+
+		assert.NotNil(t, findAuditEvent(events, models.AuditSignUp, models.AuditSuccess))
+		assert.NotNil(t, findAuditEvent(events, models.AuditPostCreate, models.AuditSuccess))
+		assert.NotNil(t, findAuditEvent(events, models.AuditPostDelete, models.AuditSuccess))
+
+		login := findAuditEvent(events, models.AuditLogin, models.AuditSuccess)
+		require.NotNil(t, login)
+		require.NotNil(t, login.ActorID)
+		assert.Equal(t, john.ID, *login.ActorID)
+		assert.NotEmpty(t, login.RequestID)
+
+		failed := findAuditEvent(events, models.AuditLogin, models.AuditFailure)
+		require.NotNil(t, failed)
+		assert.Equal(t, "invalid_credentials", failed.Reason)
+		assert.Nil(t, failed.ActorID)
+		assert.Equal(t, models.AuditTargetUser, failed.TargetType)
+		assert.Equal(t, "req-failed-login", failed.RequestID)
+		assert.Equal(t, "curl/8.0", failed.UserAgent)
+
+		password := findAuditEvent(events, models.AuditPasswordChange, models.AuditFailure)
+		require.NotNil(t, password)
+		assert.Equal(t, "invalid_current_password", password.Reason)
+	})
+
+	t.Run("cursor pagination", func(t *testing.T) {
+		all := getAuditEvents(t, ts, "/api/v1/user/activity", session).Items
+
+		var paged []models.AuditEvent
+		path := "/api/v1/user/activity?limit=2"
+		for {
+			page := getAuditEvents(t, ts, path, session)
+			assert.LessOrEqual(t, len(page.Items), 2)
+			paged = append(paged, page.Items...)
+			if page.NextCursor == "" {
+				break
+			}
+			path = "/api/v1/user/activity?limit=2&cursor=" + page.NextCursor
+		}
+		assert.Equal(t, all, paged)
+
+		resp := ts.SendRequest(t, "GET", "/api/v1/user/activity?cursor=abc", nil, getAuthHeaders(session))
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("admin query", func(t *testing.T) {
+		events := getAuditEvents(t, ts, "/api/v1/admin/audit_events?action=user.login&outcome=failure", admin).Items
+		require.Len(t, events, 2)
+		assert.Equal(t, "nobody@example.com", events[0].Email)
+		assert.Nil(t, events[0].TargetID)
+
+		events = getAuditEvents(t, ts, "/api/v1/admin/audit_events?email=NOBODY@example.com", admin).Items
+		assert.Len(t, events, 1)
+
+		events = getAuditEvents(t, ts, "/api/v1/admin/audit_events?request_id=req-failed-login", admin).Items
+		assert.Len(t, events, 1)
+
+		events = getAuditEvents(t, ts, "/api/v1/admin/audit_events?target_type=post&target_id="+strconv.Itoa(int(postId)), admin).Items
+		assert.Len(t, events, 2)
+
+		for _, query := range []string{"outcome=maybe", "since=yesterday", "actor_id=me"} {
+			resp := ts.SendRequest(t, "GET", "/api/v1/admin/audit_events?"+query, nil, getAuthHeaders(admin))
+			assert.Equal(t, 400, resp.StatusCode, query)
+		}
+	})
+
+	t.Run("admin query requires permission", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+			"first_name": "Jane",
+			"last_name":  "Smith",
+			"age":        25,
+			"email":      "jane@example.com",
+			"password":   "Pass123",
+		}, nil)
+		require.Equal(t, 201, resp.StatusCode)
+		jane := loginTestUser(t, ts, "jane@example.com", "Pass123", nil).Token
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/audit_events", nil, getAuthHeaders(jane))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("passwordless logins, resets and admin deletions", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+			"first_name": "Bob",
+			"last_name":  "Smith",
+			"age":        40,
+			"email":      "bob@example.com",
+			"password":   "Pass123",
+		}, nil)
+		require.Equal(t, 201, resp.StatusCode)
+		var bob models.User
+		require.NoError(t, ts.DB.First(&bob, "email = ?", "bob@example.com").Error)
+
+		cookie := requestMagicLink(t, ts, "bob@example.com")
+		token := waitForEmail(t, ts, "bob@example.com", magicLinkSubject, 1, "token")
+		resp = ts.SendRequest(t, "GET", "/api/v1/user/login/magic/verify?token="+token, nil, map[string]string{"Cookie": cookie})
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", fmt.Sprintf("/api/v1/admin/users/%d/password_reset", bob.ID), nil, getAuthHeaders(admin))
+		require.Equal(t, 202, resp.StatusCode)
+		token = waitForEmail(t, ts, "bob@example.com", resetSubject, 1, "token")
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        token,
+			"new_password": "NewPass123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "DELETE", fmt.Sprintf("/api/v1/admin/users/%d", bob.ID), nil, getAuthHeaders(admin))
+		require.Equal(t, 200, resp.StatusCode)
+
+		events := getAuditEvents(t, ts, "/api/v1/admin/audit_events?target_type=user&target_id="+strconv.Itoa(int(bob.ID)), admin).Items
+		require.NotNil(t, findAuditEvent(events, models.AuditLogin, models.AuditSuccess))
+		reset := findAuditEvent(events, models.AuditPasswordReset, models.AuditSuccess)
+		require.NotNil(t, reset)
+		require.NotNil(t, reset.ActorID)
+		assert.Equal(t, bob.ID, *reset.ActorID)
+
+		for _, action := range []string{models.AuditPasswordForceReset, models.AuditUserDelete} {
+			event := findAuditEvent(events, action, models.AuditSuccess)
+			require.NotNil(t, event, action)
+			require.NotNil(t, event.ActorID)
+			assert.Equal(t, john.ID, *event.ActorID)
+		}
+	})
+
+	t.Run("events outlive the account", func(t *testing.T) {
+		jane := loginTestUser(t, ts, "jane@example.com", "Pass123", nil).Token
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "email = ?", "jane@example.com").Error)
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/logout", nil, getAuthHeaders(jane))
+		require.Equal(t, 200, resp.StatusCode)
+
+		jane = loginTestUser(t, ts, "jane@example.com", "Pass123", nil).Token
+		resp = ts.SendRequest(t, "DELETE", "/api/v1/user", nil, getAuthHeaders(jane))
+		require.Equal(t, 200, resp.StatusCode)
+
+		events := getAuditEvents(t, ts, "/api/v1/admin/audit_events?user_id="+strconv.Itoa(int(user.ID)), admin).Items
+		require.NotEmpty(t, events)
+		assert.Equal(t, models.AuditUserDelete, events[0].Action)
+		assert.NotNil(t, findAuditEvent(events, models.AuditLogout, models.AuditSuccess))
+	})
+}
+
+func TestAuditLogoutWithExpiredToken(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.JWT.AccessTokenExpiry = time.Second
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{}, &models.AuditEvent{})
+	require.NoError(t, err)
+	require.NoError(t, ts.DB.Exec("DELETE FROM audit_events").Error)
+
+	john := createAdminUser(t, ts).Token
+	var user models.User
+	require.NoError(t, ts.DB.First(&user, "email = ?", "john@example.com").Error)
+
+	// Claims are checked to the second
+	time.Sleep(2100 * time.Millisecond)
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/logout", nil, getAuthHeaders(john))
+	require.Equal(t, 200, resp.StatusCode)
+
+	admin := loginTestUser(t, ts, "john@example.com", "Pass123", nil).Token
+	events := getAuditEvents(t, ts, "/api/v1/admin/audit_events?action=user.logout&user_id="+strconv.Itoa(int(user.ID)), admin).Items
+	require.Len(t, events, 1)
+	require.NotNil(t, events[0].ActorID)
+	assert.Equal(t, user.ID, *events[0].ActorID)
+}
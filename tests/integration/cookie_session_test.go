@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"net/http"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func responseCookies(resp *testutil.TestResponse) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestCookieSessions(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Cookie.Enabled = true
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{})
+	require.NoError(t, err)
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+		"first_name": "John",
+		"last_name":  "Doe",
+		"age":        30,
+		"email":      "john@example.com",
+		"password":   "Pass123",
+	}, nil)
+	require.Equal(t, 201, resp.StatusCode)
+
+	var session models.CookieSessionResponse
+	require.NoError(t, resp.DecodeBody(&session))
+	require.NotEmpty(t, session.CSRFToken)
+	assert.NotContains(t, string(resp.Body), "refresh_token")
+
+	cookies := responseCookies(resp)
+	require.Contains(t, cookies, "session")
+	require.Contains(t, cookies, "refresh_token")
+	require.Contains(t, cookies, "csrf_token")
+	assert.True(t, cookies["session"].HttpOnly)
+	assert.True(t, cookies["session"].Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookies["session"].SameSite)
+	assert.True(t, cookies["refresh_token"].HttpOnly)
+	assert.False(t, cookies["csrf_token"].HttpOnly)
+	assert.Equal(t, session.CSRFToken, cookies["csrf_token"].Value)
+
+	sessionCookie := map[string]string{"Cookie": "session=" + cookies["session"].Value}
+
+	t.Run("cookie authenticates safe requests", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/session", nil, sessionCookie)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("state-changing requests need the CSRF token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, sessionCookie)
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, map[string]string{
+			"Cookie":       sessionCookie["Cookie"],
+			"X-CSRF-Token": "wrong",
+		})
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, map[string]string{
+			"Cookie":       sessionCookie["Cookie"],
+			"X-CSRF-Token": session.CSRFToken,
+		})
+		assert.Equal(t, 201, resp.StatusCode)
+	})
+
+	t.Run("bearer tokens don't need a CSRF token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, getAuthHeaders(cookies["session"].Value))
+		assert.Equal(t, 201, resp.StatusCode)
+	})
+
+	t.Run("refresh from the cookie needs the CSRF token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", nil, map[string]string{
+			"Cookie": "refresh_token=" + cookies["refresh_token"].Value,
+		})
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/token/refresh", nil, map[string]string{
+			"Cookie":       "refresh_token=" + cookies["refresh_token"].Value,
+			"X-CSRF-Token": "wrong",
+		})
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("refresh from the cookie keeps the CSRF token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", nil, map[string]string{
+			"Cookie":       "refresh_token=" + cookies["refresh_token"].Value,
+			"X-CSRF-Token": session.CSRFToken,
+		})
+		require.Equal(t, 200, resp.StatusCode)
+
+		var refreshed models.CookieSessionResponse
+		require.NoError(t, resp.DecodeBody(&refreshed))
+		assert.Equal(t, session.CSRFToken, refreshed.CSRFToken)
+
+		renewed := responseCookies(resp)
+		assert.NotEqual(t, cookies["refresh_token"].Value, renewed["refresh_token"].Value)
+		cookies = renewed
+		sessionCookie = map[string]string{"Cookie": "session=" + cookies["session"].Value}
+	})
+
+	t.Run("logout revokes the session and clears the cookies", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/logout", nil, sessionCookie)
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Empty(t, responseCookies(resp)["session"].Value)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, sessionCookie)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+}
+
+func TestCookieSessionsDisabled(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+
+	resp := ts.SendRequest(t, "GET", "/api/v1/session", nil, map[string]string{"Cookie": "session=" + token})
+	assert.Equal(t, 401, resp.StatusCode)
+}
@@ -0,0 +1,207 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startFederatedLogin starts a login (or, with a session token, a link) at
+// the mock provider and returns the authorization URL and the state cookie
+// header the browser would send back.
+func startFederatedLogin(t *testing.T, ts *testutil.TestServer, path, sessionToken string) (string, string) {
+	var headers map[string]string
+	if sessionToken != "" {
+		headers = getAuthHeaders(sessionToken)
+	}
+	resp := ts.SendRequest(t, "POST", path, nil, headers)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var result models.FederatedLoginResponse
+	require.NoError(t, resp.DecodeBody(&result))
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "federated_login_state" {
+			assert.True(t, cookie.HttpOnly)
+			return result.AuthorizationURL, cookie.Name + "=" + cookie.Value
+		}
+	}
+	t.Fatal("federated login state cookie not set")
+	return "", ""
+}
+
+func TestFederatedLogin(t *testing.T) {
+	idp := testutil.NewMockOIDCProvider(t)
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Providers = []config.IdentityProviderConfig{idp.Config("mock")}
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Identity{})
+	require.NoError(t, err)
+
+	johnToken := createTestUser(t, ts)
+
+	const loginPath = "/api/v1/user/login/providers/mock"
+	const callbackPath = loginPath + "/callback"
+
+	// loginAs goes through the provider as the given account and returns the
+	// callback response
+	loginAs := func(t *testing.T, startPath, sessionToken string, claims map[string]any) *testutil.TestResponse {
+		authorizationURL, cookie := startFederatedLogin(t, ts, startPath, sessionToken)
+		code, state := idp.Login(t, authorizationURL, claims)
+		return ts.SendRequest(t, "POST", callbackPath, map[string]any{
+			"code":  code,
+			"state": state,
+		}, map[string]string{"Cookie": cookie})
+	}
+
+	jane := map[string]any{
+		"sub":            "jane-1",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Roe",
+	}
+	var janeToken string
+
+	t.Run("providers are listed", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/user/login/providers", nil, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.IdentityProvidersResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Equal(t, []models.IdentityProviderResponse{{Name: "mock", DisplayName: "Mock mock"}}, result.Items)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/providers/unknown", nil, nil)
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("new account signs up", func(t *testing.T) {
+		resp := loginAs(t, loginPath, "", jane)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var signup models.FederatedSignupRequiredResponse
+		require.NoError(t, resp.DecodeBody(&signup))
+		assert.True(t, signup.SignupRequired)
+		assert.Equal(t, "jane@example.com", signup.Email)
+		assert.Equal(t, "Jane", signup.FirstName)
+		assert.Equal(t, "Roe", signup.LastName)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/signup/federated", map[string]any{
+			"signup_token": signup.SignupToken,
+			"first_name":   "Jane",
+			"last_name":    "Roe",
+			"age":          30,
+		}, nil)
+		require.Equal(t, 201, resp.StatusCode)
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "email = ?", "jane@example.com").Error)
+		assert.NotNil(t, user.EmailVerifiedAt)
+		assert.False(t, user.HasPassword())
+
+		// The token is single use
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/signup/federated", map[string]any{
+			"signup_token": signup.SignupToken,
+			"first_name":   "Jane",
+			"last_name":    "Roe",
+			"age":          30,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("linked account logs in", func(t *testing.T) {
+		resp := loginAs(t, loginPath, "", jane)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		require.NotEmpty(t, tokens.Token)
+		janeToken = tokens.Token
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(janeToken))
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, string(resp.Body), "jane@example.com")
+	})
+
+	t.Run("state is bound to the browser and single use", func(t *testing.T) {
+		authorizationURL, cookie := startFederatedLogin(t, ts, loginPath, "")
+		code, state := idp.Login(t, authorizationURL, jane)
+		body := map[string]any{"code": code, "state": state}
+
+		resp := ts.SendRequest(t, "POST", callbackPath, body, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", callbackPath, body, map[string]string{"Cookie": cookie})
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", callbackPath, body, map[string]string{"Cookie": cookie})
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("ID token must carry the login nonce", func(t *testing.T) {
+		resp := loginAs(t, loginPath, "", map[string]any{"sub": "jane-1", "nonce": "replayed"})
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("existing email is not linked automatically", func(t *testing.T) {
+		resp := loginAs(t, loginPath, "", map[string]any{
+			"sub":            "john-1",
+			"email":          "john@example.com",
+			"email_verified": true,
+		})
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+
+	t.Run("signed-in user links and unlinks an account", func(t *testing.T) {
+		resp := loginAs(t, "/api/v1/user/identities/mock", johnToken, map[string]any{"sub": "jane-1"})
+		assert.Equal(t, 409, resp.StatusCode)
+
+		resp = loginAs(t, "/api/v1/user/identities/mock", johnToken, map[string]any{
+			"sub":   "john-1",
+			"email": "john@example.com",
+		})
+		require.Equal(t, 201, resp.StatusCode)
+
+		var identity models.IdentityResponse
+		require.NoError(t, resp.DecodeBody(&identity))
+		assert.Equal(t, "mock", identity.Provider)
+
+		resp = loginAs(t, loginPath, "", map[string]any{"sub": "john-1"})
+		require.Equal(t, 200, resp.StatusCode)
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		assert.Contains(t, string(resp.Body), "john@example.com")
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/user/identities", nil, getAuthHeaders(johnToken))
+		require.Equal(t, 200, resp.StatusCode)
+		var identities models.IdentitiesResponse
+		require.NoError(t, resp.DecodeBody(&identities))
+		require.Len(t, identities.Items, 1)
+
+		resp = ts.SendRequest(t, "DELETE", fmt.Sprintf("/api/v1/user/identities/%d", identity.ID), nil, getAuthHeaders(johnToken))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = loginAs(t, loginPath, "", map[string]any{"sub": "john-1", "email": "john@example.com"})
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+
+	t.Run("passwordless user keeps their last identity", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/user/identities", nil, getAuthHeaders(janeToken))
+		require.Equal(t, 200, resp.StatusCode)
+		var identities models.IdentitiesResponse
+		require.NoError(t, resp.DecodeBody(&identities))
+		require.Len(t, identities.Items, 1)
+
+		resp = ts.SendRequest(t, "DELETE", fmt.Sprintf("/api/v1/user/identities/%d", identities.Items[0].ID), nil, getAuthHeaders(janeToken))
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+}
@@ -0,0 +1,114 @@
+package integration
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSigningKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	keysDir := t.TempDir()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeSigningKey(t, keysDir, "ed-1", edKey)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writeSigningKey(t, keysDir, "ec-2", ecKey)
+
+	useKey := func(kid string) func(cfg *config.Config) {
+		return func(cfg *config.Config) {
+			cfg.JWT.KeysDir = keysDir
+			cfg.JWT.SigningKeyID = kid
+		}
+	}
+
+	ts := testutil.NewTestServerWithConfig(t, useKey("ed-1"))
+	defer ts.Close(t)
+
+	err = ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+
+	t.Run("tokens carry the signing key ID", func(t *testing.T) {
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "ed-1", parsed.Header["kid"])
+		assert.Equal(t, "EdDSA", parsed.Header["alg"])
+	})
+
+	t.Run("jwks publishes all verification keys", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/.well-known/jwks.json", nil, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var set auth.JWKSet
+		require.NoError(t, resp.DecodeBody(&set))
+		require.Len(t, set.Keys, 2)
+
+		var edJWK auth.JWK
+		for _, key := range set.Keys {
+			if key.Kid == "ed-1" {
+				edJWK = key
+			}
+		}
+		assert.Equal(t, "OKP", edJWK.Kty)
+		assert.Equal(t, "Ed25519", edJWK.Crv)
+
+		x, err := base64.RawURLEncoding.DecodeString(edJWK.X)
+		require.NoError(t, err)
+
+		parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+			return ed25519.PublicKey(x), nil
+		})
+		require.NoError(t, err)
+		assert.True(t, parsed.Valid)
+	})
+
+	t.Run("rotating the signing key keeps existing tokens valid", func(t *testing.T) {
+		rotated := testutil.NewTestServerWithConfig(t, useKey("ec-2"))
+
+		resp := rotated.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		tokens := loginTestUser(t, rotated, "john@example.com", "Pass123", nil)
+		parsed, _, err := jwt.NewParser().ParseUnverified(tokens.Token, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "ec-2", parsed.Header["kid"])
+		assert.Equal(t, "ES256", parsed.Header["alg"])
+	})
+
+	t.Run("retired keys are no longer accepted", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(keysDir, "ed-1.pem")))
+		retired := testutil.NewTestServerWithConfig(t, useKey("ec-2"))
+
+		resp := retired.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(token))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+}
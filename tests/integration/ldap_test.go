@@ -0,0 +1,150 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+	"go-auth-boilerplate/internal/totp"
+	"go-auth-boilerplate/seeds"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLDAPLogin(t *testing.T) {
+	const adminsGroup = "cn=admins,ou=groups,dc=example,dc=com"
+
+	directory := testutil.NewMockLDAPServer(t)
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Auth.Backends = []string{"database", "ldap"}
+		cfg.LDAP = directory.Config()
+		cfg.LDAP.GroupRoles = map[string]string{adminsGroup: models.RoleAdmin}
+		cfg.Password.MaxAge = 24 * time.Hour
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Identity{})
+	require.NoError(t, err)
+	require.NoError(t, seeds.SeedRoles())
+
+	alice := testutil.LDAPEntry{
+		DN:       "uid=alice,ou=people,dc=example,dc=com",
+		Password: "directory-secret",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"entryUUID":   {"5b0f3a4e-1c2d-4e5f-8a9b-0c1d2e3f4a5b"},
+			"mail":        {"alice@example.com"},
+			"givenName":   {"Alice"},
+			"sn":          {"Smith"},
+			"memberOf":    {adminsGroup},
+		},
+	}
+	directory.AddEntry(alice)
+
+	login := func(email, password string) int {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+			"email":    email,
+			"password": password,
+		}, nil)
+		return resp.StatusCode
+	}
+
+	userRoles := func(t *testing.T, user *models.User) []string {
+		var roles []models.Role
+		require.NoError(t, ts.DB.Model(user).Association("Roles").Find(&roles))
+		names := []string{}
+		for _, role := range roles {
+			names = append(names, role.Name)
+		}
+		return names
+	}
+
+	var provisioned models.User
+
+	t.Run("first login provisions the user", func(t *testing.T) {
+		loginTestUser(t, ts, "alice@example.com", "directory-secret", nil)
+
+		require.NoError(t, ts.DB.First(&provisioned, "email = ?", "alice@example.com").Error)
+		assert.Equal(t, "Alice", provisioned.FirstName)
+		assert.Equal(t, "Smith", provisioned.LastName)
+		assert.NotNil(t, provisioned.EmailVerifiedAt)
+		assert.False(t, provisioned.HasPassword())
+		assert.ElementsMatch(t, []string{models.RoleUser, models.RoleAdmin}, userRoles(t, &provisioned))
+
+		var identity models.Identity
+		require.NoError(t, ts.DB.First(&identity, "user_id = ?", provisioned.ID).Error)
+		assert.Equal(t, "ldap", identity.Provider)
+		assert.Equal(t, "5b0f3a4e-1c2d-4e5f-8a9b-0c1d2e3f4a5b", identity.Subject)
+	})
+
+	t.Run("wrong password is rejected", func(t *testing.T) {
+		assert.Equal(t, 401, login("alice@example.com", "wrong"))
+		assert.Equal(t, 400, login("alice@example.com", ""))
+		assert.Equal(t, 401, login("nobody@example.com", "directory-secret"))
+	})
+
+	t.Run("local users still log in", func(t *testing.T) {
+		createTestUser(t, ts)
+		loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+	})
+
+	t.Run("later logins reuse the user and sync the directory", func(t *testing.T) {
+		alice.Attributes["sn"] = []string{"Jones"}
+		alice.Attributes["memberOf"] = nil
+		directory.AddEntry(alice)
+
+		loginTestUser(t, ts, "alice@example.com", "directory-secret", nil)
+
+		var count int64
+		ts.DB.Model(&models.User{}).Where("email = ?", "alice@example.com").Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, provisioned.ID).Error)
+		assert.Equal(t, "Jones", user.LastName)
+		assert.Equal(t, []string{models.RoleUser}, userRoles(t, &user))
+	})
+
+	t.Run("directory passwords don't expire locally with two-factor authentication", func(t *testing.T) {
+		secret, err := totp.GenerateSecret()
+		require.NoError(t, err)
+		require.NoError(t, ts.DB.Model(&models.User{}).Where("id = ?", provisioned.ID).UpdateColumns(map[string]any{
+			"totp_secret":     secret,
+			"totp_enabled_at": time.Now(),
+			"created_at":      time.Now().Add(-48 * time.Hour),
+		}).Error)
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+			"email":    "alice@example.com",
+			"password": "directory-secret",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		var challenge models.MFAChallengeResponse
+		require.NoError(t, resp.DecodeBody(&challenge))
+		require.True(t, challenge.MFARequired)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]any{
+			"mfa_token": challenge.MFAToken,
+			"code":      totpCode(t, secret, time.Now()),
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("existing local account is not taken over", func(t *testing.T) {
+		directory.AddEntry(testutil.LDAPEntry{
+			DN:       "uid=john,ou=people,dc=example,dc=com",
+			Password: "directory-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"entryUUID":   {"9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"},
+				"mail":        {"john@example.com"},
+			},
+		})
+
+		assert.Equal(t, 401, login("john@example.com", "directory-secret"))
+		loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+	})
+}
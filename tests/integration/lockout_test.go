@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signUpLockoutUser(t *testing.T, ts *testutil.TestServer, email string) {
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+		"first_name": "Lock",
+		"last_name":  "Out",
+		"age":        30,
+		"email":      email,
+		"password":   "Pass123",
+	}, nil)
+	require.Equal(t, 201, resp.StatusCode)
+}
+
+func attemptLogin(t *testing.T, ts *testutil.TestServer, email, password string) *testutil.TestResponse {
+	return ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+		"email":    email,
+		"password": password,
+	}, nil)
+}
+
+func TestLoginLockout(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Lockout.MaxAttempts = 3
+		cfg.Lockout.DelayAfter = 0
+		cfg.Lockout.Duration = time.Minute
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	const email = "lockout@example.com"
+	signUpLockoutUser(t, ts, email)
+
+	t.Run("successful login resets the count", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+		}
+		loginTestUser(t, ts, email, "Pass123", nil)
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+		}
+		loginTestUser(t, ts, email, "Pass123", nil)
+	})
+
+	t.Run("locks after too many failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+		}
+
+		resp := attemptLogin(t, ts, email, "Pass123")
+		assert.Equal(t, 423, resp.StatusCode)
+		assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("unknown emails are throttled the same way", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, 401, attemptLogin(t, ts, "nobody@example.com", "wrong").StatusCode)
+		}
+		assert.Equal(t, 423, attemptLogin(t, ts, "nobody@example.com", "wrong").StatusCode)
+	})
+
+	t.Run("admin unlock", func(t *testing.T) {
+		admin := getAuthHeaders(createAdminUser(t, ts).Token)
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "email = ?", email).Error)
+		path := fmt.Sprintf("/api/v1/admin/users/%d", user.ID)
+
+		resp := ts.SendRequest(t, "GET", path, nil, admin)
+		require.Equal(t, 200, resp.StatusCode)
+		var result models.AdminUserDetailResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.NotNil(t, result.LoginLockedUntil)
+
+		resp = ts.SendRequest(t, "POST", path+"/unlock", nil, admin)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		loginTestUser(t, ts, email, "Pass123", nil)
+	})
+
+	t.Run("password reset unlocks", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			attemptLogin(t, ts, email, "wrong")
+		}
+		require.Equal(t, 423, attemptLogin(t, ts, email, "Pass123").StatusCode)
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/forgot", map[string]any{
+			"email": email,
+		}, nil)
+		require.Equal(t, 202, resp.StatusCode)
+
+		resetToken := waitForEmail(t, ts, email, resetSubject, 1, "token")
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        resetToken,
+			"new_password": "NewPass123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		loginTestUser(t, ts, email, "NewPass123", nil)
+	})
+}
+
+func TestLoginProgressiveDelay(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Lockout.MaxAttempts = 10
+		cfg.Lockout.DelayAfter = 2
+		cfg.Lockout.BaseDelay = time.Second
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	const email = "delay@example.com"
+	signUpLockoutUser(t, ts, email)
+
+	assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+	assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+
+	resp := attemptLogin(t, ts, email, "Pass123")
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+
+	resp = attemptLogin(t, ts, email, "Pass123")
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+
+	time.Sleep(2100 * time.Millisecond)
+	loginTestUser(t, ts, email, "Pass123", nil)
+}
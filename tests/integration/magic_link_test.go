@@ -0,0 +1,139 @@
+package integration
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const magicLinkSubject = "Your login link"
+
+// requestMagicLink asks for a login link and returns the nonce cookie header
+// the browser would send back.
+func requestMagicLink(t *testing.T, ts *testutil.TestServer, email string) string {
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/login/magic", map[string]any{
+		"email": email,
+	}, nil)
+	require.Equal(t, 202, resp.StatusCode)
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "magic_link_nonce" {
+			assert.True(t, cookie.HttpOnly)
+			return cookie.Name + "=" + cookie.Value
+		}
+	}
+	t.Fatal("magic link nonce cookie not set")
+	return ""
+}
+
+func TestMagicLink(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.RateLimit.MagicLink = config.Rate{Limit: 4, Window: time.Minute}
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	createTestUser(t, ts)
+	const email = "john@example.com"
+
+	t.Run("unknown email gets the same response", func(t *testing.T) {
+		requestMagicLink(t, ts, "nobody@example.com")
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Empty(t, ts.Outbox.Messages("nobody@example.com"))
+	})
+
+	t.Run("link logs in from the requesting browser only", func(t *testing.T) {
+		cookie := requestMagicLink(t, ts, email)
+		token := waitForEmail(t, ts, email, magicLinkSubject, 1, "token")
+		path := "/api/v1/user/login/magic/verify?token=" + token
+
+		resp := ts.SendRequest(t, "GET", path, nil, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", path, nil, map[string]string{"Cookie": "magic_link_nonce=other"})
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", path, nil, map[string]string{"Cookie": cookie})
+		require.Equal(t, 200, resp.StatusCode)
+
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var user models.UserResponse
+		require.NoError(t, resp.DecodeBody(&user))
+		assert.NotNil(t, user.EmailVerifiedAt)
+
+		// Links are single-use
+		resp = ts.SendRequest(t, "GET", path, nil, map[string]string{"Cookie": cookie})
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("link can be posted", func(t *testing.T) {
+		cookie := requestMagicLink(t, ts, email)
+		token := waitForEmail(t, ts, email, magicLinkSubject, 2, "token")
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login/magic/verify", map[string]any{
+			"token": token,
+		}, map[string]string{"Cookie": cookie})
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		short := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+			cfg.Auth.MagicLinkExpiry = time.Second
+		})
+
+		cookie := requestMagicLink(t, short, email)
+		token := waitForEmail(t, short, email, magicLinkSubject, 1, "token")
+		time.Sleep(1100 * time.Millisecond)
+
+		resp := short.SendRequest(t, "GET", "/api/v1/user/login/magic/verify?token="+token, nil, map[string]string{"Cookie": cookie})
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("requests are rate limited", func(t *testing.T) {
+		limited := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+			cfg.RateLimit.MagicLink = config.Rate{Limit: 1, Window: time.Minute}
+		})
+
+		requestMagicLink(t, limited, email)
+		resp := limited.SendRequest(t, "POST", "/api/v1/user/login/magic", map[string]any{
+			"email": email,
+		}, nil)
+		assert.Equal(t, 429, resp.StatusCode)
+	})
+	t.Run("nonce cookie follows the cookie settings", func(t *testing.T) {
+		secure := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+			cfg.Cookie.Secure = true
+			cfg.Cookie.SameSite = "Strict"
+		})
+
+		resp := secure.SendRequest(t, "POST", "/api/v1/user/login/magic", map[string]any{
+			"email": email,
+		}, nil)
+		require.Equal(t, 202, resp.StatusCode)
+
+		var nonce *http.Cookie
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == "magic_link_nonce" {
+				nonce = cookie
+			}
+		}
+		require.NotNil(t, nonce)
+		assert.True(t, nonce.Secure)
+		// Strict would keep the cookie from coming back from the email link
+		assert.Equal(t, http.SameSiteLaxMode, nonce.SameSite)
+	})
+}
@@ -0,0 +1,288 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+	"go-auth-boilerplate/internal/totp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, at)
+	require.NoError(t, err)
+	return code
+}
+
+func loginWithMFAChallenge(t *testing.T, ts *testutil.TestServer) string {
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]interface{}{
+		"email":    "john@example.com",
+		"password": "Pass123",
+	}, nil)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var challenge models.MFAChallengeResponse
+	require.NoError(t, resp.DecodeBody(&challenge))
+	require.True(t, challenge.MFARequired)
+	require.NotEmpty(t, challenge.MFAToken)
+	return challenge.MFAToken
+}
+
+func TestTOTPTwoFactor(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.RecoveryCode{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+	headers := getAuthHeaders(token)
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("confirm without enrollment", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/confirm", map[string]interface{}{
+			"code": "123456",
+		}, headers)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("enroll", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/enroll", nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.TOTPEnrollmentResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		require.NotEmpty(t, result.Secret)
+		assert.Contains(t, result.ProvisioningURI, "otpauth://totp/")
+		assert.Contains(t, result.ProvisioningURI, "secret="+result.Secret)
+		secret = result.Secret
+	})
+
+	t.Run("confirm with wrong code", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/confirm", map[string]interface{}{
+			"code": totpCode(t, secret, time.Now().Add(-10*totp.Period)),
+		}, headers)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/confirm", map[string]interface{}{
+			"code": totpCode(t, secret, time.Now()),
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.RecoveryCodesResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		require.Len(t, result.RecoveryCodes, 10)
+		recoveryCodes = result.RecoveryCodes
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, headers)
+		var user models.UserResponse
+		require.NoError(t, resp.DecodeBody(&user))
+		assert.True(t, user.MFAEnabled)
+	})
+
+	t.Run("login requires second factor", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]interface{}{
+			"email":    "john@example.com",
+			"password": "Pass123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		assert.Empty(t, tokens.Token)
+		assert.Empty(t, tokens.RefreshToken)
+	})
+
+	t.Run("login with code", func(t *testing.T) {
+		mfaToken := loginWithMFAChallenge(t, ts)
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+			"mfa_token": mfaToken,
+			"code":      "000000",
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		// The code used to confirm enrollment cannot be replayed, so use the next step
+		code := totpCode(t, secret, time.Now().Add(totp.Period))
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+			"mfa_token": mfaToken,
+			"code":      code,
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		assert.NotEmpty(t, tokens.Token)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		t.Run("challenge is single use", func(t *testing.T) {
+			resp := ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+				"mfa_token": mfaToken,
+				"code":      code,
+			}, nil)
+			assert.Equal(t, 401, resp.StatusCode)
+		})
+
+		t.Run("code cannot be replayed", func(t *testing.T) {
+			resp := ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+				"mfa_token": loginWithMFAChallenge(t, ts),
+				"code":      code,
+			}, nil)
+			assert.Equal(t, 401, resp.StatusCode)
+		})
+	})
+
+	t.Run("challenge locks after too many attempts", func(t *testing.T) {
+		mfaToken := loginWithMFAChallenge(t, ts)
+		for i := 0; i < 5; i++ {
+			resp := ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+				"mfa_token": mfaToken,
+				"code":      "000000",
+			}, nil)
+			assert.Equal(t, 401, resp.StatusCode)
+		}
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+			"mfa_token":     mfaToken,
+			"recovery_code": recoveryCodes[0],
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("login with recovery code", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+			"mfa_token":     loginWithMFAChallenge(t, ts),
+			"recovery_code": recoveryCodes[0],
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+			"mfa_token":     loginWithMFAChallenge(t, ts),
+			"recovery_code": recoveryCodes[0],
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("regenerate recovery codes", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/recovery_codes", map[string]interface{}{
+			"password": "wrong",
+		}, headers)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/recovery_codes", map[string]interface{}{
+			"password": "Pass123",
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.RecoveryCodesResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		require.Len(t, result.RecoveryCodes, 10)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]interface{}{
+			"mfa_token":     loginWithMFAChallenge(t, ts),
+			"recovery_code": recoveryCodes[1],
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		recoveryCodes = result.RecoveryCodes
+	})
+
+	t.Run("disable requires re-authentication", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/disable", map[string]interface{}{
+			"password": "Pass123",
+		}, headers)
+		assert.Equal(t, 400, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/disable", map[string]interface{}{
+			"password":      "wrong",
+			"recovery_code": recoveryCodes[0],
+		}, headers)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/disable", map[string]interface{}{
+			"password":      "Pass123",
+			"recovery_code": recoveryCodes[0],
+		}, headers)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+	})
+}
+
+func TestTOTPWithoutPassword(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.RecoveryCode{}, &models.Passkey{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+	headers := getAuthHeaders(token)
+
+	// Users provisioned by a directory or identity provider have no password
+	require.NoError(t, ts.DB.Model(&models.User{}).Where("email = ?", "john@example.com").Update("password", "").Error)
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/enroll", nil, headers)
+	require.Equal(t, 200, resp.StatusCode)
+	var enrollment models.TOTPEnrollmentResponse
+	require.NoError(t, resp.DecodeBody(&enrollment))
+	secret := enrollment.Secret
+
+	resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/confirm", map[string]interface{}{
+		"code": totpCode(t, secret, time.Now()),
+	}, headers)
+	require.Equal(t, 200, resp.StatusCode)
+
+	t.Run("regenerate recovery codes with code", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/recovery_codes", map[string]interface{}{
+			"password": "Pass123",
+		}, headers)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/recovery_codes", map[string]interface{}{
+			"code": "000000",
+		}, headers)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/recovery_codes", map[string]interface{}{
+			"code": totpCode(t, secret, time.Now().Add(totp.Period)),
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.RecoveryCodesResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Len(t, result.RecoveryCodes, 10)
+	})
+
+	t.Run("disable with passkey", func(t *testing.T) {
+		authenticator := testutil.NewSoftAuthenticator(ts.Config.WebAuthn.Origins[0])
+		resp := registerPasskey(t, ts, token, authenticator, "Laptop")
+		require.Equal(t, 201, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/passkeys/reauthenticate/options", nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		var options models.PasskeyRequestOptionsResponse
+		require.NoError(t, resp.DecodeBody(&options))
+		assert.Equal(t, "required", options.PublicKey.UserVerification)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/disable", map[string]interface{}{
+			"passkey": authenticator.Assert(t, options.PublicKey),
+		}, headers)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, headers)
+		var user models.UserResponse
+		require.NoError(t, resp.DecodeBody(&user))
+		assert.False(t, user.MFAEnabled)
+	})
+}
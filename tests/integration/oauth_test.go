@@ -0,0 +1,453 @@
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const oauthRedirectURI = "http://localhost:4000/callback"
+
+func createOAuthClient(t *testing.T, ts *testutil.TestServer, adminToken string, body map[string]any) models.CreatedOAuthClientResponse {
+	resp := ts.SendRequest(t, "POST", "/api/v1/admin/oauth/clients", body, getAuthHeaders(adminToken))
+	require.Equal(t, 201, resp.StatusCode)
+
+	var client models.CreatedOAuthClientResponse
+	require.NoError(t, resp.DecodeBody(&client))
+	return client
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizeOAuthClient runs the browser side of the authorization code flow:
+// the authorize redirect, the consent screen and the approval. It returns the
+// query of the address the browser is sent back to.
+func authorizeOAuthClient(t *testing.T, ts *testutil.TestServer, sessionToken string, params url.Values, approve bool) url.Values {
+	resp := ts.SendRequest(t, "GET", "/oauth/authorize?"+params.Encode(), nil, nil)
+	require.Equal(t, 302, resp.StatusCode)
+
+	consent, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "/oauth/consent", consent.Path)
+	requestId := consent.Query().Get("request")
+	require.NotEmpty(t, requestId)
+
+	resp = ts.SendRequest(t, "GET", "/api/v1/oauth/requests/"+requestId, nil, getAuthHeaders(sessionToken))
+	require.Equal(t, 200, resp.StatusCode)
+
+	action := "deny"
+	if approve {
+		action = "approve"
+	}
+	resp = ts.SendRequest(t, "POST", "/api/v1/oauth/requests/"+requestId+"/"+action, nil, getAuthHeaders(sessionToken))
+	require.Equal(t, 200, resp.StatusCode)
+
+	var result models.OAuthRedirectResponse
+	require.NoError(t, resp.DecodeBody(&result))
+	redirect, err := url.Parse(result.RedirectTo)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(result.RedirectTo, oauthRedirectURI))
+	return redirect.Query()
+}
+
+func requestOAuthTokens(t *testing.T, ts *testutil.TestServer, body map[string]any, headers map[string]string) (*testutil.TestResponse, models.OAuthTokenResponse) {
+	resp := ts.SendRequest(t, "POST", "/oauth/token", body, headers)
+
+	var tokens models.OAuthTokenResponse
+	if resp.StatusCode == 200 {
+		require.NoError(t, resp.DecodeBody(&tokens))
+	}
+	return resp, tokens
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{}, &models.OAuthClient{})
+	require.NoError(t, err)
+
+	session := createAdminUser(t, ts).Token
+	createTestPost(t, ts, session)
+
+	client := createOAuthClient(t, ts, session, map[string]any{
+		"name":          "Reader",
+		"redirect_uris": []string{oauthRedirectURI},
+		"scopes":        []string{models.ScopePostsRead, models.ScopeUserRead},
+		"grant_types":   []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken},
+		"public":        true,
+	})
+	assert.Empty(t, client.ClientSecret)
+
+	verifier := "a-sufficiently-long-pkce-code-verifier-for-testing"
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {oauthRedirectURI},
+		"scope":                 {models.ScopePostsRead},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	t.Run("rejects unregistered redirect URIs", func(t *testing.T) {
+		bad := url.Values{"response_type": {"code"}, "client_id": {client.ClientID}, "redirect_uri": {"http://evil.example/callback"}}
+		resp := ts.SendRequest(t, "GET", "/oauth/authorize?"+bad.Encode(), nil, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("public clients must use PKCE", func(t *testing.T) {
+		plain := url.Values{"response_type": {"code"}, "client_id": {client.ClientID}, "state": {"xyz"}}
+		resp := ts.SendRequest(t, "GET", "/oauth/authorize?"+plain.Encode(), nil, nil)
+		require.Equal(t, 302, resp.StatusCode)
+
+		redirect, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "invalid_request", redirect.Query().Get("error"))
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	})
+
+	t.Run("denied consent", func(t *testing.T) {
+		query := authorizeOAuthClient(t, ts, session, params, false)
+		assert.Equal(t, "access_denied", query.Get("error"))
+		assert.Empty(t, query.Get("code"))
+	})
+
+	t.Run("code requires the PKCE verifier", func(t *testing.T) {
+		query := authorizeOAuthClient(t, ts, session, params, true)
+		resp, _ := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "authorization_code",
+			"code":          query.Get("code"),
+			"redirect_uri":  oauthRedirectURI,
+			"client_id":     client.ClientID,
+			"code_verifier": "wrong-verifier",
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("redirect URI must match when it was sent", func(t *testing.T) {
+		query := authorizeOAuthClient(t, ts, session, params, true)
+		resp, _ := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "authorization_code",
+			"code":          query.Get("code"),
+			"client_id":     client.ClientID,
+			"code_verifier": verifier,
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("redirect URI may be left out when it was left out", func(t *testing.T) {
+		implicit := url.Values{}
+		for key, values := range params {
+			if key != "redirect_uri" {
+				implicit[key] = values
+			}
+		}
+		query := authorizeOAuthClient(t, ts, session, implicit, true)
+		resp, _ := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "authorization_code",
+			"code":          query.Get("code"),
+			"client_id":     client.ClientID,
+			"code_verifier": verifier,
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		query = authorizeOAuthClient(t, ts, session, implicit, true)
+		resp, _ = requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "authorization_code",
+			"code":          query.Get("code"),
+			"redirect_uri":  "http://localhost:4000/other",
+			"client_id":     client.ClientID,
+			"code_verifier": verifier,
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	query := authorizeOAuthClient(t, ts, session, params, true)
+	assert.Equal(t, "xyz", query.Get("state"))
+	exchange := map[string]any{
+		"grant_type":    "authorization_code",
+		"code":          query.Get("code"),
+		"redirect_uri":  oauthRedirectURI,
+		"client_id":     client.ClientID,
+		"code_verifier": verifier,
+	}
+	resp, tokens := requestOAuthTokens(t, ts, exchange, nil)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.True(t, strings.HasPrefix(tokens.AccessToken, "oat_"))
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, models.ScopePostsRead, tokens.Scope)
+
+	t.Run("code is single use", func(t *testing.T) {
+		resp, _ := requestOAuthTokens(t, ts, exchange, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("access token is limited to its scopes", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/sessions", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("refresh rotates and detects reuse", func(t *testing.T) {
+		refresh := map[string]any{
+			"grant_type":    "refresh_token",
+			"refresh_token": tokens.RefreshToken,
+			"client_id":     client.ClientID,
+		}
+		resp, refreshed := requestOAuthTokens(t, ts, refresh, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(refreshed.AccessToken))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp, _ = requestOAuthTokens(t, ts, refresh, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(refreshed.AccessToken))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("revocation", func(t *testing.T) {
+		query := authorizeOAuthClient(t, ts, session, params, true)
+		exchange["code"] = query.Get("code")
+		resp, tokens := requestOAuthTokens(t, ts, exchange, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/oauth/revoke", map[string]any{
+			"token":     tokens.RefreshToken,
+			"client_id": client.ClientID,
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("suspended accounts can't refresh", func(t *testing.T) {
+		query := authorizeOAuthClient(t, ts, session, params, true)
+		exchange["code"] = query.Get("code")
+		resp, tokens := requestOAuthTokens(t, ts, exchange, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		require.NoError(t, ts.DB.Model(&models.User{}).Where("email = ?", "john@example.com").Update("suspended_at", time.Now()).Error)
+
+		resp, _ = requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "refresh_token",
+			"refresh_token": tokens.RefreshToken,
+			"client_id":     client.ClientID,
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+
+		var result map[string]any
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Equal(t, "invalid_grant", result["error"])
+	})
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{}, &models.OAuthClient{})
+	require.NoError(t, err)
+
+	session := createAdminUser(t, ts).Token
+
+	t.Run("public clients cannot use client credentials", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/admin/oauth/clients", map[string]any{
+			"name":        "SPA",
+			"scopes":      []string{models.ScopePostsRead},
+			"grant_types": []string{models.GrantTypeClientCredentials},
+			"public":      true,
+		}, getAuthHeaders(session))
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	client := createOAuthClient(t, ts, session, map[string]any{
+		"name":        "Worker",
+		"scopes":      []string{models.ScopePostsRead},
+		"grant_types": []string{models.GrantTypeClientCredentials},
+	})
+	require.NotEmpty(t, client.ClientSecret)
+	basic := map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(client.ClientID+":"+client.ClientSecret)),
+	}
+
+	t.Run("requires the client secret", func(t *testing.T) {
+		resp, _ := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "client_credentials",
+			"client_id":     client.ClientID,
+			"client_secret": "wrong",
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("rejects grants the client was not registered for", func(t *testing.T) {
+		resp, _ := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "refresh_token",
+			"refresh_token": "ort_unknown",
+		}, basic)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	resp, tokens := requestOAuthTokens(t, ts, map[string]any{"grant_type": "client_credentials"}, basic)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Empty(t, tokens.RefreshToken)
+
+	t.Run("token does not act as a user", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("removing the client revokes its tokens", func(t *testing.T) {
+		resp := ts.SendRequest(t, "DELETE", "/api/v1/admin/oauth/clients/"+strconv.Itoa(int(client.ID)), nil, getAuthHeaders(session))
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+}
+
+func TestOAuthTokenIntrospection(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{}, &models.OAuthClient{}, &models.PersonalAccessToken{})
+	require.NoError(t, err)
+
+	session := createAdminUser(t, ts)
+
+	gateway := createOAuthClient(t, ts, session.Token, map[string]any{
+		"name":        "Gateway",
+		"scopes":      []string{models.ScopePostsRead},
+		"grant_types": []string{models.GrantTypeClientCredentials},
+	})
+	basic := map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(gateway.ClientID+":"+gateway.ClientSecret)),
+	}
+
+	introspect := func(t *testing.T, token string) models.OAuthIntrospectionResponse {
+		resp := ts.SendRequest(t, "POST", "/oauth/introspect", map[string]any{"token": token}, basic)
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+		var result models.OAuthIntrospectionResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		return result
+	}
+
+	var user models.User
+	require.NoError(t, ts.DB.First(&user, "email = ?", "john@example.com").Error)
+	sub := strconv.Itoa(int(user.ID))
+
+	t.Run("requires a confidential client", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/oauth/introspect", map[string]any{"token": session.Token}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		spa := createOAuthClient(t, ts, session.Token, map[string]any{
+			"name":          "SPA",
+			"redirect_uris": []string{oauthRedirectURI},
+			"scopes":        []string{models.ScopePostsRead},
+			"grant_types":   []string{models.GrantTypeAuthorizationCode},
+			"public":        true,
+		})
+		resp = ts.SendRequest(t, "POST", "/oauth/introspect", map[string]any{
+			"token":     session.Token,
+			"client_id": spa.ClientID,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("session tokens", func(t *testing.T) {
+		result := introspect(t, session.Token)
+		assert.True(t, result.Active)
+		assert.Equal(t, sub, result.Sub)
+		assert.Equal(t, "Bearer", result.TokenType)
+		assert.Equal(t, "access_token", result.TokenUse)
+		assert.NotZero(t, result.Exp)
+
+		result = introspect(t, session.RefreshToken)
+		assert.True(t, result.Active)
+		assert.Equal(t, sub, result.Sub)
+		assert.Equal(t, "refresh_token", result.TokenUse)
+	})
+
+	t.Run("personal access tokens", func(t *testing.T) {
+		pat := createAccessToken(t, ts, session.Token, map[string]any{
+			"name":   "CI",
+			"scopes": []string{models.ScopePostsRead},
+		})
+
+		result := introspect(t, pat.Token)
+		assert.True(t, result.Active)
+		assert.Equal(t, sub, result.Sub)
+		assert.Equal(t, models.ScopePostsRead, result.Scope)
+
+		// Suspension is checked every time, so lifting it reactivates the token
+		require.NoError(t, ts.DB.Model(&user).Update("suspended_at", user.CreatedAt).Error)
+		assert.False(t, introspect(t, pat.Token).Active)
+		require.NoError(t, ts.DB.Model(&user).Update("suspended_at", nil).Error)
+		assert.True(t, introspect(t, pat.Token).Active)
+	})
+
+	t.Run("client credentials tokens", func(t *testing.T) {
+		resp, tokens := requestOAuthTokens(t, ts, map[string]any{"grant_type": "client_credentials"}, basic)
+		require.Equal(t, 200, resp.StatusCode)
+
+		result := introspect(t, tokens.AccessToken)
+		assert.True(t, result.Active)
+		assert.Equal(t, gateway.ClientID, result.ClientID)
+		assert.Empty(t, result.Sub)
+		assert.Equal(t, models.ScopePostsRead, result.Scope)
+	})
+
+	t.Run("unknown tokens are cached as inactive", func(t *testing.T) {
+		for _, token := range []string{"garbage", "pat_unknown", "oat_unknown", "ort_unknown", "a.b.c"} {
+			result := introspect(t, token)
+			assert.False(t, result.Active, token)
+			assert.Empty(t, result.Sub, token)
+
+			cached, err := database.RedisClient.Exists(context.Background(), "inactive_token:"+auth.HashToken(token)).Result()
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), cached, token)
+		}
+	})
+
+	t.Run("revoking a session refresh token ends the session", func(t *testing.T) {
+		other := loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+
+		resp := ts.SendRequest(t, "POST", "/oauth/revoke", map[string]any{"token": other.RefreshToken}, basic)
+		require.Equal(t, 200, resp.StatusCode)
+
+		assert.False(t, introspect(t, other.RefreshToken).Active)
+		assert.False(t, introspect(t, other.Token).Active)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(other.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+		assert.True(t, introspect(t, session.Token).Active)
+	})
+}
@@ -0,0 +1,159 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenIDConnect(t *testing.T) {
+	keysDir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writeSigningKey(t, keysDir, "ec-1", key)
+
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.JWT.KeysDir = keysDir
+		cfg.JWT.SigningKeyID = "ec-1"
+	})
+	defer ts.Close(t)
+
+	err = ts.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.OAuthClient{})
+	require.NoError(t, err)
+
+	session := createAdminUser(t, ts).Token
+	var user models.User
+	require.NoError(t, ts.DB.First(&user, "email = ?", "john@example.com").Error)
+
+	client := createOAuthClient(t, ts, session, map[string]any{
+		"name":                      "Dashboard",
+		"redirect_uris":             []string{oauthRedirectURI},
+		"post_logout_redirect_uris": []string{"http://localhost:4000/"},
+		"scopes":                    []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail, models.ScopePostsRead},
+		"grant_types":               []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken},
+		"public":                    true,
+	})
+
+	verifier := "another-sufficiently-long-pkce-code-verifier"
+	login := func(t *testing.T, scope, nonce string) models.OAuthTokenResponse {
+		query := authorizeOAuthClient(t, ts, session, url.Values{
+			"response_type":         {"code"},
+			"client_id":             {client.ClientID},
+			"scope":                 {scope},
+			"nonce":                 {nonce},
+			"code_challenge":        {pkceChallenge(verifier)},
+			"code_challenge_method": {"S256"},
+		}, true)
+
+		resp, tokens := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "authorization_code",
+			"code":          query.Get("code"),
+			"redirect_uri":  oauthRedirectURI,
+			"client_id":     client.ClientID,
+			"code_verifier": verifier,
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		return tokens
+	}
+
+	verifyIDToken := func(t *testing.T, idToken string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		require.NoError(t, err)
+		assert.True(t, claims.VerifyIssuer(ts.Config.OAuth.Issuer, true))
+		assert.True(t, claims.VerifyAudience(client.ClientID, true))
+		return claims
+	}
+
+	t.Run("discovery", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/.well-known/openid-configuration", nil, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var discovery models.OpenIDConfiguration
+		require.NoError(t, resp.DecodeBody(&discovery))
+		assert.Equal(t, ts.Config.OAuth.Issuer, discovery.Issuer)
+		assert.Equal(t, ts.Config.OAuth.Issuer+"/oauth/token", discovery.TokenEndpoint)
+		assert.Equal(t, []string{"ES256"}, discovery.IDTokenSigningAlgValuesSupported)
+	})
+
+	t.Run("only the openid scope gets an ID token", func(t *testing.T) {
+		tokens := login(t, models.ScopePostsRead, "")
+		assert.Empty(t, tokens.IDToken)
+
+		resp := ts.SendRequest(t, "GET", "/oauth/userinfo", nil, getAuthHeaders(tokens.AccessToken))
+		assert.Equal(t, 403, resp.StatusCode)
+	})
+
+	t.Run("claims follow the scopes", func(t *testing.T) {
+		tokens := login(t, "openid email", "n-1")
+		claims := verifyIDToken(t, tokens.IDToken)
+		assert.Equal(t, strconv.Itoa(int(user.ID)), claims["sub"])
+		assert.Equal(t, "n-1", claims["nonce"])
+		assert.Equal(t, "john@example.com", claims["email"])
+		assert.Equal(t, false, claims["email_verified"])
+		assert.NotContains(t, claims, "given_name")
+
+		resp := ts.SendRequest(t, "GET", "/oauth/userinfo", nil, getAuthHeaders(tokens.AccessToken))
+		require.Equal(t, 200, resp.StatusCode)
+		var info models.UserInfoResponse
+		require.NoError(t, resp.DecodeBody(&info))
+		assert.Equal(t, "john@example.com", info.Email)
+		assert.Empty(t, info.GivenName)
+	})
+
+	tokens := login(t, "openid profile email", "n-2")
+	claims := verifyIDToken(t, tokens.IDToken)
+	assert.Equal(t, "John", claims["given_name"])
+	assert.Equal(t, "Doe", claims["family_name"])
+	assert.NotEmpty(t, claims["sid"])
+
+	t.Run("refresh issues a new ID token without the nonce", func(t *testing.T) {
+		resp, refreshed := requestOAuthTokens(t, ts, map[string]any{
+			"grant_type":    "refresh_token",
+			"refresh_token": tokens.RefreshToken,
+			"client_id":     client.ClientID,
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		refreshedClaims := verifyIDToken(t, refreshed.IDToken)
+		assert.Equal(t, claims["sub"], refreshedClaims["sub"])
+		assert.Equal(t, claims["sid"], refreshedClaims["sid"])
+		assert.NotContains(t, refreshedClaims, "nonce")
+	})
+
+	t.Run("logout rejects unregistered redirects", func(t *testing.T) {
+		params := url.Values{"id_token_hint": {tokens.IDToken}, "post_logout_redirect_uri": {"http://evil.example/"}}
+		resp := ts.SendRequest(t, "GET", "/oauth/logout?"+params.Encode(), nil, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/oauth/logout?id_token_hint=garbage", nil, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("logout ends the session", func(t *testing.T) {
+		params := url.Values{
+			"id_token_hint":            {tokens.IDToken},
+			"post_logout_redirect_uri": {"http://localhost:4000/"},
+			"state":                    {"bye"},
+		}
+		resp := ts.SendRequest(t, "GET", "/oauth/logout?"+params.Encode(), nil, nil)
+		require.Equal(t, 302, resp.StatusCode)
+		assert.Equal(t, "http://localhost:4000/?state=bye", resp.Header.Get("Location"))
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(session))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+}
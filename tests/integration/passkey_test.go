@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerPasskey runs the registration ceremony with the authenticator and
+// returns the server's response.
+func registerPasskey(t *testing.T, ts *testutil.TestServer, token string, authenticator *testutil.SoftAuthenticator, name string) *testutil.TestResponse {
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/passkeys/register/options", nil, getAuthHeaders(token))
+	require.Equal(t, 200, resp.StatusCode)
+
+	var options models.PasskeyCreationOptionsResponse
+	require.NoError(t, resp.DecodeBody(&options))
+
+	return ts.SendRequest(t, "POST", "/api/v1/user/passkeys/register", map[string]any{
+		"name":       name,
+		"credential": authenticator.Register(t, options.PublicKey),
+	}, getAuthHeaders(token))
+}
+
+// loginWithPasskey runs the login ceremony with the authenticator and
+// returns the server's response.
+func loginWithPasskey(t *testing.T, ts *testutil.TestServer, authenticator *testutil.SoftAuthenticator) *testutil.TestResponse {
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/login/passkey/options", nil, nil)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var options models.PasskeyRequestOptionsResponse
+	require.NoError(t, resp.DecodeBody(&options))
+	assert.Equal(t, "required", options.PublicKey.UserVerification)
+
+	return ts.SendRequest(t, "POST", "/api/v1/user/login/passkey", map[string]any{
+		"credential": authenticator.Assert(t, options.PublicKey),
+	}, nil)
+}
+
+func TestPasskeys(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.RecoveryCode{}, &models.Identity{}, &models.Passkey{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+	headers := getAuthHeaders(token)
+	authenticator := testutil.NewSoftAuthenticator(ts.Config.WebAuthn.Origins[0])
+
+	var laptop models.PasskeyResponse
+
+	t.Run("register", func(t *testing.T) {
+		resp := registerPasskey(t, ts, token, authenticator, "Laptop")
+		require.Equal(t, 201, resp.StatusCode)
+		require.NoError(t, resp.DecodeBody(&laptop))
+		assert.Equal(t, "Laptop", laptop.Name)
+
+		packed := testutil.NewSoftAuthenticator(ts.Config.WebAuthn.Origins[0])
+		packed.Attestation = "packed"
+		resp = registerPasskey(t, ts, token, packed, "")
+		require.Equal(t, 201, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/user/passkeys", nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		var passkeys models.PasskeysResponse
+		require.NoError(t, resp.DecodeBody(&passkeys))
+		require.Len(t, passkeys.Items, 2)
+		assert.Equal(t, "Laptop", passkeys.Items[0].Name)
+		assert.Equal(t, "Passkey", passkeys.Items[1].Name)
+	})
+
+	t.Run("registration challenge is single use", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/passkeys/register/options", nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		var options models.PasskeyCreationOptionsResponse
+		require.NoError(t, resp.DecodeBody(&options))
+		assert.Len(t, options.PublicKey.ExcludeCredentials, 2)
+
+		body := map[string]any{"credential": testutil.NewSoftAuthenticator(ts.Config.WebAuthn.Origins[0]).Register(t, options.PublicKey)}
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/passkeys/register", body, headers)
+		require.Equal(t, 201, resp.StatusCode)
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/passkeys/register", body, headers)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("log in with a passkey", func(t *testing.T) {
+		resp := loginWithPasskey(t, ts, authenticator)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, string(resp.Body), "john@example.com")
+
+		var passkey models.Passkey
+		require.NoError(t, ts.DB.First(&passkey, laptop.ID).Error)
+		assert.Equal(t, int64(1), passkey.SignCount)
+		assert.NotNil(t, passkey.LastUsedAt)
+	})
+
+	t.Run("login requires user verification", func(t *testing.T) {
+		authenticator.UserVerified = false
+		defer func() { authenticator.UserVerified = true }()
+
+		resp := loginWithPasskey(t, ts, authenticator)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("login from another origin is rejected", func(t *testing.T) {
+		phished := authenticator.Clone()
+		phished.Origin = "https://evil.example"
+
+		resp := loginWithPasskey(t, ts, phished)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("cloned passkey is detected by its counter", func(t *testing.T) {
+		clone := authenticator.Clone()
+
+		resp := loginWithPasskey(t, ts, authenticator)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = loginWithPasskey(t, ts, clone)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("passkey as second factor", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/enroll", nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		var enrollment models.TOTPEnrollmentResponse
+		require.NoError(t, resp.DecodeBody(&enrollment))
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/mfa/totp/confirm", map[string]any{
+			"code": totpCode(t, enrollment.Secret, time.Now()),
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{
+			"email":    "john@example.com",
+			"password": "Pass123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		var challenge models.MFAChallengeResponse
+		require.NoError(t, resp.DecodeBody(&challenge))
+		assert.Contains(t, challenge.Methods, models.MFAMethodPasskey)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa/passkey/options", map[string]any{
+			"mfa_token": challenge.MFAToken,
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		var options models.PasskeyRequestOptionsResponse
+		require.NoError(t, resp.DecodeBody(&options))
+		assert.Len(t, options.PublicKey.AllowCredentials, 3)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]any{
+			"mfa_token": challenge.MFAToken,
+			"passkey":   authenticator.Assert(t, options.PublicKey),
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		assert.NotEmpty(t, tokens.Token)
+	})
+
+	t.Run("passkeys of other users are refused", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+			"first_name": "Jane",
+			"last_name":  "Smith",
+			"age":        25,
+			"email":      "jane@example.com",
+			"password":   "Pass123",
+		}, nil)
+		require.Equal(t, 201, resp.StatusCode)
+		var jane models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&jane))
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/user/passkeys", nil, getAuthHeaders(jane.Token))
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, string(resp.Body), `"items":[]`)
+
+		resp = ts.SendRequest(t, "DELETE", fmt.Sprintf("/api/v1/user/passkeys/%d", laptop.ID), nil, getAuthHeaders(jane.Token))
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("rename and delete", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/user/passkeys/%d", laptop.ID)
+
+		resp := ts.SendRequest(t, "PATCH", path, map[string]any{"name": "Work laptop"}, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		var renamed models.PasskeyResponse
+		require.NoError(t, resp.DecodeBody(&renamed))
+		assert.Equal(t, "Work laptop", renamed.Name)
+
+		resp = ts.SendRequest(t, "DELETE", path, nil, headers)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = loginWithPasskey(t, ts, authenticator)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("passwordless user keeps their last passkey", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+			"first_name": "Ann",
+			"last_name":  "Lee",
+			"age":        40,
+			"email":      "ann@example.com",
+			"password":   "Pass123",
+		}, nil)
+		require.Equal(t, 201, resp.StatusCode)
+		var ann models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&ann))
+
+		resp = registerPasskey(t, ts, ann.Token, testutil.NewSoftAuthenticator(ts.Config.WebAuthn.Origins[0]), "Phone")
+		require.Equal(t, 201, resp.StatusCode)
+		var passkey models.PasskeyResponse
+		require.NoError(t, resp.DecodeBody(&passkey))
+
+		require.NoError(t, ts.DB.Model(&models.User{}).Where("email = ?", "ann@example.com").UpdateColumn("password", "").Error)
+
+		resp = ts.SendRequest(t, "DELETE", fmt.Sprintf("/api/v1/user/passkeys/%d", passkey.ID), nil, getAuthHeaders(ann.Token))
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+}
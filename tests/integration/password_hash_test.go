@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func storedPasswordHash(t *testing.T, ts *testutil.TestServer, email string) string {
+	var user models.User
+	require.NoError(t, ts.DB.First(&user, "email = ?", email).Error)
+	return user.Password
+}
+
+func TestPasswordHashing(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	createTestUser(t, ts)
+	const email = "john@example.com"
+
+	t.Run("new passwords use argon2id", func(t *testing.T) {
+		hash := storedPasswordHash(t, ts, email)
+		params := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$", ts.Config.Password.Argon2Memory, ts.Config.Password.Argon2Iterations, ts.Config.Password.Argon2Parallelism)
+		assert.True(t, strings.HasPrefix(hash, params), hash)
+	})
+
+	t.Run("legacy bcrypt hashes are upgraded on login", func(t *testing.T) {
+		for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+			legacy, err := bcrypt.GenerateFromPassword([]byte("Pass123"), bcrypt.MinCost)
+			require.NoError(t, err)
+			legacyHash := prefix + string(legacy[4:])
+			require.NoError(t, ts.DB.Model(&models.User{}).Where("email = ?", email).UpdateColumn("password", legacyHash).Error)
+
+			assert.Equal(t, 401, attemptLogin(t, ts, email, "wrong").StatusCode)
+			assert.Equal(t, legacyHash, storedPasswordHash(t, ts, email))
+
+			loginTestUser(t, ts, email, "Pass123", nil)
+			assert.True(t, strings.HasPrefix(storedPasswordHash(t, ts, email), "$argon2id$"), prefix)
+		}
+
+		loginTestUser(t, ts, email, "Pass123", nil)
+	})
+
+	t.Run("passwords that look like hashes are hashed", func(t *testing.T) {
+		// Verifying this as a stored hash would make argon2 panic
+		const hashLike = "$argon2id$v=19$m=1,t=0,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA"
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+			"first_name": "Mallory",
+			"last_name":  "Hash",
+			"age":        30,
+			"email":      "mallory@example.com",
+			"password":   hashLike,
+		}, nil)
+		require.Equal(t, 201, resp.StatusCode)
+
+		hash := storedPasswordHash(t, ts, "mallory@example.com")
+		assert.NotEqual(t, hashLike, hash)
+		loginTestUser(t, ts, "mallory@example.com", hashLike, nil)
+	})
+
+	t.Run("hashes follow configuration changes", func(t *testing.T) {
+		bcryptServer := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+			cfg.Password.Algorithm = "bcrypt"
+			cfg.Password.BcryptCost = bcrypt.MinCost
+		})
+
+		loginTestUser(t, bcryptServer, email, "Pass123", nil)
+		hash := storedPasswordHash(t, bcryptServer, email)
+		cost, err := bcrypt.Cost([]byte(hash))
+		require.NoError(t, err)
+		assert.Equal(t, bcrypt.MinCost, cost)
+
+		argon2Server := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+			cfg.Password.Argon2Memory = 2048
+			cfg.Password.Argon2Iterations = 2
+			cfg.Password.Argon2Parallelism = 1
+		})
+
+		loginTestUser(t, argon2Server, email, "Pass123", nil)
+		assert.True(t, strings.HasPrefix(storedPasswordHash(t, argon2Server, email), "$argon2id$v=19$m=2048,t=2,p=1$"))
+	})
+}
@@ -0,0 +1,104 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/password"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHistory(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Password.HistorySize = 2
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.PasswordHistory{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+	current := "Pass123"
+
+	changePassword := func(newPassword string) *testutil.TestResponse {
+		return ts.SendRequest(t, "PATCH", "/api/v1/user/update_password", map[string]any{
+			"current_password": current,
+			"new_password":     newPassword,
+		}, getAuthHeaders(token))
+	}
+
+	t.Run("current password cannot be reused", func(t *testing.T) {
+		assert.Equal(t, []string{password.ViolationReused}, violationCodes(t, changePassword("Pass123")))
+	})
+
+	t.Run("recent passwords cannot be reused", func(t *testing.T) {
+		for _, next := range []string{"Second123", "Third123", "Fourth123"} {
+			require.Equal(t, 200, changePassword(next).StatusCode)
+			current = next
+		}
+
+		assert.Equal(t, []string{password.ViolationReused}, violationCodes(t, changePassword("Third123")))
+		assert.Equal(t, []string{password.ViolationReused}, violationCodes(t, changePassword("Second123")))
+
+		var count int64
+		ts.DB.Model(&models.PasswordHistory{}).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("older passwords can be used again", func(t *testing.T) {
+		assert.Equal(t, 200, changePassword("Pass123").StatusCode)
+		current = "Pass123"
+	})
+}
+
+func TestPasswordMaxAge(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Password.MaxAge = 24 * time.Hour
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.PasswordHistory{})
+	require.NoError(t, err)
+
+	createTestUser(t, ts)
+	const email = "john@example.com"
+
+	t.Run("fresh passwords log in", func(t *testing.T) {
+		loginTestUser(t, ts, email, "Pass123", nil)
+	})
+
+	t.Run("expired password must be changed", func(t *testing.T) {
+		require.NoError(t, ts.DB.Model(&models.User{}).Where("email = ?", email).
+			UpdateColumn("password_changed_at", time.Now().Add(-48*time.Hour)).Error)
+
+		resp := attemptLogin(t, ts, email, "Pass123")
+		require.Equal(t, 403, resp.StatusCode)
+
+		var expired models.PasswordExpiredResponse
+		require.NoError(t, resp.DecodeBody(&expired))
+		assert.Equal(t, "password_expired", expired.Code)
+		require.NotEmpty(t, expired.ResetToken)
+
+		// A wrong password gets no hint that it has expired
+		assert.Equal(t, 401, attemptLogin(t, ts, email, "WrongPass123").StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        expired.ResetToken,
+			"new_password": "Pass123",
+		}, nil)
+		assert.Equal(t, []string{password.ViolationReused}, violationCodes(t, resp))
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        expired.ResetToken,
+			"new_password": "Renewed123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		loginTestUser(t, ts, email, "Renewed123", nil)
+	})
+}
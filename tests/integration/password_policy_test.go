@@ -0,0 +1,141 @@
+package integration
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/password"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBreachedCorpus writes an HIBP-format range file listing the
+// passwords and returns the directory holding it.
+func writeBreachedCorpus(t *testing.T, passwords ...string) string {
+	dir := t.TempDir()
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		line := hash[5:] + ":42\r\n"
+
+		f, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		require.NoError(t, err)
+		_, err = f.WriteString("0018A45C4D1DEF81644B54AB7F969B88D65:3\r\n" + line)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	return dir
+}
+
+func violationCodes(t *testing.T, resp *testutil.TestResponse) []string {
+	require.Equal(t, 400, resp.StatusCode)
+
+	var result models.PasswordPolicyErrorResponse
+	require.NoError(t, resp.DecodeBody(&result))
+
+	codes := make([]string, 0, len(result.Violations))
+	for _, violation := range result.Violations {
+		assert.NotEmpty(t, violation.Message)
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	breached := writeBreachedCorpus(t, "Breached-Password-2024")
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Password.MinLength = 10
+		cfg.Password.MaxLength = 64
+		cfg.Password.RequireUppercase = true
+		cfg.Password.RequireDigit = true
+		cfg.Password.RequireSymbol = true
+		cfg.Password.DisallowPersonalInfo = true
+		cfg.Password.MinStrength = 3
+		cfg.Password.BreachedDir = breached
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	signUp := func(pw string) *testutil.TestResponse {
+		return ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+			"first_name": "Policy",
+			"last_name":  "Tester",
+			"age":        30,
+			"email":      "policy@example.com",
+			"password":   pw,
+		}, nil)
+	}
+
+	t.Run("signup reports every broken rule", func(t *testing.T) {
+		codes := violationCodes(t, signUp("pass"))
+		assert.ElementsMatch(t, []string{
+			password.ViolationTooShort,
+			password.ViolationMissingUppercase,
+			password.ViolationMissingDigit,
+			password.ViolationMissingSymbol,
+			password.ViolationTooWeak,
+		}, codes)
+
+		codes = violationCodes(t, signUp(strings.Repeat("Ab1!", 20)))
+		assert.Contains(t, codes, password.ViolationTooLong)
+	})
+
+	t.Run("personal info is rejected", func(t *testing.T) {
+		codes := violationCodes(t, signUp("Tester#2024-xyz"))
+		assert.Equal(t, []string{password.ViolationPersonalInfo}, codes)
+	})
+
+	t.Run("breached passwords are rejected", func(t *testing.T) {
+		codes := violationCodes(t, signUp("Breached-Password-2024"))
+		assert.Equal(t, []string{password.ViolationBreached}, codes)
+	})
+
+	var session string
+	t.Run("strong password is accepted", func(t *testing.T) {
+		resp := signUp("Vq8#mZr!2kLw")
+		require.Equal(t, 201, resp.StatusCode)
+
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		session = tokens.Token
+	})
+
+	t.Run("update password applies the policy", func(t *testing.T) {
+		resp := ts.SendRequest(t, "PATCH", "/api/v1/user/update_password", map[string]any{
+			"current_password": "Vq8#mZr!2kLw",
+			"new_password":     "policy@example",
+		}, getAuthHeaders(session))
+		assert.Contains(t, violationCodes(t, resp), password.ViolationPersonalInfo)
+	})
+
+	t.Run("reset password applies the policy and keeps the link usable", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/forgot", map[string]any{
+			"email": "policy@example.com",
+		}, nil)
+		require.Equal(t, 202, resp.StatusCode)
+		token := waitForEmail(t, ts, "policy@example.com", resetSubject, 1, "token")
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        token,
+			"new_password": "Breached-Password-2024",
+		}, nil)
+		assert.Equal(t, []string{password.ViolationBreached}, violationCodes(t, resp))
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]any{
+			"token":        token,
+			"new_password": "Hj4$wPn9&tRe",
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+		loginTestUser(t, ts, "policy@example.com", "Hj4$wPn9&tRe", nil)
+	})
+}
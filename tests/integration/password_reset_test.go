@@ -0,0 +1,146 @@
+package integration
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/mailer"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resetSubject = "Reset your password"
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// waitForEmail waits for the n-th message with the given subject to the
+// address and returns the value of the given query parameter from the link
+// in its body.
+func waitForEmail(t *testing.T, ts *testutil.TestServer, to, subject string, n int, param string) string {
+	var msg mailer.Message
+	require.Eventually(t, func() bool {
+		var matching []mailer.Message
+		for _, m := range ts.Outbox.Messages(to) {
+			if m.Subject == subject {
+				matching = append(matching, m)
+			}
+		}
+		if len(matching) < n {
+			return false
+		}
+		msg = matching[n-1]
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	link := linkPattern.FindString(msg.Body)
+	require.NotEmpty(t, link)
+
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	value := parsed.Query().Get(param)
+	require.NotEmpty(t, value)
+	return value
+}
+
+func TestPasswordReset(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	sessionToken := createTestUser(t, ts)
+
+	var resetToken string
+
+	t.Run("forgot password for unknown email", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/forgot", map[string]interface{}{
+			"email": "nobody@example.com",
+		}, nil)
+		assert.Equal(t, 202, resp.StatusCode)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Empty(t, ts.Outbox.Messages("nobody@example.com"))
+	})
+
+	t.Run("forgot password sends a reset link", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/forgot", map[string]interface{}{
+			"email": "john@example.com",
+		}, nil)
+		assert.Equal(t, 202, resp.StatusCode)
+
+		resetToken = waitForEmail(t, ts, "john@example.com", resetSubject, 1, "token")
+	})
+
+	t.Run("reset with invalid token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]interface{}{
+			"token":        "invalid",
+			"new_password": "ResetPass123",
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("reset password", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]interface{}{
+			"token":        resetToken,
+			"new_password": "ResetPass123",
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(sessionToken))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		loginTestUser(t, ts, "john@example.com", "ResetPass123", nil)
+	})
+
+	t.Run("reset token can only be used once", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]interface{}{
+			"token":        resetToken,
+			"new_password": "AnotherPass123",
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("requesting a new link invalidates the previous one", func(t *testing.T) {
+		var tokens []string
+		for i := 0; i < 2; i++ {
+			resp := ts.SendRequest(t, "POST", "/api/v1/user/password/forgot", map[string]interface{}{
+				"email": "john@example.com",
+			}, nil)
+			assert.Equal(t, 202, resp.StatusCode)
+
+			tokens = append(tokens, waitForEmail(t, ts, "john@example.com", resetSubject, i+2, "token"))
+		}
+		first, second := tokens[0], tokens[1]
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]interface{}{
+			"token":        first,
+			"new_password": "AnotherPass123",
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/password/reset", map[string]interface{}{
+			"token":        second,
+			"new_password": "AnotherPass123",
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+	t.Run("requests are rate limited", func(t *testing.T) {
+		limited := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+			cfg.RateLimit.PasswordReset = config.Rate{Limit: 1, Window: time.Minute}
+		})
+
+		forgot := map[string]interface{}{"email": "john@example.com"}
+		resp := limited.SendRequest(t, "POST", "/api/v1/user/password/forgot", forgot, nil)
+		assert.Equal(t, 202, resp.StatusCode)
+
+		resp = limited.SendRequest(t, "POST", "/api/v1/user/password/forgot", forgot, nil)
+		assert.Equal(t, 429, resp.StatusCode)
+	})
+}
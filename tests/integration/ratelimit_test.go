@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.RateLimit.Login = config.Rate{Limit: 3, Window: time.Minute}
+		cfg.RateLimit.PostCreate = config.Rate{Limit: 1, Window: time.Minute}
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.PersonalAccessToken{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+
+	t.Run("responses carry the rate limit headers", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/health", nil, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, "300", resp.Header.Get("RateLimit-Limit"))
+		assert.NotEmpty(t, resp.Header.Get("RateLimit-Remaining"))
+		assert.Equal(t, "300;w=60", resp.Header.Get("RateLimit-Policy"))
+	})
+
+	t.Run("login budget", func(t *testing.T) {
+		for _, remaining := range []string{"2", "1", "0"} {
+			resp := attemptLogin(t, ts, "john@example.com", "wrong")
+			assert.Equal(t, 401, resp.StatusCode)
+			assert.Equal(t, remaining, resp.Header.Get("RateLimit-Remaining"))
+		}
+
+		resp := attemptLogin(t, ts, "john@example.com", "Pass123")
+		assert.Equal(t, 429, resp.StatusCode)
+		assert.Equal(t, "3;w=60", resp.Header.Get("RateLimit-Policy"))
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login/mfa", map[string]any{
+			"mfa_token": "anything",
+			"code":      "123456",
+		}, nil)
+		assert.Equal(t, 429, resp.StatusCode)
+	})
+
+	t.Run("post creation budget is per identity", func(t *testing.T) {
+		pat := createAccessToken(t, ts, token, map[string]any{
+			"name":   "writer",
+			"scopes": []string{models.ScopePostsWrite},
+		})
+
+		createTestPost(t, ts, token)
+		resp := ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, getAuthHeaders(token))
+		assert.Equal(t, 429, resp.StatusCode)
+
+		// The access token has a budget of its own
+		createTestPost(t, ts, pat.Token)
+		resp = ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, getAuthHeaders(pat.Token))
+		assert.Equal(t, 429, resp.StatusCode)
+
+		// Other routes are not affected
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, getAuthHeaders(token))
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+}
+
+func TestRateLimitRedisStore(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.RateLimit.Store = "redis"
+		cfg.RateLimit.Global = config.Rate{Limit: 2, Window: time.Minute}
+	})
+	defer ts.Close(t)
+
+	ctx := context.Background()
+	keys, err := database.RedisClient.Keys(ctx, "rate_limit:global:*").Result()
+	require.NoError(t, err)
+	if len(keys) > 0 {
+		require.NoError(t, database.RedisClient.Del(ctx, keys...).Err())
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, 200, ts.SendRequest(t, "GET", "/api/v1/health", nil, nil).StatusCode)
+	}
+
+	resp := ts.SendRequest(t, "GET", "/api/v1/health", nil, nil)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+
+	// Budgets live in Redis, so a fresh server shares them
+	other := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.RateLimit.Store = "redis"
+		cfg.RateLimit.Global = config.Rate{Limit: 2, Window: time.Minute}
+	})
+	assert.Equal(t, 429, other.SendRequest(t, "GET", "/api/v1/health", nil, nil).StatusCode)
+}
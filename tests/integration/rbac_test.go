@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+	"go-auth-boilerplate/seeds"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleBasedAccessControl(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Role{}, &models.Permission{})
+	require.NoError(t, err)
+	require.NoError(t, seeds.SeedRoles())
+
+	createTestUser(t, ts)
+	john := loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", map[string]any{
+		"first_name": "Jane",
+		"last_name":  "Smith",
+		"age":        25,
+		"email":      "jane@example.com",
+		"password":   "Pass123",
+	}, nil)
+	require.Equal(t, 201, resp.StatusCode)
+	var jane models.TokenResponse
+	require.NoError(t, resp.DecodeBody(&jane))
+
+	var johnUser, janeUser models.User
+	require.NoError(t, ts.DB.First(&johnUser, "email = ?", "john@example.com").Error)
+	require.NoError(t, ts.DB.First(&janeUser, "email = ?", "jane@example.com").Error)
+
+	janePostID := createTestPost(t, ts, jane.Token)
+
+	t.Run("new users get the user role", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/admin/roles", nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		var roles []string
+		ts.DB.Table("roles").
+			Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+			Where("user_roles.user_id = ?", janeUser.ID).
+			Pluck("roles.name", &roles)
+		assert.Equal(t, []string{models.RoleUser}, roles)
+	})
+
+	t.Run("role changes apply after refresh", func(t *testing.T) {
+		var admin models.Role
+		require.NoError(t, ts.DB.First(&admin, "name = ?", models.RoleAdmin).Error)
+		require.NoError(t, ts.DB.Model(&johnUser).Association("Roles").Append(&admin))
+
+		resp := ts.SendRequest(t, "GET", "/api/v1/admin/roles", nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]any{
+			"refresh_token": john.RefreshToken,
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		require.NoError(t, resp.DecodeBody(&john))
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/admin/roles", nil, getAuthHeaders(john.Token))
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.RolesResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		require.Len(t, result.Items, 2)
+		assert.Equal(t, models.RoleAdmin, result.Items[0].Name)
+		assert.NotEmpty(t, result.Items[0].Permissions)
+	})
+
+	t.Run("permission guarded route", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/admin/posts/%d", janePostID)
+
+		resp := ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(jane.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("assign and remove roles", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/admin/users/%d/roles", janeUser.ID)
+
+		resp := ts.SendRequest(t, "POST", path, map[string]any{"role": "superuser"}, getAuthHeaders(john.Token))
+		assert.Equal(t, 400, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", path, map[string]any{"role": models.RoleAdmin}, getAuthHeaders(jane.Token))
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", path, map[string]any{"role": models.RoleAdmin}, getAuthHeaders(john.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", path, nil, getAuthHeaders(john.Token))
+		require.Equal(t, 200, resp.StatusCode)
+		var result models.RolesResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Len(t, result.Items, 2)
+
+		resp = ts.SendRequest(t, "DELETE", path+"/"+models.RoleAdmin, nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "DELETE", path+"/"+models.RoleAdmin, nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("last admin cannot be removed", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/admin/users/%d/roles/%s", johnUser.ID, models.RoleAdmin)
+		resp := ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+
+	t.Run("deleted admins don't count", func(t *testing.T) {
+		var admin models.Role
+		require.NoError(t, ts.DB.First(&admin, "name = ?", models.RoleAdmin).Error)
+		require.NoError(t, ts.DB.Model(&janeUser).Association("Roles").Append(&admin))
+		require.NoError(t, ts.DB.Delete(&janeUser).Error)
+
+		path := fmt.Sprintf("/api/v1/admin/users/%d/roles/%s", johnUser.ID, models.RoleAdmin)
+		resp := ts.SendRequest(t, "DELETE", path, nil, getAuthHeaders(john.Token))
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+}
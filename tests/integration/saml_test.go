@@ -0,0 +1,236 @@
+package integration
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+	"go-auth-boilerplate/seeds"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAML(t *testing.T) {
+	idp := testutil.NewMockSAMLIdP(t)
+	var acme, globex config.SAMLTenantConfig
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		acme = idp.Config("acme", cfg.OAuth.Issuer, cfg.Server.AppURL)
+		globex = idp.Config("globex", cfg.OAuth.Issuer, cfg.Server.AppURL)
+		globex.AllowIDPInitiated = true
+		globex.LinkByEmail = true
+		cfg.SAML = []config.SAMLTenantConfig{acme, globex}
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Identity{})
+	require.NoError(t, err)
+	require.NoError(t, seeds.SeedRoles())
+
+	alice := map[string]string{
+		"email":      "alice@acme.com",
+		"first_name": "Alice",
+		"last_name":  "Smith",
+	}
+
+	// startLogin runs the SP-initiated redirect and returns the request ID
+	// the IdP has to answer.
+	startLogin := func(t *testing.T, tenant string) string {
+		resp := ts.SendRequest(t, "GET", "/saml/"+tenant+"/login", nil, nil)
+		require.Equal(t, 302, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		require.True(t, strings.HasPrefix(location, testutil.MockSAMLIdPSSOURL+"?"), location)
+		return idp.AuthnRequestID(t, location)
+	}
+
+	// postResponse posts the SAMLResponse to the tenant's ACS and returns the
+	// login code from the redirect, or the failed response.
+	postResponse := func(t *testing.T, tenant, samlResponse string) (string, *testutil.TestResponse) {
+		resp := ts.SendForm(t, "/saml/"+tenant+"/acs", url.Values{"SAMLResponse": {samlResponse}})
+		if resp.StatusCode != 303 {
+			return "", resp
+		}
+		location, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/login/saml/callback", location.Path)
+		return location.Query().Get("code"), resp
+	}
+
+	exchange := func(t *testing.T, code string) *testutil.TestResponse {
+		return ts.SendRequest(t, "POST", "/api/v1/user/login/saml", map[string]any{"code": code}, nil)
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/saml/acme/metadata", nil, nil)
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "application/samlmetadata+xml")
+		assert.Contains(t, string(resp.Body), `entityID="`+acme.EntityID+`"`)
+		assert.Contains(t, string(resp.Body), `Location="`+acme.ACSURL+`"`)
+
+		resp = ts.SendRequest(t, "GET", "/saml/initech/metadata", nil, nil)
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	var provisioned models.User
+
+	t.Run("SP-initiated login provisions the user", func(t *testing.T) {
+		requestID := startLogin(t, "acme")
+		samlResponse := idp.Response(t, acme, testutil.SAMLAssertion{
+			InResponseTo: requestID,
+			NameID:       "00u1alice",
+			Attributes:   alice,
+		})
+
+		code, resp := postResponse(t, "acme", samlResponse)
+		require.NotEmpty(t, code, string(resp.Body))
+
+		resp = exchange(t, code)
+		require.Equal(t, 200, resp.StatusCode)
+		var tokens models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&tokens))
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, string(resp.Body), "alice@acme.com")
+
+		require.NoError(t, ts.DB.Preload("Roles").First(&provisioned, "email = ?", "alice@acme.com").Error)
+		assert.Equal(t, "Alice", provisioned.FirstName)
+		assert.Equal(t, "Smith", provisioned.LastName)
+		assert.NotNil(t, provisioned.EmailVerifiedAt)
+		assert.False(t, provisioned.HasPassword())
+		require.Len(t, provisioned.Roles, 1)
+		assert.Equal(t, models.RoleUser, provisioned.Roles[0].Name)
+
+		var identity models.Identity
+		require.NoError(t, ts.DB.First(&identity, "user_id = ?", provisioned.ID).Error)
+		assert.Equal(t, "saml:acme", identity.Provider)
+		assert.Equal(t, "00u1alice", identity.Subject)
+
+		t.Run("response and code are single use", func(t *testing.T) {
+			_, resp := postResponse(t, "acme", samlResponse)
+			assert.Equal(t, 401, resp.StatusCode)
+
+			resp = exchange(t, code)
+			assert.Equal(t, 401, resp.StatusCode)
+		})
+	})
+
+	t.Run("later logins sync the profile", func(t *testing.T) {
+		code, resp := postResponse(t, "acme", idp.Response(t, acme, testutil.SAMLAssertion{
+			InResponseTo: startLogin(t, "acme"),
+			NameID:       "00u1alice",
+			Attributes:   map[string]string{"email": "alice@acme.com", "first_name": "Alice", "last_name": "Jones"},
+			SignResponse: true,
+		}))
+		require.NotEmpty(t, code, string(resp.Body))
+		require.Equal(t, 200, exchange(t, code).StatusCode)
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, provisioned.ID).Error)
+		assert.Equal(t, "Jones", user.LastName)
+
+		var count int64
+		ts.DB.Model(&models.User{}).Where("email = ?", "alice@acme.com").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("invalid responses are rejected", func(t *testing.T) {
+		otherIdP := testutil.NewMockSAMLIdP(t)
+
+		tampered := func(t *testing.T, requestID string) string {
+			raw, err := base64.StdEncoding.DecodeString(idp.Response(t, acme, testutil.SAMLAssertion{
+				InResponseTo: requestID,
+				NameID:       "00u1alice",
+				Attributes:   alice,
+			}))
+			require.NoError(t, err)
+			return base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(raw), "alice@acme.com", "mallory@acme.com", 1)))
+		}
+
+		tests := []struct {
+			name         string
+			samlResponse func(t *testing.T, requestID string) string
+		}{
+			{"unsigned", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{InResponseTo: requestID, NameID: "00u1alice", Attributes: alice, Unsigned: true})
+			}},
+			{"tampered", tampered},
+			{"signed by another IdP", func(t *testing.T, requestID string) string {
+				return otherIdP.Response(t, acme, testutil.SAMLAssertion{InResponseTo: requestID, NameID: "00u1alice", Attributes: alice})
+			}},
+			{"wrong issuer", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{InResponseTo: requestID, NameID: "00u1alice", Attributes: alice, Issuer: "https://evil.example/metadata"})
+			}},
+			{"for another service provider", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{InResponseTo: requestID, NameID: "00u1alice", Attributes: alice, Audience: globex.EntityID})
+			}},
+			{"for another tenant's ACS", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{InResponseTo: requestID, NameID: "00u1alice", Attributes: alice, Recipient: globex.ACSURL})
+			}},
+			{"expired", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{InResponseTo: requestID, NameID: "00u1alice", Attributes: alice, IssuedAt: time.Now().Add(-time.Hour)})
+			}},
+			{"answering an unknown request", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{InResponseTo: "_unknown", NameID: "00u1alice", Attributes: alice})
+			}},
+			{"unsolicited", func(t *testing.T, requestID string) string {
+				return idp.Response(t, acme, testutil.SAMLAssertion{NameID: "00u1alice", Attributes: alice})
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, resp := postResponse(t, "acme", tt.samlResponse(t, startLogin(t, "acme")))
+				assert.Equal(t, 401, resp.StatusCode)
+			})
+		}
+
+		var count int64
+		ts.DB.Model(&models.User{}).Where("email = ?", "mallory@acme.com").Count(&count)
+		assert.Zero(t, count)
+	})
+
+	t.Run("existing account is not taken over", func(t *testing.T) {
+		createTestUser(t, ts)
+
+		_, resp := postResponse(t, "acme", idp.Response(t, acme, testutil.SAMLAssertion{
+			InResponseTo: startLogin(t, "acme"),
+			NameID:       "00u1john",
+			Attributes:   map[string]string{"email": "john@example.com"},
+		}))
+		assert.Equal(t, 409, resp.StatusCode)
+	})
+
+	t.Run("IdP-initiated login links by email where allowed", func(t *testing.T) {
+		code, resp := postResponse(t, "globex", idp.Response(t, globex, testutil.SAMLAssertion{
+			NameID:       "john@example.com",
+			NameIDFormat: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+		}))
+		require.NotEmpty(t, code, string(resp.Body))
+
+		resp = exchange(t, code)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "email = ?", "john@example.com").Error)
+		var identity models.Identity
+		require.NoError(t, ts.DB.First(&identity, "provider = ? AND subject = ?", "saml:globex", "john@example.com").Error)
+		assert.Equal(t, user.ID, identity.UserID)
+		assert.True(t, user.HasPassword())
+	})
+	t.Run("deleted accounts can't log in", func(t *testing.T) {
+		require.NoError(t, ts.DB.Delete(&models.User{}, provisioned.ID).Error)
+
+		_, resp := postResponse(t, "acme", idp.Response(t, acme, testutil.SAMLAssertion{
+			InResponseTo: startLogin(t, "acme"),
+			NameID:       "00u1alice",
+			Attributes:   alice,
+		}))
+		assert.Equal(t, 401, resp.StatusCode)
+		assert.Contains(t, string(resp.Body), "Account not found")
+	})
+}
@@ -0,0 +1,376 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+	"go-auth-boilerplate/seeds"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSCIMToken = "scim-test-token"
+
+// scimError is the SCIM error envelope.
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType"`
+	Detail   string   `json:"detail"`
+}
+
+type scimUserList struct {
+	TotalResults int               `json:"totalResults"`
+	StartIndex   int               `json:"startIndex"`
+	ItemsPerPage int               `json:"itemsPerPage"`
+	Resources    []models.SCIMUser `json:"Resources"`
+}
+
+func TestSCIM(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.SCIM.Token = testSCIMToken
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{})
+	require.NoError(t, err)
+	require.NoError(t, seeds.SeedRoles())
+
+	headers := getAuthHeaders(testSCIMToken)
+
+	// expectError checks a failed response carries the SCIM error envelope.
+	expectError := func(t *testing.T, resp *testutil.TestResponse, status int, scimType string) {
+		t.Helper()
+		require.Equal(t, status, resp.StatusCode, string(resp.Body))
+		assert.Contains(t, resp.Header.Get("Content-Type"), "application/scim+json")
+		var body scimError
+		require.NoError(t, resp.DecodeBody(&body))
+		assert.Equal(t, []string{"urn:ietf:params:scim:api:messages:2.0:Error"}, body.Schemas)
+		assert.Equal(t, fmt.Sprint(status), body.Status)
+		assert.Equal(t, scimType, body.ScimType)
+	}
+
+	createUser := func(t *testing.T, email, externalID string) models.SCIMUser {
+		resp := ts.SendRequest(t, "POST", "/scim/v2/Users", map[string]any{
+			"schemas":    []string{"urn:ietf:params:scim:schemas:core:2.0:User"},
+			"externalId": externalID,
+			"userName":   email,
+			"name":       map[string]string{"givenName": "Jane", "familyName": "Doe"},
+			"active":     true,
+		}, headers)
+		require.Equal(t, 201, resp.StatusCode, string(resp.Body))
+		var user models.SCIMUser
+		require.NoError(t, resp.DecodeBody(&user))
+		return user
+	}
+
+	t.Run("requires the token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/scim/v2/Users", nil, nil)
+		expectError(t, resp, 401, "")
+		assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+
+		resp = ts.SendRequest(t, "GET", "/scim/v2/Users", nil, getAuthHeaders("wrong"))
+		expectError(t, resp, 401, "")
+
+		// A user's session token is no SCIM token
+		resp = ts.SendRequest(t, "GET", "/scim/v2/Users", nil, getAuthHeaders(createTestUser(t, ts)))
+		expectError(t, resp, 401, "")
+	})
+
+	var jane models.SCIMUser
+
+	t.Run("create and get a user", func(t *testing.T) {
+		jane = createUser(t, "jane@acme.com", "00u1jane")
+		assert.Equal(t, "jane@acme.com", jane.UserName)
+		assert.Equal(t, "00u1jane", jane.ExternalID)
+		require.NotNil(t, jane.Active)
+		assert.True(t, *jane.Active)
+		require.Len(t, jane.Groups, 1)
+		assert.Equal(t, models.RoleUser, jane.Groups[0].Display)
+		assert.Equal(t, "User", jane.Meta.ResourceType)
+
+		resp := ts.SendRequest(t, "GET", "/scim/v2/Users/"+jane.ID, nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "application/scim+json")
+		var fetched models.SCIMUser
+		require.NoError(t, resp.DecodeBody(&fetched))
+		assert.Equal(t, "Jane", fetched.Name.GivenName)
+		assert.Equal(t, "Jane Doe", fetched.DisplayName)
+		assert.Empty(t, fetched.Password)
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "email = ?", "jane@acme.com").Error)
+		assert.NotNil(t, user.EmailVerifiedAt)
+		assert.False(t, user.HasPassword())
+
+		expectError(t, ts.SendRequest(t, "GET", "/scim/v2/Users/999999", nil, headers), 404, "")
+	})
+
+	t.Run("invalid users are rejected", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/scim/v2/Users", map[string]any{"userName": "jane@acme.com"}, headers)
+		expectError(t, resp, 409, "uniqueness")
+
+		resp = ts.SendRequest(t, "POST", "/scim/v2/Users", map[string]any{"userName": "not an email"}, headers)
+		expectError(t, resp, 400, "invalidValue")
+	})
+
+	t.Run("list with filter and pagination", func(t *testing.T) {
+		createUser(t, "bob@acme.com", "00u1bob")
+		createUser(t, "carol@globex.com", "00u1carol")
+
+		list := func(t *testing.T, query url.Values) scimUserList {
+			resp := ts.SendRequest(t, "GET", "/scim/v2/Users?"+query.Encode(), nil, headers)
+			require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+			var body scimUserList
+			require.NoError(t, resp.DecodeBody(&body))
+			return body
+		}
+
+		body := list(t, url.Values{"filter": {`userName eq "JANE@acme.com"`}})
+		assert.Equal(t, 1, body.TotalResults)
+		require.Len(t, body.Resources, 1)
+		assert.Equal(t, jane.ID, body.Resources[0].ID)
+
+		body = list(t, url.Values{"filter": {`userName ew "@acme.com" and not (externalId eq "00u1bob")`}})
+		require.Len(t, body.Resources, 1)
+		assert.Equal(t, "jane@acme.com", body.Resources[0].UserName)
+
+		body = list(t, url.Values{"filter": {`externalId eq "00U1JANE"`}})
+		assert.Zero(t, body.TotalResults)
+
+		body = list(t, url.Values{"filter": {`active eq true`}, "startIndex": {"2"}, "count": {"1"}})
+		assert.Equal(t, 4, body.TotalResults)
+		assert.Equal(t, 2, body.StartIndex)
+		assert.Equal(t, 1, body.ItemsPerPage)
+		require.Len(t, body.Resources, 1)
+		assert.Equal(t, jane.ID, body.Resources[0].ID)
+
+		resp := ts.SendRequest(t, "GET", "/scim/v2/Users?filter="+url.QueryEscape(`userName eq`), nil, headers)
+		expectError(t, resp, 400, "invalidFilter")
+
+		resp = ts.SendRequest(t, "GET", "/scim/v2/Users?filter="+url.QueryEscape(`password eq "x"`), nil, headers)
+		expectError(t, resp, 400, "invalidFilter")
+	})
+
+	t.Run("PATCH and PUT update the user", func(t *testing.T) {
+		resp := ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+jane.ID, map[string]any{
+			"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+			"Operations": []map[string]any{
+				{"op": "Replace", "path": "name.familyName", "value": "Smith"},
+				{"op": "replace", "value": map[string]any{"externalId": "00u2jane", "displayName": "Jane Smith"}},
+				{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "R&D"},
+			},
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		var patched models.SCIMUser
+		require.NoError(t, resp.DecodeBody(&patched))
+		assert.Equal(t, "Smith", patched.Name.FamilyName)
+		assert.Equal(t, "Jane", patched.Name.GivenName)
+		assert.Equal(t, "00u2jane", patched.ExternalID)
+
+		resp = ts.SendRequest(t, "PUT", "/scim/v2/Users/"+jane.ID, map[string]any{
+			"userName":   "jane.smith@acme.com",
+			"externalId": "00u2jane",
+			"name":       map[string]string{"givenName": "Janet", "familyName": "Smith"},
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "id = ?", jane.ID).Error)
+		assert.Equal(t, "jane.smith@acme.com", user.Email)
+		assert.Equal(t, "Janet", user.FirstName)
+		assert.Nil(t, user.SuspendedAt)
+
+		resp = ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+jane.ID, map[string]any{
+			"Operations": []map[string]any{{"op": "replace", "path": "nickName", "value": "JJ"}},
+		}, headers)
+		expectError(t, resp, 400, "invalidPath")
+
+		resp = ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+jane.ID, map[string]any{
+			"Operations": []map[string]any{{"op": "replace", "path": "userName", "value": "bob@acme.com"}},
+		}, headers)
+		expectError(t, resp, 409, "uniqueness")
+	})
+
+	t.Run("deactivating signs the user out", func(t *testing.T) {
+		dave := createUser(t, "dave@acme.com", "00u1dave")
+		resp := ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+dave.ID, map[string]any{
+			"Operations": []map[string]any{{"op": "replace", "path": "password", "value": "Secret123"}},
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		session := getAuthHeaders(loginTestUser(t, ts, "dave@acme.com", "Secret123", nil).Token)
+		require.Equal(t, 200, ts.SendRequest(t, "GET", "/api/v1/session", nil, session).StatusCode)
+
+		// Some IdPs send booleans as strings
+		resp = ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+dave.ID, map[string]any{
+			"Operations": []map[string]any{{"op": "Replace", "path": "active", "value": "False"}},
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		var patched models.SCIMUser
+		require.NoError(t, resp.DecodeBody(&patched))
+		require.NotNil(t, patched.Active)
+		assert.False(t, *patched.Active)
+
+		assert.Equal(t, 401, ts.SendRequest(t, "GET", "/api/v1/session", nil, session).StatusCode)
+		assertNoSessions(t, dave.ID)
+
+		resp = ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+dave.ID, map[string]any{
+			"Operations": []map[string]any{{"op": "replace", "value": map[string]any{"active": true}}},
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		loginTestUser(t, ts, "dave@acme.com", "Secret123", nil)
+	})
+
+	t.Run("deleting deprovisions the user", func(t *testing.T) {
+		erin := createUser(t, "erin@acme.com", "00u1erin")
+		resp := ts.SendRequest(t, "PUT", "/scim/v2/Users/"+erin.ID, map[string]any{
+			"userName": "erin@acme.com",
+			"name":     map[string]string{"givenName": "Erin", "familyName": "Doe"},
+			"password": "Secret123",
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		loginTestUser(t, ts, "erin@acme.com", "Secret123", nil)
+		loginTestUser(t, ts, "erin@acme.com", "Secret123", nil)
+
+		resp = ts.SendRequest(t, "DELETE", "/scim/v2/Users/"+erin.ID, nil, headers)
+		require.Equal(t, 204, resp.StatusCode)
+		assertNoSessions(t, erin.ID)
+
+		expectError(t, ts.SendRequest(t, "GET", "/scim/v2/Users/"+erin.ID, nil, headers), 404, "")
+		expectError(t, ts.SendRequest(t, "DELETE", "/scim/v2/Users/"+erin.ID, nil, headers), 404, "")
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]any{"email": "erin@acme.com", "password": "Secret123"}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		createUser(t, "erin@acme.com", "00u1erin")
+	})
+
+	t.Run("groups are roles", func(t *testing.T) {
+		bob := createUser(t, "bob2@acme.com", "00u2bob")
+
+		resp := ts.SendRequest(t, "POST", "/scim/v2/Groups", map[string]any{
+			"schemas":     []string{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+			"displayName": "engineering",
+			"externalId":  "00g1eng",
+			"members":     []map[string]string{{"value": jane.ID}},
+		}, headers)
+		require.Equal(t, 201, resp.StatusCode, string(resp.Body))
+		var group models.SCIMGroup
+		require.NoError(t, resp.DecodeBody(&group))
+		assert.Equal(t, "engineering", group.DisplayName)
+		require.Len(t, group.Members, 1)
+		assert.Equal(t, jane.ID, group.Members[0].Value)
+
+		var role models.Role
+		require.NoError(t, ts.DB.Preload("Permissions").First(&role, "name = ?", "engineering").Error)
+		assert.Empty(t, role.Permissions)
+
+		groupPath := "/scim/v2/Groups/" + group.ID
+		patch := func(t *testing.T, operations ...map[string]any) *testutil.TestResponse {
+			return ts.SendRequest(t, "PATCH", groupPath, map[string]any{
+				"schemas":    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+				"Operations": operations,
+			}, headers)
+		}
+		members := func(t *testing.T) []string {
+			resp := ts.SendRequest(t, "GET", groupPath, nil, headers)
+			require.Equal(t, 200, resp.StatusCode)
+			var group models.SCIMGroup
+			require.NoError(t, resp.DecodeBody(&group))
+			ids := []string{}
+			for _, member := range group.Members {
+				ids = append(ids, member.Value)
+			}
+			return ids
+		}
+
+		resp = patch(t, map[string]any{"op": "add", "path": "members", "value": []map[string]string{{"value": bob.ID}}})
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		assert.Equal(t, []string{jane.ID, bob.ID}, members(t))
+
+		resp = ts.SendRequest(t, "GET", "/scim/v2/Users/"+bob.ID, nil, headers)
+		assert.Contains(t, string(resp.Body), `"display":"engineering"`)
+
+		resp = patch(t, map[string]any{"op": "remove", "path": fmt.Sprintf(`members[value eq "%s"]`, jane.ID)})
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		assert.Equal(t, []string{bob.ID}, members(t))
+
+		resp = patch(t, map[string]any{"op": "add", "path": "members", "value": []map[string]string{{"value": "999999"}}})
+		expectError(t, resp, 400, "invalidValue")
+
+		resp = patch(t, map[string]any{"op": "replace", "path": "displayName", "value": "platform"})
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+
+		resp = ts.SendRequest(t, "GET", "/scim/v2/Groups?excludedAttributes=members&filter="+url.QueryEscape(`displayName eq "Platform"`), nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+		var list struct {
+			TotalResults int                `json:"totalResults"`
+			Resources    []models.SCIMGroup `json:"Resources"`
+		}
+		require.NoError(t, resp.DecodeBody(&list))
+		require.Equal(t, 1, list.TotalResults)
+		assert.Equal(t, group.ID, list.Resources[0].ID)
+		assert.Nil(t, list.Resources[0].Members)
+
+		resp = ts.SendRequest(t, "PUT", groupPath, map[string]any{"displayName": "platform", "members": []map[string]string{}}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+		assert.Empty(t, members(t))
+
+		resp = ts.SendRequest(t, "POST", "/scim/v2/Groups", map[string]any{"displayName": "platform"}, headers)
+		expectError(t, resp, 409, "uniqueness")
+
+		resp = ts.SendRequest(t, "DELETE", groupPath, nil, headers)
+		require.Equal(t, 204, resp.StatusCode)
+		expectError(t, ts.SendRequest(t, "GET", groupPath, nil, headers), 404, "")
+	})
+
+	t.Run("built-in roles are protected", func(t *testing.T) {
+		var admin models.Role
+		require.NoError(t, ts.DB.First(&admin, "name = ?", models.RoleAdmin).Error)
+		adminPath := fmt.Sprintf("/scim/v2/Groups/%d", admin.ID)
+
+		expectError(t, ts.SendRequest(t, "DELETE", adminPath, nil, headers), 400, "mutability")
+
+		resp := ts.SendRequest(t, "PATCH", adminPath, map[string]any{
+			"Operations": []map[string]any{{"op": "replace", "path": "displayName", "value": "root"}},
+		}, headers)
+		expectError(t, resp, 400, "mutability")
+
+		resp = ts.SendRequest(t, "PATCH", adminPath, map[string]any{
+			"Operations": []map[string]any{{"op": "add", "path": "members", "value": []map[string]string{{"value": jane.ID}}}},
+		}, headers)
+		require.Equal(t, 200, resp.StatusCode, string(resp.Body))
+
+		resp = ts.SendRequest(t, "PATCH", adminPath, map[string]any{
+			"Operations": []map[string]any{{"op": "remove", "path": "members"}},
+		}, headers)
+		expectError(t, resp, 409, "")
+	})
+
+	t.Run("the last admin can't be deprovisioned", func(t *testing.T) {
+		resp := ts.SendRequest(t, "PATCH", "/scim/v2/Users/"+jane.ID, map[string]any{
+			"Operations": []map[string]any{{"op": "replace", "path": "active", "value": false}},
+		}, headers)
+		expectError(t, resp, 409, "")
+
+		expectError(t, ts.SendRequest(t, "DELETE", "/scim/v2/Users/"+jane.ID, nil, headers), 409, "")
+	})
+}
+
+// assertNoSessions checks the user has no sessions left in Redis.
+func assertNoSessions(t *testing.T, userID string) {
+	t.Helper()
+	id, err := strconv.ParseUint(userID, 10, 64)
+	require.NoError(t, err)
+	sessions, err := auth.ListSessions(context.Background(), uint(id))
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
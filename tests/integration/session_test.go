@@ -0,0 +1,139 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"go-auth-boilerplate/internal/auth"
+	"go-auth-boilerplate/internal/database"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loginTestUser(t *testing.T, ts *testutil.TestServer, email, password string, headers map[string]string) models.TokenResponse {
+	loginReq := map[string]interface{}{
+		"email":    email,
+		"password": password,
+	}
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/login", loginReq, headers)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var tokens models.TokenResponse
+	require.NoError(t, resp.DecodeBody(&tokens))
+	require.NotEmpty(t, tokens.Token)
+	return tokens
+}
+
+func TestSessionManagement(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	signupToken := createTestUser(t, ts)
+	laptop := loginTestUser(t, ts, "john@example.com", "Pass123", map[string]string{
+		"X-Device-Name": "Laptop",
+		"User-Agent":    "laptop-browser",
+	})
+	phone := loginTestUser(t, ts, "john@example.com", "Pass123", map[string]string{
+		"X-Device-Name": "Phone",
+	})
+
+	var phoneSessionID string
+
+	t.Run("list sessions", func(t *testing.T) {
+		resp := ts.SendRequest(t, "GET", "/api/v1/sessions", nil, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var result models.SessionsResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		require.Len(t, result.Items, 3)
+
+		for _, session := range result.Items {
+			assert.NotEmpty(t, session.ID)
+			assert.False(t, session.CreatedAt.IsZero())
+			switch session.Device {
+			case "Laptop":
+				assert.True(t, session.Current)
+				assert.Equal(t, "laptop-browser", session.UserAgent)
+			case "Phone":
+				assert.False(t, session.Current)
+				phoneSessionID = session.ID
+			default:
+				assert.False(t, session.Current)
+			}
+		}
+		require.NotEmpty(t, phoneSessionID)
+	})
+
+	t.Run("revoke another session", func(t *testing.T) {
+		resp := ts.SendRequest(t, "DELETE", "/api/v1/sessions/"+phoneSessionID, nil, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(phone.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": phone.RefreshToken,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("revoke unknown session", func(t *testing.T) {
+		resp := ts.SendRequest(t, "DELETE", "/api/v1/sessions/"+phoneSessionID, nil, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 404, resp.StatusCode)
+	})
+
+	t.Run("expired session is not recreated", func(t *testing.T) {
+		ctx := context.Background()
+		require.NoError(t, auth.TouchSession(ctx, "expired-session", auth.SessionMetadata{IP: "127.0.0.1"}))
+		exists, err := database.RedisClient.Exists(ctx, "session:expired-session").Result()
+		require.NoError(t, err)
+		assert.Zero(t, exists)
+
+		expired := loginTestUser(t, ts, "john@example.com", "Pass123", nil)
+		refreshKey := "refresh_token:" + auth.HashToken(expired.RefreshToken)
+		require.NoError(t, database.RedisClient.Del(ctx, refreshKey).Err())
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": expired.RefreshToken,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+		exists, err = database.RedisClient.Exists(ctx, refreshKey).Result()
+		require.NoError(t, err)
+		assert.Zero(t, exists)
+	})
+
+	t.Run("update password signs out other sessions", func(t *testing.T) {
+		updatePasswordReq := map[string]interface{}{
+			"current_password": "Pass123",
+			"new_password":     "NewPass123",
+		}
+
+		resp := ts.SendRequest(t, "PATCH", "/api/v1/user/update_password", updatePasswordReq, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(signupToken))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("revoke all sessions", func(t *testing.T) {
+		other := loginTestUser(t, ts, "john@example.com", "NewPass123", nil)
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/sessions/revoke_all", nil, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(laptop.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(other.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+}
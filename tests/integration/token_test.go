@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"testing"
+
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenRefresh(t *testing.T) {
+	ts := testutil.NewTestServer(t)
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{})
+	require.NoError(t, err)
+
+	createUserReq := map[string]interface{}{
+		"first_name": "John",
+		"last_name":  "Doe",
+		"age":        30,
+		"email":      "john@example.com",
+		"password":   "Pass123",
+	}
+
+	resp := ts.SendRequest(t, "POST", "/api/v1/user/signup", createUserReq, nil)
+	require.Equal(t, 201, resp.StatusCode)
+
+	var tokens models.TokenResponse
+	require.NoError(t, resp.DecodeBody(&tokens))
+	require.NotEmpty(t, tokens.Token)
+	require.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, int64(ts.Config.JWT.AccessTokenExpiry.Seconds()), tokens.ExpiresIn)
+
+	firstRefreshToken := tokens.RefreshToken
+
+	t.Run("refresh rotates the refresh token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": firstRefreshToken,
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		var rotated models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&rotated))
+		assert.NotEmpty(t, rotated.Token)
+		assert.NotEqual(t, firstRefreshToken, rotated.RefreshToken)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(rotated.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		tokens = rotated
+	})
+
+	t.Run("refresh with missing token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("refresh with unknown token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": "not-a-real-token",
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("reusing a rotated refresh token revokes the family", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": firstRefreshToken,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		var result map[string]interface{}
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.Contains(t, result["error"], "reuse detected")
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": tokens.RefreshToken,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, getAuthHeaders(tokens.Token))
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("logout revokes the refresh token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/login", map[string]interface{}{
+			"email":    "john@example.com",
+			"password": "Pass123",
+		}, nil)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var session models.TokenResponse
+		require.NoError(t, resp.DecodeBody(&session))
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/user/logout", nil, getAuthHeaders(session.Token))
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/token/refresh", map[string]interface{}{
+			"refresh_token": session.RefreshToken,
+		}, nil)
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+}
@@ -0,0 +1,76 @@
+package integration
+
+import (
+	"testing"
+
+	"go-auth-boilerplate/config"
+	"go-auth-boilerplate/internal/models"
+	"go-auth-boilerplate/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailVerification(t *testing.T) {
+	ts := testutil.NewTestServerWithConfig(t, func(cfg *config.Config) {
+		cfg.Auth.RequireEmailVerification = true
+	})
+	defer ts.Close(t)
+
+	err := ts.DB.AutoMigrate(&models.User{}, &models.Post{})
+	require.NoError(t, err)
+
+	token := createTestUser(t, ts)
+	headers := getAuthHeaders(token)
+
+	t.Run("unverified users cannot create posts", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, headers)
+		assert.Equal(t, 403, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/posts", nil, headers)
+		assert.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("signing up cannot mark the email as verified", func(t *testing.T) {
+		var user models.User
+		require.NoError(t, ts.DB.First(&user, "email = ?", "john@example.com").Error)
+		assert.Nil(t, user.EmailVerifiedAt)
+	})
+
+	t.Run("resend is throttled", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/verify_email/resend", nil, headers)
+		assert.Equal(t, 429, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("verify with invalid token", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/verify_email", map[string]interface{}{
+			"token": token,
+		}, nil)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+
+	t.Run("verify email", func(t *testing.T) {
+		verificationToken := waitForEmail(t, ts, "john@example.com", "Confirm your email address", 1, "token")
+
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/verify_email", map[string]interface{}{
+			"token": verificationToken,
+		}, nil)
+		assert.Equal(t, 200, resp.StatusCode)
+
+		resp = ts.SendRequest(t, "GET", "/api/v1/session", nil, headers)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result models.UserResponse
+		require.NoError(t, resp.DecodeBody(&result))
+		assert.NotNil(t, result.EmailVerifiedAt)
+
+		resp = ts.SendRequest(t, "POST", "/api/v1/posts/create", validPost, headers)
+		assert.Equal(t, 201, resp.StatusCode)
+	})
+
+	t.Run("resend after verification", func(t *testing.T) {
+		resp := ts.SendRequest(t, "POST", "/api/v1/user/verify_email/resend", nil, headers)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+}